@@ -0,0 +1,78 @@
+package potency
+
+import (
+	"hash/fnv"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// Shard maps key to a backend index in [0, n) with jump consistent hashing:
+// every instance computes the same index, and when n grows only 1/n of keys
+// move. Load balancers can use it to send retries to the instance that holds
+// the result in memory.
+func Shard(key string, n int) int {
+	if n <= 0 {
+		return -1
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	k := h.Sum64()
+
+	b, j := int64(-1), int64(0)
+
+	for j < int64(n) {
+		b = j
+		k = k*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((k>>33)+1)))
+	}
+
+	return int(b)
+}
+
+// AffinityDirector returns an httputil.ReverseProxy Director that sends
+// requests with an Idempotency-Key to the backend chosen by Shard, and other
+// requests round-robin. The order of backends must be the same everywhere.
+// It panics if backends is empty.
+func AffinityDirector(backends []*url.URL) func(*http.Request) {
+	if len(backends) == 0 {
+		panic("potency: AffinityDirector needs at least one backend")
+	}
+
+	next := uint64(0)
+
+	return func(r *http.Request) {
+		i := 0
+
+		key, err := idempotencyKeyHeader(r)
+		if err == nil && key != "" {
+			i = Shard(key, len(backends))
+		} else {
+			i = int((atomic.AddUint64(&next, 1) - 1) % uint64(len(backends)))
+		}
+
+		target := backends[i]
+
+		r.URL.Scheme = target.Scheme
+		r.URL.Host = target.Host
+		r.URL.Path = strings.TrimSuffix(target.Path, "/") + "/" + strings.TrimPrefix(r.URL.Path, "/")
+		r.URL.RawPath = ""
+
+		if target.RawQuery != "" && r.URL.RawQuery != "" {
+			r.URL.RawQuery = target.RawQuery + "&" + r.URL.RawQuery
+		} else {
+			r.URL.RawQuery = target.RawQuery + r.URL.RawQuery
+		}
+	}
+}
+
+// NewAffinityProxy returns a reverse proxy over backends using
+// AffinityDirector. It panics if backends is empty.
+func NewAffinityProxy(backends []*url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Director: AffinityDirector(backends),
+	}
+}
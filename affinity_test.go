@@ -0,0 +1,98 @@
+package potency_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShard(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, -1, potency.Shard("abc", 0))
+	require.Equal(t, 0, potency.Shard("abc", 1))
+
+	counts := make([]int, 4)
+	moved := 0
+
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+
+		shard := potency.Shard(key, 4)
+		require.Equal(t, shard, potency.Shard(key, 4))
+		counts[shard]++
+
+		grown := potency.Shard(key, 5)
+		if grown != shard {
+			require.Equal(t, 4, grown)
+			moved++
+		}
+	}
+
+	for _, count := range counts {
+		require.Greater(t, count, 150)
+	}
+
+	require.Greater(t, moved, 100)
+	require.Less(t, moved, 300)
+}
+
+func TestAffinityProxy(t *testing.T) {
+	t.Parallel()
+
+	backends := []*url.URL{}
+	hits := make([]int32, 3)
+
+	for i := range hits {
+		i := i
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits[i], 1)
+			_, _ = fmt.Fprintf(w, "%d %s", i, r.URL.Path)
+		}))
+		defer srv.Close()
+
+		u, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+
+		backends = append(backends, u)
+	}
+
+	proxy := httptest.NewServer(potency.NewAffinityProxy(backends))
+	defer proxy.Close()
+
+	c := resty.New().SetBaseURL(proxy.URL)
+
+	want := fmt.Sprintf("%d /x", potency.Shard("abc", 3))
+
+	for i := 0; i < 5; i++ {
+		resp, err := c.R().
+			SetHeader("Idempotency-Key", `"abc"`).
+			Post("/x")
+		require.NoError(t, err)
+		require.Equal(t, want, resp.String())
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err := c.R().Get("/x")
+		require.NoError(t, err)
+	}
+
+	for i := range hits {
+		require.Positive(t, atomic.LoadInt32(&hits[i]))
+	}
+}
+
+func TestAffinityDirectorEmpty(t *testing.T) {
+	t.Parallel()
+
+	require.Panics(t, func() { potency.AffinityDirector(nil) })
+	require.Panics(t, func() { potency.NewAffinityProxy([]*url.URL{}) })
+}
@@ -0,0 +1,323 @@
+package potency
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BatchPutter is implemented by stores that can save several results in one
+// round trip, used by WithAsyncWrites.
+type BatchPutter interface {
+	PutBatch(ctx context.Context, srs []*SavedResult) error
+}
+
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes the request wait for space in the queue.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowWriteThrough saves the result synchronously instead.
+	OverflowWriteThrough
+
+	// OverflowDrop keeps the result in the local cache only.
+	OverflowDrop
+)
+
+type asyncWriter struct {
+	queue     chan *SavedResult
+	flush     chan chan error
+	batchSize int
+	interval  time.Duration
+	overflow  OverflowPolicy
+
+	// pending holds results until they are saved, so lookups can find them
+	// after they leave the local cache.
+	pending   map[string]*SavedResult
+	pendingMu sync.Mutex
+}
+
+// WithAsyncWrites saves results to the store in the background, in batches of
+// up to batchSize (using BatchPutter if the store implements it) at least
+// every interval, instead of before the response completes. Up to queueSize
+// results wait in memory; when the queue is full, overflow decides. A crash
+// loses queued results, so a retry that reaches another instance may execute
+// again. Shutdown saves what is queued; see also FlushPending. Queued results
+// are served to retries even if they have left the local cache. Only
+// effective in NewPotency.
+func WithAsyncWrites(queueSize, batchSize int, interval time.Duration, overflow OverflowPolicy) Option {
+	return func(cfg *config) {
+		cfg.asyncQueueSize = queueSize
+		cfg.asyncBatchSize = batchSize
+		cfg.asyncInterval = interval
+		cfg.asyncOverflow = overflow
+	}
+}
+
+func newAsyncWriter(cfg config) *asyncWriter {
+	if cfg.asyncQueueSize <= 0 {
+		return nil
+	}
+
+	aw := &asyncWriter{
+		queue:     make(chan *SavedResult, cfg.asyncQueueSize),
+		flush:     make(chan chan error),
+		pending:   map[string]*SavedResult{},
+		batchSize: cfg.asyncBatchSize,
+		interval:  cfg.asyncInterval,
+		overflow:  cfg.asyncOverflow,
+	}
+
+	if aw.batchSize <= 0 {
+		aw.batchSize = 1
+	}
+
+	if aw.interval <= 0 {
+		aw.interval = time.Second
+	}
+
+	return aw
+}
+
+// FlushPending saves results queued by WithAsyncWrites now and waits until
+// they are saved or ctx is done, e.g. before a deploy drains the instance.
+func (p *Potency) FlushPending(ctx context.Context) error {
+	aw := p.async
+	if aw == nil {
+		return nil
+	}
+
+	reply := make(chan error, 1)
+
+	select {
+	case aw.flush <- reply:
+	case <-p.stop:
+		// Shutdown saves the rest
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// enqueue hands sr to the background writer. It returns false if sr should
+// be saved synchronously instead.
+func (p *Potency) enqueue(sr *SavedResult) bool {
+	aw := p.async
+
+	select {
+	case <-p.stop:
+		return false
+	default:
+	}
+
+	// Added before queueing so the writer can't finish with sr first
+	aw.setPending(sr)
+
+	select {
+	case aw.queue <- sr:
+		return true
+	case <-p.stop:
+		aw.done([]*SavedResult{sr})
+		return false
+	default:
+	}
+
+	switch aw.overflow {
+	case OverflowDrop:
+		aw.done([]*SavedResult{sr})
+		return true
+
+	case OverflowWriteThrough:
+		aw.done([]*SavedResult{sr})
+		return false
+
+	default:
+		select {
+		case aw.queue <- sr:
+			return true
+		case <-p.stop:
+			aw.done([]*SavedResult{sr})
+			return false
+		}
+	}
+}
+
+func (p *Potency) asyncLoop() {
+	defer p.background.Done()
+
+	aw := p.async
+
+	ticker := time.NewTicker(aw.interval)
+	defer ticker.Stop()
+
+	batch := []*SavedResult{}
+
+	drain := func() {
+		for {
+			select {
+			case sr := <-aw.queue:
+				batch = append(batch, sr)
+			default:
+				return
+			}
+		}
+	}
+
+	save := func() error {
+		err := p.putBatch(aw.stillPending(batch))
+		aw.done(batch)
+		batch = nil
+
+		return err
+	}
+
+	for {
+		select {
+		case sr := <-aw.queue:
+			batch = append(batch, sr)
+
+			if len(batch) >= aw.batchSize {
+				_ = save()
+			}
+
+		case <-ticker.C:
+			_ = save()
+
+		case reply := <-aw.flush:
+			drain()
+			reply <- save()
+
+		case <-p.stop:
+			drain()
+			_ = save()
+
+			return
+		}
+	}
+}
+
+func (aw *asyncWriter) setPending(sr *SavedResult) {
+	aw.pendingMu.Lock()
+	defer aw.pendingMu.Unlock()
+
+	aw.pending[sr.Key] = sr
+}
+
+func (aw *asyncWriter) get(key string) *SavedResult {
+	aw.pendingMu.Lock()
+	defer aw.pendingMu.Unlock()
+
+	return aw.pending[key]
+}
+
+// stillPending drops results from batch that were invalidated while queued.
+func (aw *asyncWriter) stillPending(batch []*SavedResult) []*SavedResult {
+	aw.pendingMu.Lock()
+	defer aw.pendingMu.Unlock()
+
+	ret := make([]*SavedResult, 0, len(batch))
+
+	for _, sr := range batch {
+		if aw.pending[sr.Key] == sr {
+			ret = append(ret, sr)
+		}
+	}
+
+	return ret
+}
+
+func (aw *asyncWriter) done(batch []*SavedResult) {
+	aw.pendingMu.Lock()
+	defer aw.pendingMu.Unlock()
+
+	for _, sr := range batch {
+		if aw.pending[sr.Key] == sr {
+			delete(aw.pending, sr.Key)
+		}
+	}
+}
+
+// forget drops queued results for key, so an invalidation isn't undone by a
+// later write. A batch already being written can still land after it.
+func (aw *asyncWriter) forget(key string) {
+	aw.pendingMu.Lock()
+	defer aw.pendingMu.Unlock()
+
+	delete(aw.pending, key)
+}
+
+func (aw *asyncWriter) forgetWhere(match func(*SavedResult) bool) {
+	aw.pendingMu.Lock()
+	defer aw.pendingMu.Unlock()
+
+	for key, sr := range aw.pending {
+		if match(sr) {
+			delete(aw.pending, key)
+		}
+	}
+}
+
+// readPending finds an unexpired result for key waiting to be saved.
+func (p *Potency) readPending(key string) *SavedResult {
+	if p.async == nil {
+		return nil
+	}
+
+	sr := p.async.get(key)
+	if sr == nil || p.expired(sr) {
+		return nil
+	}
+
+	return sr
+}
+
+func (p *Potency) putBatch(batch []*SavedResult) error {
+	cfg := p.config()
+
+	if len(batch) == 0 || cfg.store == nil {
+		return nil
+	}
+
+	batcher, ok := cfg.store.(BatchPutter)
+	if !ok {
+		var firstErr error
+
+		for _, sr := range batch {
+			err := p.storePut(context.Background(), sr, cfg)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		return firstErr
+	}
+
+	ctx, cancel := withTimeout(context.Background(), cfg.writeTimeout)
+	defer cancel()
+
+	if cfg.storePrefix != "" {
+		stored := make([]*SavedResult, len(batch))
+
+		for i, sr := range batch {
+			stored[i] = cfg.toStore(sr)
+		}
+
+		batch = stored
+	}
+
+	err := batcher.PutBatch(ctx, batch)
+	if err != nil {
+		return fmt.Errorf("put batch of %d: %s (%w)", len(batch), err, ErrStore)
+	}
+
+	return nil
+}
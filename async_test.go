@@ -0,0 +1,209 @@
+package potency_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+type batchingStore struct {
+	*testStore
+
+	batches []int
+	started chan struct{}
+	release chan struct{}
+	mu      sync.Mutex
+}
+
+func (bs *batchingStore) PutBatch(ctx context.Context, srs []*potency.SavedResult) error {
+	if bs.started != nil {
+		bs.started <- struct{}{}
+		<-bs.release
+	}
+
+	bs.mu.Lock()
+	bs.batches = append(bs.batches, len(srs))
+	bs.mu.Unlock()
+
+	for _, sr := range srs {
+		err := bs.Put(ctx, sr)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (bs *batchingStore) numBatches() []int {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	return append([]int(nil), bs.batches...)
+}
+
+func (ts *testServer) postKeyed(t *testing.T) {
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).
+		SetBody("test").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+}
+
+func TestAsyncWrites(t *testing.T) {
+	t.Parallel()
+
+	store := &batchingStore{testStore: newTestStore()}
+
+	ts := newTestServer(t, potency.WithStore(store), potency.WithAsyncWrites(10, 3, time.Hour, potency.OverflowBlock))
+	defer ts.shutdown(t)
+
+	defer func() {
+		require.NoError(t, ts.pot.Shutdown(context.Background()))
+	}()
+
+	for i := 0; i < 3; i++ {
+		ts.postKeyed(t)
+	}
+
+	require.Eventually(t, func() bool { return store.len() == 3 }, time.Second, 5*time.Millisecond)
+	require.Equal(t, []int{3}, store.numBatches())
+}
+
+func TestAsyncWritesInterval(t *testing.T) {
+	t.Parallel()
+
+	store := newTestStore()
+
+	ts := newTestServer(t, potency.WithStore(store), potency.WithAsyncWrites(10, 100, 20*time.Millisecond, potency.OverflowBlock))
+	defer ts.shutdown(t)
+
+	defer func() {
+		require.NoError(t, ts.pot.Shutdown(context.Background()))
+	}()
+
+	ts.postKeyed(t)
+
+	require.Eventually(t, func() bool { return store.len() == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestAsyncWritesShutdown(t *testing.T) {
+	t.Parallel()
+
+	store := newTestStore()
+
+	ts := newTestServer(t, potency.WithStore(store), potency.WithAsyncWrites(10, 100, time.Hour, potency.OverflowBlock))
+	defer ts.shutdown(t)
+
+	ts.postKeyed(t)
+	ts.postKeyed(t)
+
+	require.Equal(t, 0, store.len())
+	require.Equal(t, 2, ts.pot.NumCached())
+
+	require.NoError(t, ts.pot.Shutdown(context.Background()))
+	require.Equal(t, 2, store.len())
+}
+
+func TestAsyncOverflow(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		policy potency.OverflowPolicy
+		stored int
+	}{
+		{potency.OverflowDrop, 2},
+		{potency.OverflowWriteThrough, 3},
+	} {
+		store := &batchingStore{
+			testStore: newTestStore(),
+			started:   make(chan struct{}, 10),
+			release:   make(chan struct{}),
+		}
+
+		ts := newTestServer(t, potency.WithStore(store), potency.WithAsyncWrites(1, 1, time.Hour, test.policy))
+
+		// The first result holds up the writer, the second fills the queue
+		ts.postKeyed(t)
+		<-store.started
+		ts.postKeyed(t)
+		ts.postKeyed(t)
+
+		require.Equal(t, 3, ts.pot.NumCached())
+
+		close(store.release)
+
+		require.NoError(t, ts.pot.Shutdown(context.Background()))
+		require.Equal(t, test.stored, store.len())
+
+		ts.shutdown(t)
+	}
+}
+
+func TestFlushPending(t *testing.T) {
+	t.Parallel()
+
+	store := newTestStore()
+
+	ts := newTestServer(t, potency.WithStore(store), potency.WithAsyncWrites(10, 100, time.Hour, potency.OverflowBlock))
+	defer ts.shutdown(t)
+
+	defer func() {
+		require.NoError(t, ts.pot.Shutdown(context.Background()))
+	}()
+
+	require.NoError(t, ts.pot.FlushPending(context.Background()))
+
+	ts.postKeyed(t)
+	ts.postKeyed(t)
+	require.Equal(t, 0, store.len())
+
+	require.NoError(t, ts.pot.FlushPending(context.Background()))
+	require.Equal(t, 2, store.len())
+}
+
+func TestAsyncReadYourWrites(t *testing.T) {
+	t.Parallel()
+
+	store := newTestStore()
+
+	// Nothing stays in the local cache
+	ts := newTestServer(t, potency.WithStore(store), potency.WithMaxBytes(1), potency.WithAsyncWrites(10, 100, time.Hour, potency.OverflowBlock))
+	defer ts.shutdown(t)
+
+	defer func() {
+		require.NoError(t, ts.pot.Shutdown(context.Background()))
+	}()
+
+	key := uniuri.New()
+
+	post := func() string {
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key)).
+			SetBody("test").
+			Post("")
+		require.NoError(t, err)
+		require.False(t, resp.IsError())
+
+		return resp.String()
+	}
+
+	body := post()
+	require.Equal(t, 0, ts.pot.NumCached())
+	require.Equal(t, 0, store.len())
+	require.Equal(t, body, post())
+
+	require.NoError(t, ts.pot.Invalidate(context.Background(), key))
+	require.NotEqual(t, body, post())
+
+	require.NoError(t, ts.pot.Invalidate(context.Background(), key))
+	require.NoError(t, ts.pot.FlushPending(context.Background()))
+	require.Equal(t, 0, store.len())
+}
@@ -0,0 +1,83 @@
+package potency
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AuditEvent records how one keyed request was handled.
+type AuditEvent struct {
+	Key       string  `json:"key"`
+	Principal string  `json:"principal,omitempty"`
+	Action    Outcome `json:"action"`
+
+	Method    string `json:"method"`
+	URL       string `json:"url"`
+	RequestID string `json:"requestId,omitempty"`
+
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+}
+
+// PrincipalFunc identifies the caller making a request (e.g. user or API key
+// ID), or returns "" if unknown.
+type PrincipalFunc func(*http.Request) string
+
+// WithAuditFunc calls audit synchronously for every keyed request after it is
+// handled.
+func WithAuditFunc(audit func(AuditEvent)) Option {
+	return func(cfg *config) {
+		cfg.audit = audit
+	}
+}
+
+// WithAuditWriter appends every AuditEvent to w as a line of JSON. Write
+// errors are ignored; use WithAuditFunc to handle them.
+func WithAuditWriter(w io.Writer) Option {
+	mu := sync.Mutex{}
+	enc := json.NewEncoder(w)
+
+	return WithAuditFunc(func(ev AuditEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		_ = enc.Encode(&ev)
+	})
+}
+
+// WithPrincipal sets how the caller is identified in audit events.
+func WithPrincipal(principal PrincipalFunc) Option {
+	return func(cfg *config) {
+		cfg.principal = principal
+	}
+}
+
+func (cfg *config) principalOf(r *http.Request) string {
+	if cfg.principal == nil {
+		return ""
+	}
+
+	return cfg.principal(r)
+}
+
+func (cfg *config) auditRequest(r *http.Request, key string, outcome Outcome, started time.Time) {
+	if cfg.audit == nil {
+		return
+	}
+
+	cfg.audit(AuditEvent{
+		Key:       key,
+		Principal: cfg.principalOf(r),
+		Action:    outcome,
+
+		Method:    r.Method,
+		URL:       r.URL.String(),
+		RequestID: cfg.requestID(r),
+
+		Started:  started,
+		Finished: time.Now(),
+	})
+}
@@ -0,0 +1,118 @@
+package potency_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+type syncBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	return sb.buf.Write(p)
+}
+
+func (sb *syncBuffer) events(t *testing.T) []potency.AuditEvent {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	events := []potency.AuditEvent{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(sb.buf.Bytes()))
+	for scanner.Scan() {
+		ev := potency.AuditEvent{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &ev))
+		events = append(events, ev)
+	}
+
+	return events
+}
+
+func TestAuditWriter(t *testing.T) {
+	t.Parallel()
+
+	sb := &syncBuffer{}
+
+	ts := newTestServer(t,
+		potency.WithAuditWriter(sb),
+		potency.WithPrincipal(func(r *http.Request) string { return r.Header.Get("X-User") }),
+	)
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	for _, body := range []string{"test1", "test1", "test2"} {
+		_, err := ts.r().
+			SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+			SetHeader("X-User", "alice").
+			SetHeader("X-Request-Id", "req-1").
+			SetBody(body).
+			Post("")
+		require.NoError(t, err)
+	}
+
+	_, err := ts.r().Post("")
+	require.NoError(t, err)
+
+	// Events are emitted after the response is written
+	require.Eventually(t, func() bool { return len(sb.events(t)) == 3 }, time.Second, 10*time.Millisecond)
+
+	events := sb.events(t)
+
+	require.Equal(t, potency.OutcomeStored, events[0].Action)
+	require.Equal(t, potency.OutcomeReplayed, events[1].Action)
+	require.Equal(t, potency.OutcomeMismatch, events[2].Action)
+
+	for _, ev := range events {
+		require.Equal(t, key1, ev.Key)
+		require.Equal(t, "alice", ev.Principal)
+		require.Equal(t, http.MethodPost, ev.Method)
+		require.Equal(t, "/", ev.URL)
+		require.Equal(t, "req-1", ev.RequestID)
+		require.False(t, ev.Finished.Before(ev.Started))
+	}
+}
+
+func TestAuditFunc(t *testing.T) {
+	t.Parallel()
+
+	mu := sync.Mutex{}
+	actions := []potency.Outcome{}
+
+	ts := newTestServer(t, potency.WithAuditFunc(func(ev potency.AuditEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		actions = append(actions, ev.Action)
+	}))
+	defer ts.shutdown(t)
+
+	ts.storm(t, uniuri.New(), 2)
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return len(actions) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.ElementsMatch(t, []potency.Outcome{potency.OutcomeStored, potency.OutcomeConflict}, actions)
+}
@@ -0,0 +1,52 @@
+package potency
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gopatchy/jsrest"
+)
+
+var ErrReplayForbidden = errors.New("replay forbidden")
+
+// ReplayAuthorizer decides whether r may be served saved, the result cached
+// under its key. A non-nil error refuses the replay; it is sent to the
+// client as 403 unless it carries its own jsrest status.
+type ReplayAuthorizer func(r *http.Request, saved *SavedResult) error
+
+// WithReplayAuthorizer calls authorizer before every replay, before the
+// retry is compared with the saved request, so deployments can confirm that
+// the retry comes from the same principal and not just one holding the same
+// Authorization string. This limits what a leaked token or guessed key can
+// read.
+func WithReplayAuthorizer(authorizer ReplayAuthorizer) Option {
+	return func(cfg *config) {
+		cfg.replayAuthorizer = authorizer
+	}
+}
+
+// SamePrincipal returns a ReplayAuthorizer that only replays results to the
+// principal that created them (see SavedResult.Principal). Results saved
+// without a principal are replayed to anyone.
+func SamePrincipal(principal PrincipalFunc) ReplayAuthorizer {
+	return func(r *http.Request, saved *SavedResult) error {
+		if saved.Principal == "" || principal(r) == saved.Principal {
+			return nil
+		}
+
+		return ErrReplayForbidden
+	}
+}
+
+func (cfg *config) authorizeReplay(r *http.Request, saved *SavedResult) error {
+	if cfg.replayAuthorizer == nil {
+		return nil
+	}
+
+	err := cfg.replayAuthorizer(r, saved)
+	if err != nil {
+		return jsrest.Errorf(jsrest.ErrForbidden, "%w", err)
+	}
+
+	return nil
+}
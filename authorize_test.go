@@ -0,0 +1,93 @@
+package potency_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/jsrest"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayAuthorizer(t *testing.T) {
+	t.Parallel()
+
+	user := func(r *http.Request) string { return r.Header.Get("X-User") }
+
+	ts := newTestServer(t, potency.WithPrincipal(user), potency.WithReplayAuthorizer(potency.SamePrincipal(user)))
+	defer ts.shutdown(t)
+
+	key := uniuri.New()
+
+	post := func(u string) (int, string) {
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", `"`+key+`"`).
+			SetHeader("X-User", u).
+			Post("/")
+		require.NoError(t, err)
+
+		return resp.StatusCode(), resp.String()
+	}
+
+	status, body1 := post("alice")
+	require.Equal(t, http.StatusOK, status)
+
+	status, body2 := post("alice")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, body1, body2)
+
+	status, body := post("mallory")
+	require.Equal(t, http.StatusForbidden, status)
+	require.NotContains(t, body, body1)
+}
+
+func TestReplayAuthorizerStatus(t *testing.T) {
+	t.Parallel()
+
+	called := 0
+
+	ts := newTestServer(t, potency.WithReplayAuthorizer(func(r *http.Request, saved *potency.SavedResult) error {
+		called++
+
+		require.NotEmpty(t, saved.ResponseBody)
+
+		if r.Header.Get("X-Deny") != "" {
+			return jsrest.Errorf(jsrest.ErrUnauthorized, "%w", errors.New("token revoked"))
+		}
+
+		return nil
+	}))
+	defer ts.shutdown(t)
+
+	key := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", `"`+key+`"`).
+		Post("/")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+	require.Zero(t, called)
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", `"`+key+`"`).
+		SetHeader("X-Deny", "1").
+		Post("/")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+	require.Equal(t, 1, called)
+}
+
+func TestSamePrincipal(t *testing.T) {
+	t.Parallel()
+
+	authorize := potency.SamePrincipal(func(r *http.Request) string { return "alice" })
+
+	r, err := http.NewRequest(http.MethodPost, "/", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, authorize(r, &potency.SavedResult{}))
+	require.NoError(t, authorize(r, &potency.SavedResult{Principal: "alice"}))
+	require.ErrorIs(t, authorize(r, &potency.SavedResult{Principal: "bob"}), potency.ErrReplayForbidden)
+}
@@ -0,0 +1,26 @@
+// Package benchmarks holds reproducible performance benchmarks for the
+// potency middleware. It has no API; run it with:
+//
+//	go test -run=^$ -bench=. -benchmem ./benchmarks
+//
+// Requests are served in-process through httptest recorders, so results
+// measure the middleware and not the network. Compare runs with benchstat
+// before and after a change, on the same machine:
+//
+//	go test -run=^$ -bench=. -benchmem -count=10 ./benchmarks > old.txt
+//	go test -run=^$ -bench=. -benchmem -count=10 ./benchmarks > new.txt
+//	benchstat old.txt new.txt
+//
+// Baseline (go1.27, linux/amd64, 1 vCPU Xeon, GOMAXPROCS=1):
+//
+//	BenchmarkPassthrough         2196 ns/op        7512 B/op    22 allocs/op
+//	BenchmarkMiss/1KB           19793 ns/op       45047 B/op    64 allocs/op
+//	BenchmarkMiss/1MB         1374556 ns/op     3189528 B/op    65 allocs/op
+//	BenchmarkHit/1KB             4464 ns/op        8240 B/op    34 allocs/op
+//	BenchmarkHit/1MB           137898 ns/op     1055836 B/op    34 allocs/op
+//	BenchmarkMix/90pct-hits      7276 ns/op       11936 B/op    38 allocs/op
+//	BenchmarkStorm               5306 ns/op        8608 B/op    35 allocs/op
+//
+// Numbers vary by machine; only relative changes between runs on the same
+// machine are meaningful.
+package benchmarks
@@ -0,0 +1,159 @@
+package benchmarks_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gopatchy/potency"
+)
+
+var (
+	requestBody = bytes.Repeat([]byte(`{"amount":100,"currency":"usd"}`), 8)
+
+	sizes = []struct {
+		name string
+		size int
+	}{
+		{"1KB", 1 << 10},
+		{"1MB", 1 << 20},
+	}
+)
+
+func newPotency(responseSize int) *potency.Potency {
+	response := bytes.Repeat([]byte("x"), responseSize)
+
+	return potency.NewPotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(response)
+	}))
+}
+
+func serve(p *potency.Potency, key string) int {
+	req := httptest.NewRequest(http.MethodPost, "/orders", bytes.NewReader(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	if key != "" {
+		req.Header.Set("Idempotency-Key", `"`+key+`"`)
+	}
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+
+	return rec.Code
+}
+
+func BenchmarkPassthrough(b *testing.B) {
+	p := newPotency(1 << 10)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		serve(p, "")
+	}
+}
+
+// BenchmarkMiss executes and saves a new key every iteration.
+func BenchmarkMiss(b *testing.B) {
+	for _, size := range sizes {
+		b.Run(size.name, func(b *testing.B) {
+			p := newPotency(size.size)
+
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				if code := serve(p, strconv.Itoa(i)); code != http.StatusOK {
+					b.Fatalf("status %d", code)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkMissSmall executes and saves new keys with responses small enough
+// for their buffers to be pooled, measuring allocations per request.
+func BenchmarkMissSmall(b *testing.B) {
+	p := newPotency(16 << 10)
+
+	// Warms the pools
+	serve(p, "warm")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if code := serve(p, strconv.Itoa(i)); code != http.StatusOK {
+			b.Fatalf("status %d", code)
+		}
+	}
+}
+
+// BenchmarkHit replays one saved key.
+func BenchmarkHit(b *testing.B) {
+	for _, size := range sizes {
+		b.Run(size.name, func(b *testing.B) {
+			p := newPotency(size.size)
+			serve(p, "hit")
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if code := serve(p, "hit"); code != http.StatusOK {
+					b.Fatalf("status %d", code)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkMix serves 90% replays of 1000 saved keys and 10% new keys from
+// parallel clients.
+func BenchmarkMix(b *testing.B) {
+	b.Run("90pct-hits", func(b *testing.B) {
+		p := newPotency(1 << 10)
+
+		for i := 0; i < 1000; i++ {
+			serve(p, fmt.Sprintf("hit-%d", i))
+		}
+
+		next := int64(0)
+
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				n := atomic.AddInt64(&next, 1)
+
+				if n%10 == 0 {
+					serve(p, fmt.Sprintf("miss-%d", n))
+				} else {
+					serve(p, fmt.Sprintf("hit-%d", n%1000))
+				}
+			}
+		})
+	})
+}
+
+// BenchmarkStorm sends parallel duplicates of the same key, which is
+// replaced every 100 requests: one executes, the rest conflict or replay.
+func BenchmarkStorm(b *testing.B) {
+	p := newPotency(1 << 10)
+
+	next := int64(0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			n := atomic.AddInt64(&next, 1)
+			serve(p, strconv.FormatInt(n/100, 10))
+		}
+	})
+}
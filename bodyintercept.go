@@ -1,30 +1,127 @@
 package potency
 
 import (
-	"crypto/sha256"
+	"bytes"
+	"errors"
 	"hash"
 	"io"
+	"net/http"
+	"sync"
 )
 
 type bodyIntercept struct {
 	source io.ReadCloser
-	sha256 hash.Hash
+	hash   hash.Hash
+	size   int64
+	limit  int64
+	strict bool
+
+	eof      bool
+	closed   bool
+	drainErr error
+}
+
+var bodyInterceptPool = sync.Pool{
+	New: func() any { return &bodyIntercept{} },
 }
 
-func newBodyIntercept(source io.ReadCloser) *bodyIntercept {
-	return &bodyIntercept{
+func newBodyIntercept(source io.ReadCloser, h hash.Hash, limit int64, strict bool) *bodyIntercept {
+	bi := bodyInterceptPool.Get().(*bodyIntercept)
+
+	*bi = bodyIntercept{
 		source: source,
-		sha256: sha256.New(),
+		hash:   h,
+		limit:  limit,
+		strict: strict,
 	}
+
+	return bi
+}
+
+func (bi *bodyIntercept) release() {
+	*bi = bodyIntercept{}
+	bodyInterceptPool.Put(bi)
 }
 
 func (bi *bodyIntercept) Read(p []byte) (int, error) {
 	numBytes, err := bi.source.Read(p)
-	bi.sha256.Write(p[:numBytes])
+	bi.hash.Write(p[:numBytes])
+	bi.size += int64(numBytes)
+
+	if errors.Is(err, io.EOF) {
+		bi.eof = true
+	}
+
+	if bi.strict && bi.overLimit() {
+		return numBytes, ErrBodyTooLarge
+	}
 
 	return numBytes, err
 }
 
+// drain hashes whatever the handler left unread, so the fingerprint covers
+// the whole body. It stops once the body is over the limit, since the
+// response won't be stored anyway.
+func (bi *bodyIntercept) drain() error {
+	if bi.closed {
+		return bi.drainErr
+	}
+
+	if bi.eof {
+		return nil
+	}
+
+	buf := make([]byte, 32*1024)
+
+	for !bi.overLimit() {
+		_, err := bi.Read(buf)
+
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (bi *bodyIntercept) overLimit() bool {
+	return bi.limit > 0 && bi.size > bi.limit
+}
+
+// Close drains the body first, since handlers commonly close it without
+// reading to EOF (e.g. after json.Decoder.Decode).
 func (bi *bodyIntercept) Close() error {
+	bi.drainErr = bi.drain()
+	bi.closed = true
+
 	return bi.source.Close()
 }
+
+// buffer reads up to limit bytes of the body through bi ahead of the
+// handler, so the fingerprint covers them whatever the handler reads, and
+// sets r.GetBody so the handler can read them again. Longer bodies are
+// passed on partly read and can't be re-read.
+func (bi *bodyIntercept) buffer(r *http.Request, limit int64) {
+	data, err := io.ReadAll(io.LimitReader(bi, limit+1))
+
+	if err != nil || int64(len(data)) > limit {
+		r.Body = readCloser{
+			Reader: io.MultiReader(bytes.NewReader(data), bi),
+			Closer: bi,
+		}
+
+		return
+	}
+
+	r.Body = readCloser{
+		Reader: bytes.NewReader(data),
+		Closer: bi,
+	}
+
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+}
@@ -0,0 +1,65 @@
+package potency_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartialBodyRead(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := make([]byte, 4)
+		_, _ = io.ReadFull(r.Body, prefix)
+
+		if r.URL.Path == "/close" {
+			r.Body.Close()
+		}
+
+		_, _ = w.Write([]byte(uniuri.New()))
+	})
+
+	p := potency.NewPotency(handler)
+
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	for _, path := range []string{"/", "/close"} {
+		key := uniuri.New()
+
+		post := func(body string) (int, string) {
+			req, err := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader(body))
+			require.NoError(t, err)
+
+			req.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+			resp, err := srv.Client().Do(req)
+			require.NoError(t, err)
+
+			defer resp.Body.Close()
+
+			data, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			return resp.StatusCode, string(data)
+		}
+
+		status, body1 := post("abcdefgh")
+		require.Equal(t, http.StatusOK, status)
+
+		status, body := post("abcdefgh")
+		require.Equal(t, http.StatusOK, status, path)
+		require.Equal(t, body1, body, path)
+
+		status, body = post("abcdXXXX")
+		require.Equal(t, http.StatusBadRequest, status, path)
+		require.Contains(t, body, potency.ErrBodyMismatch.Error(), path)
+	}
+}
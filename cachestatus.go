@@ -0,0 +1,52 @@
+package potency
+
+import (
+	"net/http"
+)
+
+// CacheStatusHeader reports how a keyed request was handled (see
+// WithCacheStatus).
+const CacheStatusHeader = "X-Idempotency-Cache-Status"
+
+const (
+	// CacheStatusStore means the handler ran and its response is saved
+	// unless it opted out (e.g. Cache-Control: no-store).
+	CacheStatusStore = "store"
+
+	// CacheStatusReplay means a saved response was served.
+	CacheStatusReplay = "replay"
+
+	// CacheStatusBypass means the request skipped idempotency handling
+	// (e.g. streaming or an oversize body).
+	CacheStatusBypass = "bypass"
+
+	// CacheStatusConflict means the key was already executing.
+	CacheStatusConflict = "conflict"
+
+	// CacheStatusReject means the request was refused for another reason
+	// (e.g. a mismatch with the saved request).
+	CacheStatusReject = "reject"
+)
+
+// WithCacheStatus sets CacheStatusHeader on every keyed response, like a CDN
+// cache status, to debug client retry behavior. It exposes cache behavior to
+// clients, so it is best limited to staging.
+func WithCacheStatus() Option {
+	return func(cfg *config) {
+		cfg.cacheStatus = true
+	}
+}
+
+func (cfg *config) setCacheStatus(header http.Header, status string) {
+	if cfg.cacheStatus {
+		header.Set(CacheStatusHeader, status)
+	}
+}
+
+func cacheStatusOf(outcome Outcome) string {
+	if outcome == OutcomeConflict {
+		return CacheStatusConflict
+	}
+
+	return CacheStatusReject
+}
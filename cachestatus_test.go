@@ -0,0 +1,68 @@
+package potency_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheStatus(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithCacheStatus(), potency.WithMaxRequestBodySize(10), potency.WithOversizePolicy(potency.OversizeBypass))
+	defer ts.shutdown(t)
+
+	key := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", `"`+key+`"`).
+		Post("/")
+	require.NoError(t, err)
+	require.Equal(t, potency.CacheStatusStore, resp.Header().Get(potency.CacheStatusHeader))
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", `"`+key+`"`).
+		Post("/")
+	require.NoError(t, err)
+	require.Equal(t, potency.CacheStatusReplay, resp.Header().Get(potency.CacheStatusHeader))
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", `"`+key+`"`).
+		Post("/other")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode())
+	require.Equal(t, potency.CacheStatusReject, resp.Header().Get(potency.CacheStatusHeader))
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", `"`+uniuri.New()+`"`).
+		SetBody(uniuri.NewLen(20)).
+		Post("/")
+	require.NoError(t, err)
+	require.Equal(t, potency.CacheStatusBypass, resp.Header().Get(potency.CacheStatusHeader))
+
+	resps := ts.storm(t, uniuri.New(), 2)
+
+	statuses := []string{resps[0].Header().Get(potency.CacheStatusHeader), resps[1].Header().Get(potency.CacheStatusHeader)}
+	require.ElementsMatch(t, []string{potency.CacheStatusStore, potency.CacheStatusConflict}, statuses)
+
+	// Unkeyed requests aren't labeled
+	resp, err = ts.r().Post("/")
+	require.NoError(t, err)
+	require.Empty(t, resp.Header().Get(potency.CacheStatusHeader))
+}
+
+func TestCacheStatusDisabled(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", `"`+uniuri.New()+`"`).
+		Post("/")
+	require.NoError(t, err)
+	require.Empty(t, resp.Header().Get(potency.CacheStatusHeader))
+}
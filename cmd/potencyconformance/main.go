@@ -0,0 +1,37 @@
+// Command potencyconformance checks an HTTP endpoint against the IETF
+// Idempotency-Key header draft, e.g. a service using potency.WithConformance
+// or another implementation:
+//
+//	potencyconformance -url http://localhost:8080/orders
+//
+// The endpoint must accept POST requests with a JSON body. It exits
+// non-zero and lists the failed checks if there are any.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gopatchy/potency/potencytest"
+)
+
+func main() {
+	url := flag.String("url", "", "URL of the endpoint to check")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout for each request")
+
+	flag.Parse()
+
+	if *url == "" {
+		log.Fatal("-url is required")
+	}
+
+	err := potencytest.Conformance(&http.Client{Timeout: *timeout}, *url)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("PASS")
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gopatchy/potency"
+)
+
+type stats struct {
+	Cached    int    `json:"cached"`
+	StoreSize *int64 `json:"storeSize,omitempty"`
+}
+
+// entryInfo describes a saved result without its body, for incident
+// response.
+type entryInfo struct {
+	Key          string     `json:"key"`
+	Method       string     `json:"method"`
+	URL          string     `json:"url,omitempty"`
+	StatusCode   int        `json:"statusCode"`
+	Added        time.Time  `json:"added"`
+	RequestID    string     `json:"requestId,omitempty"`
+	Principal    string     `json:"principal,omitempty"`
+	ClientIP     string     `json:"clientIp,omitempty"`
+	UserAgent    string     `json:"userAgent,omitempty"`
+	Replays      int64      `json:"replays"`
+	LastReplayed *time.Time `json:"lastReplayed,omitempty"`
+}
+
+func newEntryInfo(sr *potency.SavedResult) *entryInfo {
+	info := &entryInfo{
+		Key:        sr.Key,
+		Method:     sr.Method,
+		URL:        sr.URL,
+		StatusCode: sr.StatusCode,
+		Added:      sr.Added,
+		RequestID:  sr.RequestID,
+		Principal:  sr.Principal,
+		ClientIP:   sr.ClientIP,
+		UserAgent:  sr.UserAgent,
+		Replays:    sr.Replays(),
+	}
+
+	if last := sr.LastReplayed(); !last.IsZero() {
+		info.LastReplayed = &last
+	}
+
+	return info
+}
+
+func newAdmin(p *potency.Potency, m *metrics, reload func() error) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		if !allow(w, r, http.MethodGet) {
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		m.write(w, p.NumCached())
+	})
+
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		if !allow(w, r, http.MethodGet) {
+			return
+		}
+
+		s := &stats{
+			Cached: p.NumCached(),
+		}
+
+		size, err := p.StoreSize(r.Context())
+		switch {
+		case err == nil:
+			s.StoreSize = &size
+		case !errors.Is(err, potency.ErrNotSupported):
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s)
+	})
+
+	mux.HandleFunc("/inprogress", func(w http.ResponseWriter, r *http.Request) {
+		if !allow(w, r, http.MethodGet) {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(p.InProgress())
+	})
+
+	mux.HandleFunc("/export", func(w http.ResponseWriter, r *http.Request) {
+		if !allow(w, r, http.MethodGet) {
+			return
+		}
+
+		_ = p.Export(w)
+	})
+
+	mux.HandleFunc("/compact", func(w http.ResponseWriter, r *http.Request) {
+		if !allow(w, r, http.MethodPost) {
+			return
+		}
+
+		reply(w, p.Compact(r.Context()))
+	})
+
+	mux.HandleFunc("/reload", func(w http.ResponseWriter, r *http.Request) {
+		if !allow(w, r, http.MethodPost) {
+			return
+		}
+
+		reply(w, reload())
+	})
+
+	mux.HandleFunc("/keys/", func(w http.ResponseWriter, r *http.Request) {
+		if !allow(w, r, http.MethodGet, http.MethodDelete) {
+			return
+		}
+
+		key := strings.TrimPrefix(r.URL.Path, "/keys/")
+		if key == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			reply(w, p.Invalidate(r.Context(), key))
+			return
+		}
+
+		sr, err := p.Lookup(r.Context(), key)
+		switch {
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		case sr == nil:
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(newEntryInfo(sr))
+	})
+
+	return mux
+}
+
+func allow(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+	return false
+}
+
+func reply(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, potency.ErrNotSupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
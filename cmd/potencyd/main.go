@@ -0,0 +1,260 @@
+// Command potencyd runs Potency as an idempotency-enforcing reverse proxy in
+// front of an upstream HTTP service, for backends that can't embed the Go
+// middleware.
+//
+// Settings come from a JSON or YAML file (-config) holding potency.Config
+// fields plus the ones below; flags and their environment variables (e.g.
+// POTENCY_UPSTREAM for -upstream) override the file. Set "store" to a DSN
+// such as "file:///var/lib/potencyd" to keep results across restarts.
+//
+// The admin listener serves:
+//
+//	GET    /metrics       counters in the Prometheus text format
+//	GET    /stats         cached entry count and store size as JSON
+//	GET    /inprogress    executing keys as JSON, see potency.InProgress
+//	GET    /export        cached entries, see potency.Export
+//	POST   /compact       compacts the store now
+//	POST   /reload        re-reads the config file (also on SIGHUP)
+//	GET    /keys/{key}    a key's status, provenance and replays as JSON
+//	DELETE /keys/{key}    invalidates a key
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gopatchy/potency"
+	_ "github.com/gopatchy/potency/potencyfile"
+	"gopkg.in/yaml.v3"
+)
+
+type config struct {
+	Listen          string           `json:"listen,omitempty"          yaml:"listen,omitempty"`
+	AdminListen     string           `json:"adminListen,omitempty"     yaml:"adminListen,omitempty"`
+	Upstream        string           `json:"upstream,omitempty"        yaml:"upstream,omitempty"`
+	ShutdownTimeout potency.Duration `json:"shutdownTimeout,omitempty" yaml:"shutdownTimeout,omitempty"`
+
+	potency.Config `yaml:",inline"`
+}
+
+var errConfig = errors.New("invalid configuration")
+
+func main() {
+	path := flag.String("config", env("config", ""), "JSON or YAML config file")
+	listen := flag.String("listen", env("listen", ""), "address to listen on (default :8080)")
+	adminListen := flag.String("admin-listen", env("admin-listen", ""), "address for the admin API and metrics (default 127.0.0.1:9090, \"off\" to disable)")
+	upstream := flag.String("upstream", env("upstream", ""), "URL of the service to proxy to")
+	lifetime := flag.Duration("lifetime", envDuration("lifetime"), "how long results are kept (default 6h)")
+	store := flag.String("store", env("store", ""), "store DSN, e.g. file:///var/lib/potencyd")
+
+	flag.Parse()
+
+	overrides := func(cfg *config) {
+		override(&cfg.Listen, *listen)
+		override(&cfg.AdminListen, *adminListen)
+		override(&cfg.Upstream, *upstream)
+		override(&cfg.Store, *store)
+
+		if *lifetime > 0 {
+			cfg.Lifetime = potency.Duration(*lifetime)
+		}
+	}
+
+	err := run(*path, overrides)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(path string, overrides func(*config)) error {
+	cfg, opts, err := load(path, overrides)
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(cfg.Upstream)
+	if err != nil {
+		return fmt.Errorf("upstream: %s (%w)", err, errConfig)
+	}
+
+	metrics := newMetrics()
+
+	p := potency.NewReverseProxy(u, append(opts, potency.WithMetrics(metrics))...)
+
+	reload := func() error {
+		_, opts, err := load(path, overrides)
+		if err != nil {
+			return err
+		}
+
+		p.Reconfigure(opts...)
+
+		return nil
+	}
+
+	servers := []*http.Server{{
+		Addr:              cfg.Listen,
+		Handler:           p,
+		ReadHeaderTimeout: 10 * time.Second,
+	}}
+
+	if cfg.AdminListen != "off" {
+		servers = append(servers, &http.Server{
+			Addr:              cfg.AdminListen,
+			Handler:           newAdmin(p, metrics, reload),
+			ReadHeaderTimeout: 10 * time.Second,
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	defer signal.Stop(hup)
+
+	errs := make(chan error, len(servers))
+
+	for _, srv := range servers {
+		srv := srv
+
+		go func() {
+			errs <- srv.ListenAndServe()
+		}()
+	}
+
+	log.Printf("proxying %s to %s", cfg.Listen, u)
+
+	for done := false; !done; {
+		select {
+		case err := <-errs:
+			return err
+
+		case <-hup:
+			err := reload()
+			if err != nil {
+				log.Printf("reload: %s", err)
+			}
+
+		case <-ctx.Done():
+			done = true
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+	defer cancel()
+
+	// Stop taking new executions first, so requests already accepted by the
+	// server still finish and get stored.
+	err = p.Shutdown(shutdownCtx)
+	if err != nil {
+		return err
+	}
+
+	for _, srv := range servers {
+		err = srv.Shutdown(shutdownCtx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// load reads the config file (if any), applies overrides and defaults, and
+// converts it to options.
+func load(path string, overrides func(*config)) (*config, []potency.Option, error) {
+	cfg := &config{}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+			err = json.Unmarshal(data, cfg)
+		default:
+			err = yaml.Unmarshal(data, cfg)
+		}
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s (%w)", path, err, errConfig)
+		}
+	}
+
+	overrides(cfg)
+
+	setDefault(&cfg.Listen, ":8080")
+	setDefault(&cfg.AdminListen, "127.0.0.1:9090")
+
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = potency.Duration(30 * time.Second)
+	}
+
+	if cfg.Upstream == "" {
+		return nil, nil, fmt.Errorf("upstream is required (%w)", errConfig)
+	}
+
+	opts, err := potency.FromConfig(cfg.Config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, opts, nil
+}
+
+func override(dst *string, val string) {
+	if val != "" {
+		*dst = val
+	}
+}
+
+func setDefault(dst *string, val string) {
+	if *dst == "" {
+		*dst = val
+	}
+}
+
+// env returns $POTENCY_<NAME>, e.g. POTENCY_ADMIN_LISTEN for
+// "admin-listen", or def if unset.
+func env(name, def string) string {
+	val, found := os.LookupEnv(envName(name))
+	if !found {
+		return def
+	}
+
+	return val
+}
+
+func envDuration(name string) time.Duration {
+	val := env(name, "")
+	if val == "" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		log.Fatalf("%s: %s", envName(name), err)
+	}
+
+	return d
+}
+
+func envName(name string) string {
+	return "POTENCY_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
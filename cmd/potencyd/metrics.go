@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/gopatchy/potency"
+)
+
+// metrics counts requests by method and outcome, and replays. It writes the
+// Prometheus text format itself so the binary doesn't need the client
+// library.
+type metrics struct {
+	mu     sync.Mutex
+	counts map[potency.MetricLabels]uint64
+
+	replays       uint64
+	replayLimited uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		counts: map[potency.MetricLabels]uint64{},
+	}
+}
+
+func (m *metrics) Observe(labels potency.MetricLabels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.counts[labels]++
+
+	switch labels.Outcome {
+	case potency.OutcomeReplayed:
+		m.replays++
+	case potency.OutcomeReplayLimited:
+		m.replayLimited++
+	}
+}
+
+func (m *metrics) write(w io.Writer, cached int) {
+	m.mu.Lock()
+
+	labels := make([]potency.MetricLabels, 0, len(m.counts))
+	for l := range m.counts {
+		labels = append(labels, l)
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].Method != labels[j].Method {
+			return labels[i].Method < labels[j].Method
+		}
+
+		return labels[i].Outcome < labels[j].Outcome
+	})
+
+	counts := make([]uint64, len(labels))
+	for i, l := range labels {
+		counts[i] = m.counts[l]
+	}
+
+	replays := m.replays
+	replayLimited := m.replayLimited
+
+	m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP potency_requests_total Keyed requests by method and outcome.")
+	fmt.Fprintln(w, "# TYPE potency_requests_total counter")
+
+	for i, l := range labels {
+		fmt.Fprintf(w, "potency_requests_total{method=%q,outcome=%q} %d\n", l.Method, l.Outcome, counts[i])
+	}
+
+	fmt.Fprintln(w, "# HELP potency_replays_total Saved responses replayed, or refused for exceeding maxReplays.")
+	fmt.Fprintln(w, "# TYPE potency_replays_total counter")
+	fmt.Fprintf(w, "potency_replays_total{result=\"served\"} %d\n", replays)
+	fmt.Fprintf(w, "potency_replays_total{result=\"limited\"} %d\n", replayLimited)
+
+	fmt.Fprintln(w, "# HELP potency_cached_entries Results in the in-memory cache.")
+	fmt.Fprintln(w, "# TYPE potency_cached_entries gauge")
+	fmt.Fprintf(w, "potency_cached_entries %d\n", cached)
+}
@@ -0,0 +1,93 @@
+package potency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Compactor is implemented by stores that need periodic maintenance, such as
+// embedded databases (bbolt, SQLite) that don't reclaim the space of deleted
+// entries on their own. Compact must only delete results whose keys start
+// with prefix, the caller's namespace (see WithStoreNamespace); prefix is
+// empty when the store isn't shared.
+type Compactor interface {
+	Compact(ctx context.Context, prefix string) error
+}
+
+// Sizer is implemented by stores that can report their on-disk size. Size
+// counts only results whose keys start with prefix, as for Compactor.
+type Sizer interface {
+	Size(ctx context.Context, prefix string) (int64, error)
+}
+
+var ErrNotSupported = errors.New("not supported by store")
+
+// WithCompaction calls the store's Compact method every interval, in the
+// background until Shutdown. Stores that aren't a Compactor are left alone.
+// Scheduled runs discard errors; call Compact directly to observe them.
+func WithCompaction(interval time.Duration) Option {
+	return func(cfg *config) {
+		cfg.compactInterval = interval
+	}
+}
+
+// Compact runs the store's compaction now, bounded by the write timeout. With
+// WithStoreNamespace, only the namespace is compacted.
+func (p *Potency) Compact(ctx context.Context) error {
+	cfg := p.config()
+
+	compactor, ok := cfg.store.(Compactor)
+	if !ok {
+		return fmt.Errorf("compact (%w)", ErrNotSupported)
+	}
+
+	ctx, cancel := withTimeout(ctx, cfg.writeTimeout)
+	defer cancel()
+
+	err := compactor.Compact(ctx, cfg.storePrefix)
+	if err != nil {
+		return fmt.Errorf("compact: %s (%w)", err, ErrStore)
+	}
+
+	return nil
+}
+
+// StoreSize returns the store's on-disk size, bounded by the read timeout.
+// With WithStoreNamespace, only the namespace is counted.
+func (p *Potency) StoreSize(ctx context.Context) (int64, error) {
+	cfg := p.config()
+
+	sizer, ok := cfg.store.(Sizer)
+	if !ok {
+		return 0, fmt.Errorf("size (%w)", ErrNotSupported)
+	}
+
+	ctx, cancel := withTimeout(ctx, cfg.readTimeout)
+	defer cancel()
+
+	size, err := sizer.Size(ctx, cfg.storePrefix)
+	if err != nil {
+		return 0, fmt.Errorf("size: %s (%w)", err, ErrStore)
+	}
+
+	return size, nil
+}
+
+func (p *Potency) compactLoop(interval time.Duration) {
+	defer p.background.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_ = p.Compact(context.Background())
+
+		case <-p.stop:
+			return
+		}
+	}
+}
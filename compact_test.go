@@ -0,0 +1,61 @@
+package potency_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+type compactingStore struct {
+	*testStore
+	compactions int32
+}
+
+func (cs *compactingStore) Compact(ctx context.Context, prefix string) error {
+	atomic.AddInt32(&cs.compactions, 1)
+	return nil
+}
+
+func (cs *compactingStore) Size(ctx context.Context, prefix string) (int64, error) {
+	return 4096, nil
+}
+
+func TestCompaction(t *testing.T) {
+	t.Parallel()
+
+	store := &compactingStore{testStore: newTestStore()}
+
+	ts := newTestServer(t, potency.WithStore(store), potency.WithCompaction(10*time.Millisecond))
+	defer ts.shutdown(t)
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&store.compactions) >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	size, err := ts.pot.StoreSize(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(4096), size)
+
+	require.NoError(t, ts.pot.Shutdown(context.Background()))
+
+	compactions := atomic.LoadInt32(&store.compactions)
+
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, compactions, atomic.LoadInt32(&store.compactions))
+}
+
+func TestCompactNotSupported(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithStore(newTestStore()))
+	defer ts.shutdown(t)
+
+	require.ErrorIs(t, ts.pot.Compact(context.Background()), potency.ErrNotSupported)
+
+	_, err := ts.pot.StoreSize(context.Background())
+	require.ErrorIs(t, err, potency.ErrNotSupported)
+}
@@ -0,0 +1,223 @@
+package potency
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// trainedDictSize is how many bytes of sample bodies make up a trained
+	// dictionary.
+	trainedDictSize = 64 << 10
+
+	// minCompressSize skips bodies too small to gain from compression.
+	minCompressSize = 64
+
+	rawDictID = 1
+)
+
+// ErrCorrupt means a cached body couldn't be decompressed. The entry is
+// evicted rather than replayed.
+var ErrCorrupt = errors.New("cached result corrupt")
+
+// zstdDictMagic starts dictionaries in the zstd format, as produced by
+// "zstd --train".
+var zstdDictMagic = []byte{0x37, 0xa4, 0x30, 0xec}
+
+// WithBodyCompression keeps cached response bodies of mediaType (e.g.
+// "application/json") compressed with zstd in memory. Similar bodies, such
+// as JSON from one API, compress several times better with a dictionary:
+// dict is either one trained with "zstd --train" or raw sample content. If
+// dict is nil, the first 64 KiB of bodies cached are used as one; bodies
+// cached before then are compressed without it. A malformed dictionary
+// disables compression.
+//
+// Bodies are uncompressed for replays and in results returned by Lookup and
+// Export or sent to the store, replicas and peers. Results passed to
+// callbacks such as WithOnEvict, InvalidateWhere and Subscribe have a nil
+// ResponseBody instead. Bodies with a Content-Encoding are left as they are.
+// An entry whose body fails to decompress is evicted (EvictCorrupt) and its
+// key looked up or executed afresh.
+func WithBodyCompression(mediaType string, dict []byte) Option {
+	mediaType = strings.ToLower(mediaType)
+
+	comp := &compressor{}
+
+	comp.codec, _ = newCodec(dict)
+	comp.training = dict == nil
+
+	return func(cfg *config) {
+		compressors := map[string]*compressor{}
+
+		for mt, c := range cfg.compressors {
+			compressors[mt] = c
+		}
+
+		compressors[mediaType] = comp
+		cfg.compressors = compressors
+	}
+}
+
+// compressor compresses bodies of one media type, training a dictionary
+// from the first ones if it wasn't given one.
+type compressor struct {
+	mu       sync.Mutex
+	codec    *codec
+	training bool
+	samples  []byte
+}
+
+// codec is an encoder and decoder sharing one dictionary. Entries keep the
+// codec that compressed them, so they can still be decoded once a trained
+// dictionary replaces it.
+type codec struct {
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+}
+
+func newCodec(dict []byte) (*codec, error) {
+	eopts := []zstd.EOption{}
+	dopts := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+
+	switch {
+	case dict == nil:
+	case bytes.HasPrefix(dict, zstdDictMagic):
+		eopts = append(eopts, zstd.WithEncoderDict(dict))
+		dopts = append(dopts, zstd.WithDecoderDicts(dict))
+	default:
+		eopts = append(eopts, zstd.WithEncoderDictRaw(rawDictID, dict))
+		dopts = append(dopts, zstd.WithDecoderDictRaw(rawDictID, dict))
+	}
+
+	enc, err := zstd.NewWriter(nil, eopts...)
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := zstd.NewReader(nil, dopts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &codec{enc: enc, dec: dec}, nil
+}
+
+// compress returns the codec to use for body, adding body to the samples
+// while training.
+func (comp *compressor) compress(body []byte) (*codec, []byte) {
+	comp.mu.Lock()
+
+	if comp.training {
+		comp.samples = append(comp.samples, body...)
+
+		if len(comp.samples) >= trainedDictSize {
+			// zstd favours recent history, so keep the latest samples
+			dict := comp.samples[len(comp.samples)-trainedDictSize:]
+
+			c, err := newCodec(dict)
+			if err == nil {
+				comp.codec = c
+			}
+
+			comp.training = false
+			comp.samples = nil
+		}
+	}
+
+	c := comp.codec
+
+	comp.mu.Unlock()
+
+	if c == nil {
+		return nil, nil
+	}
+
+	return c, c.enc.EncodeAll(body, nil)
+}
+
+// pack returns a copy of sr with its body compressed, or sr if its body
+// isn't compressed.
+func (p *Potency) pack(sr *SavedResult) *SavedResult {
+	p.cacheMu.RLock()
+	compressors := p.cfg.compressors
+	p.cacheMu.RUnlock()
+
+	if len(compressors) == 0 || sr.codec != nil || len(sr.ResponseBody) < minCompressSize || sr.ResponseHeader.Get("Content-Encoding") != "" {
+		return sr
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(sr.ResponseHeader.Get("Content-Type"))
+
+	comp := compressors[mediaType]
+	if comp == nil {
+		return sr
+	}
+
+	c, packed := comp.compress(sr.ResponseBody)
+	if c == nil || len(packed) >= len(sr.ResponseBody) {
+		return sr
+	}
+
+	ret := *sr
+	ret.ResponseBody = nil
+	ret.packed = packed
+	ret.codec = c
+
+	return &ret
+}
+
+// body returns the response body of sr, decompressing it if needed.
+func (sr *SavedResult) body() ([]byte, error) {
+	if sr.codec == nil {
+		return sr.ResponseBody, nil
+	}
+
+	body, err := sr.codec.dec.DecodeAll(sr.packed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s (%w)", sr.Key, err, ErrCorrupt)
+	}
+
+	return body, nil
+}
+
+// unpackLocked returns sr, or a copy of it with its body decompressed. If
+// that fails, the copy has a nil body. Requires cacheMu.
+func (p *Potency) unpackLocked(sr *SavedResult) (*SavedResult, error) {
+	if sr.codec == nil {
+		return sr, nil
+	}
+
+	body, err := sr.body()
+
+	ret := *sr
+	ret.ResponseBody = body
+	ret.packed = nil
+	ret.codec = nil
+	ret.newer = nil
+
+	return &ret, err
+}
+
+func (p *Potency) unpack(sr *SavedResult) (*SavedResult, error) {
+	p.cacheMu.RLock()
+	defer p.cacheMu.RUnlock()
+
+	return p.unpackLocked(sr)
+}
+
+// dropCorrupt evicts sr, whose body can't be decompressed, so that its key
+// is looked up or executed afresh.
+func (p *Potency) dropCorrupt(sr *SavedResult) {
+	p.cacheMu.Lock()
+	defer p.unlockAndNotify()
+
+	if p.cache[sr.Key] == sr {
+		p.deleteLocked(sr, EvictCorrupt)
+	}
+}
@@ -0,0 +1,83 @@
+package potency_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func jsonOrder(id string) []byte {
+	return []byte(fmt.Sprintf(`{"id":%q,"object":"order","status":"created","currency":"usd","items":[{"sku":"widget-%s","quantity":1,"price":{"amount":1000,"currency":"usd"}}],"customer":{"id":"cus_%s","email":"%s@example.com"},"metadata":{}}`, id, id, id, id))
+}
+
+func TestBodyCompression(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_, _ = w.Write(jsonOrder(r.URL.Query().Get("id")))
+	})
+
+	dict := bytes.Repeat(jsonOrder("sample"), 10)
+
+	sizes := []int64{}
+
+	for _, opts := range [][]potency.Option{
+		nil,
+		{potency.WithBodyCompression("application/json", nil)},
+		{potency.WithBodyCompression("application/json", dict)},
+	} {
+		p := potency.NewPotency(handler, opts...)
+
+		post := func(key string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/?id="+key, nil)
+			req.Header.Set("Idempotency-Key", fmt.Sprintf(`"%s"`, key))
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, req)
+
+			return rec
+		}
+
+		keys := []string{}
+
+		for i := 0; i < 500; i++ {
+			key := uniuri.New()
+			keys = append(keys, key)
+
+			rec := post(key)
+			require.Equal(t, http.StatusOK, rec.Code)
+			require.Equal(t, jsonOrder(key), rec.Body.Bytes())
+		}
+
+		sizes = append(sizes, p.SizeBytes())
+
+		for _, key := range []string{keys[0], keys[499]} {
+			rec := post(key)
+			require.Equal(t, http.StatusOK, rec.Code)
+			require.Equal(t, jsonOrder(key), rec.Body.Bytes())
+			require.NotEmpty(t, rec.Header().Get(potency.ReplayedHeader))
+
+			sr := mustLookup(t, p, key)
+			require.Equal(t, jsonOrder(key), sr.ResponseBody)
+		}
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, p.Export(buf))
+		require.Contains(t, buf.String(), keys[0])
+
+		require.NoError(t, p.Shutdown(context.Background()))
+	}
+
+	// Until it has trained, the dictionary-less compressor gains little on
+	// bodies this small.
+	bodyBytes := int64(500 * len(jsonOrder(uniuri.New())))
+	require.Greater(t, sizes[0]-sizes[1], bodyBytes/4)
+	require.Greater(t, sizes[0]-sizes[2], bodyBytes/2)
+}
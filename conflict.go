@@ -0,0 +1,153 @@
+package potency
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gopatchy/jsrest"
+)
+
+type ConflictPolicy int
+
+const (
+	// ConflictError rejects a duplicate of an in-progress request with the
+	// conflict status (see WithConflictStatus).
+	ConflictError ConflictPolicy = iota
+
+	// ConflictWait blocks a duplicate until the original finishes, then
+	// replays its result.
+	ConflictWait
+
+	// ConflictProxy forwards keyed requests to the peer that owns the key
+	// (see SetPeerPicker). Requests the instance doesn't forward, because it
+	// owns the key or they were forwarded to it, are handled as in
+	// ConflictWait.
+	ConflictProxy
+)
+
+const forwardedHeader = "Potency-Forwarded"
+
+func (p *Potency) SetConflictPolicy(policy ConflictPolicy) {
+	p.SetConflictPolicyFunc(func(*http.Request) ConflictPolicy { return policy })
+}
+
+// SetConflictPolicyFunc chooses the policy per request. The request is nil
+// for calls to Do.
+func (p *Potency) SetConflictPolicyFunc(policyFunc func(*http.Request) ConflictPolicy) {
+	p.cacheMu.Lock()
+	defer p.cacheMu.Unlock()
+
+	p.conflictPolicyFunc = policyFunc
+}
+
+// WithConflictPolicy sets the conflict policy in the configuration, where it
+// takes precedence over SetConflictPolicy and SetConflictPolicyFunc. It is
+// mostly useful with WithMethodOptions.
+func WithConflictPolicy(policy ConflictPolicy) Option {
+	return func(cfg *config) {
+		cfg.conflictPolicy = func(*http.Request) ConflictPolicy { return policy }
+	}
+}
+
+func (p *Potency) conflictPolicy(r *http.Request, cfg config) ConflictPolicy {
+	if cfg.conflictPolicy != nil {
+		return cfg.conflictPolicy(r)
+	}
+
+	p.cacheMu.RLock()
+	policyFunc := p.conflictPolicyFunc
+	p.cacheMu.RUnlock()
+
+	if policyFunc == nil {
+		return ConflictError
+	}
+
+	return policyFunc(r)
+}
+
+func (p *Potency) forwardToPeer(w http.ResponseWriter, r *http.Request, key string) bool {
+	if r.Header.Get(forwardedHeader) != "" {
+		return false
+	}
+
+	p.cacheMu.RLock()
+	picker := p.peerPicker
+	p.cacheMu.RUnlock()
+
+	if picker == nil {
+		return false
+	}
+
+	peer, ok := picker.PickPeer(key)
+	if !ok {
+		return false
+	}
+
+	fwd, ok := peer.(Forwarder)
+	if !ok {
+		return false
+	}
+
+	r.Header.Set(forwardedHeader, p.instanceID)
+	fwd.Forward(w, r)
+
+	return true
+}
+
+// ErrorWriter writes an error response with the given status.
+type ErrorWriter func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+// WithConflictStatus sets the status returned when a key is already
+// executing (default 409; 425 Too Early is a common alternative).
+func WithConflictStatus(status int) Option {
+	return func(cfg *config) {
+		cfg.conflictStatus = status
+	}
+}
+
+// WithConflictErrorWriter replaces the body written when a key is already
+// executing, e.g. to add a machine-readable code. Mismatch and other errors
+// are unaffected; see WithErrorWriter.
+func WithConflictErrorWriter(writer ErrorWriter) Option {
+	return func(cfg *config) {
+		cfg.conflictErrorWriter = writer
+	}
+}
+
+func (cfg *config) conflictError() *jsrest.HTTPError {
+	return jsrest.NewHTTPError(cfg.conflictStatus)
+}
+
+// WithMaxWait limits how long ConflictWait blocks a duplicate request. When
+// the original is still running after d, the duplicate gets the conflict
+// status with a Retry-After header. Zero (the default) waits until the
+// request context is done.
+func WithMaxWait(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.maxWait = d
+	}
+}
+
+// WithWaitWhileSending makes duplicates that arrive while the original is
+// sending its response wait for it and replay the saved result, even under
+// ConflictError. Until the handler commits its status and headers, or for
+// streaming responses, duplicates still get the conflict status. As with
+// ConflictWait, a duplicate executes after all if the response isn't saved
+// (e.g. no-store).
+func WithWaitWhileSending() Option {
+	return func(cfg *config) {
+		cfg.waitWhileSending = true
+	}
+}
+
+// retryAfter formats d as Retry-After delay-seconds, rounding up to at least
+// one second.
+func retryAfter(d time.Duration) string {
+	secs := int64((d + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+
+	return strconv.FormatInt(secs, 10)
+}
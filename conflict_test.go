@@ -0,0 +1,321 @@
+package potency_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/go-resty/resty/v2"
+	"github.com/gopatchy/potency"
+	"github.com/gopatchy/potency/potencyclient"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConflictError(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	resps := ts.storm(t, uniuri.New(), 2)
+
+	statuses := []int{resps[0].StatusCode(), resps[1].StatusCode()}
+	require.ElementsMatch(t, []int{http.StatusOK, http.StatusConflict}, statuses)
+}
+
+func TestConflictStatus(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithConflictStatus(http.StatusTooEarly))
+	defer ts.shutdown(t)
+
+	resps := ts.storm(t, uniuri.New(), 2)
+
+	statuses := []int{resps[0].StatusCode(), resps[1].StatusCode()}
+	require.ElementsMatch(t, []int{http.StatusOK, http.StatusTooEarly}, statuses)
+
+	for _, resp := range resps {
+		if resp.StatusCode() == http.StatusTooEarly {
+			require.Equal(t, potencyclient.InProgress, potencyclient.CheckResty(resp))
+		}
+	}
+}
+
+func TestConflictErrorWriter(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithConflictErrorWriter(func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		require.ErrorIs(t, err, potency.ErrConflict)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"error":{"code":"IN_PROGRESS"}}`))
+	}))
+	defer ts.shutdown(t)
+
+	resps := ts.storm(t, uniuri.New(), 2)
+
+	bodies := []string{}
+
+	for _, resp := range resps {
+		if resp.StatusCode() == http.StatusConflict {
+			bodies = append(bodies, resp.String())
+		}
+	}
+
+	require.Equal(t, []string{`{"error":{"code":"IN_PROGRESS"}}`}, bodies)
+
+	// Mismatches still use the default writer
+	key1 := uniuri.New()
+
+	for _, body := range []string{"test1", "test2"} {
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+			SetBody(body).
+			Post("")
+		require.NoError(t, err)
+
+		if body == "test2" {
+			require.Equal(t, potencyclient.Mismatch, potencyclient.CheckResty(resp))
+		}
+	}
+}
+
+func TestConflictWait(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	ts.pot.SetConflictPolicy(potency.ConflictWait)
+
+	resps := ts.storm(t, uniuri.New(), 3)
+
+	for _, resp := range resps {
+		require.Equal(t, http.StatusOK, resp.StatusCode())
+		require.Equal(t, resps[0].String(), resp.String())
+	}
+}
+
+func TestConflictWaitMax(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithMaxWait(50*time.Millisecond))
+	defer ts.shutdown(t)
+
+	ts.pot.SetConflictPolicy(potency.ConflictWait)
+
+	resps := ts.storm(t, uniuri.New(), 2)
+
+	statuses := []int{resps[0].StatusCode(), resps[1].StatusCode()}
+	require.ElementsMatch(t, []int{http.StatusOK, http.StatusConflict}, statuses)
+
+	for _, resp := range resps {
+		if resp.StatusCode() == http.StatusConflict {
+			require.Equal(t, "1", resp.Header().Get("Retry-After"))
+			require.Equal(t, potencyclient.InProgress, potencyclient.CheckResty(resp))
+		}
+	}
+}
+
+func TestConflictProxy(t *testing.T) {
+	t.Parallel()
+
+	ts1 := newTestServer(t)
+	defer ts1.shutdown(t)
+
+	ts2 := newTestServer(t)
+	defer ts2.shutdown(t)
+
+	for _, ts := range []*testServer{ts1, ts2} {
+		ts.pot.SetPeerPicker(newTestPool(ts, ts1, ts2))
+		ts.pot.SetConflictPolicy(potency.ConflictProxy)
+	}
+
+	key1 := uniuri.New()
+
+	resp, err := ts1.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	resp, err = ts2.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, resp1, resp.String())
+
+	require.Equal(t, 1, ts1.pot.NumCached()+ts2.pot.NumCached())
+}
+
+func (ts *testServer) storm(t *testing.T, key string, n int) []*resty.Response {
+	resps := make([]*resty.Response, n)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			resp, err := ts.r().
+				SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key)).
+				Post("slow")
+			require.NoError(t, err)
+
+			resps[i] = resp
+		}(i)
+	}
+
+	wg.Wait()
+
+	return resps
+}
+
+func TestWaitWhileSending(t *testing.T) {
+	t.Parallel()
+
+	for _, wait := range []bool{false, true} {
+		committed := make(chan struct{})
+		release := make(chan struct{})
+
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(uniuri.New()))
+			w.(http.Flusher).Flush()
+
+			close(committed)
+			<-release
+
+			_, _ = w.Write([]byte(uniuri.New()))
+		})
+
+		opts := []potency.Option{}
+		if wait {
+			opts = append(opts, potency.WithWaitWhileSending())
+		}
+
+		srv := httptest.NewServer(potency.NewPotency(handler, opts...))
+
+		key := uniuri.New()
+
+		post := func() (int, string) {
+			req, err := http.NewRequest(http.MethodPost, srv.URL, nil)
+			require.NoError(t, err)
+
+			req.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+			resp, err := srv.Client().Do(req)
+			require.NoError(t, err)
+
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			return resp.StatusCode, string(body)
+		}
+
+		type result struct {
+			status int
+			body   string
+		}
+
+		first := make(chan result)
+
+		go func() {
+			status, body := post()
+			first <- result{status, body}
+		}()
+
+		<-committed
+
+		if !wait {
+			status, _ := post()
+			require.Equal(t, http.StatusConflict, status)
+
+			close(release)
+			require.Equal(t, http.StatusCreated, (<-first).status)
+			srv.Close()
+
+			continue
+		}
+
+		second := make(chan result)
+
+		go func() {
+			status, body := post()
+			second <- result{status, body}
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+
+		res1 := <-first
+		res2 := <-second
+
+		require.Equal(t, http.StatusCreated, res1.status)
+		require.Equal(t, http.StatusCreated, res2.status)
+		require.Equal(t, res1.body, res2.body)
+
+		srv.Close()
+	}
+}
+
+func TestConflictProxyConcurrent(t *testing.T) {
+	t.Parallel()
+
+	ts1 := newTestServer(t)
+	defer ts1.shutdown(t)
+
+	ts2 := newTestServer(t)
+	defer ts2.shutdown(t)
+
+	for _, ts := range []*testServer{ts1, ts2} {
+		ts.pot.SetPeerPicker(newTestPool(ts, ts1, ts2))
+		ts.pot.SetConflictPolicy(potency.ConflictProxy)
+	}
+
+	key := uniuri.New()
+	resps := make([]*resty.Response, 6)
+	wg := sync.WaitGroup{}
+
+	// Duplicates arrive at both instances, local to the owner and forwarded
+	// to it, while the first is still executing
+	for i := range resps {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			ts := []*testServer{ts1, ts2}[i%2]
+
+			resp, err := ts.r().
+				SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key)).
+				Post("slow")
+			require.NoError(t, err)
+
+			resps[i] = resp
+		}(i)
+	}
+
+	wg.Wait()
+
+	for _, resp := range resps {
+		require.Equal(t, http.StatusOK, resp.StatusCode())
+		require.Equal(t, resps[0].String(), resp.String())
+	}
+
+	require.Equal(t, 1, ts1.pot.NumCached()+ts2.pot.NumCached())
+}
@@ -0,0 +1,89 @@
+package potency
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gopatchy/jsrest"
+)
+
+var ErrMissingKey = errors.New("missing Idempotency-Key")
+
+// Problem is the application/problem+json (RFC 9457) body of error
+// responses in conformance mode.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// WithConformance strictly follows the IETF Idempotency-Key header draft
+// (draft-ietf-httpapi-idempotency-key-header):
+//
+//   - POST and PATCH requests without a key get 400
+//   - keys must be Structured Field strings (RFC 8941), optionally with
+//     parameters
+//   - a key reused with a different request gets 422
+//   - a duplicate of an in-progress request gets 409
+//   - errors are Problem documents with the draft's titles and problemType
+//     as their type ("about:blank" if empty)
+//
+// WithErrorWriter and WithConflictErrorWriter still take precedence, and a
+// key extractor set after WithConformance replaces its key parsing.
+func WithConformance(problemType string) Option {
+	if problemType == "" {
+		problemType = "about:blank"
+	}
+
+	return func(cfg *config) {
+		cfg.conformance = true
+		cfg.problemType = problemType
+		cfg.keyExtractor = sfStringKeyHeader
+	}
+}
+
+// requiresKey reports whether conformance mode rejects requests of method
+// without a key.
+func requiresKey(method string) bool {
+	return method == http.MethodPost || method == http.MethodPatch
+}
+
+func sfStringKeyHeader(r *http.Request) (string, error) {
+	return parseKeyHeader(r, true)
+}
+
+// problem returns the draft's status and title for err.
+func problem(status int, err error) (int, string) {
+	switch {
+	case errors.Is(err, ErrMissingKey):
+		return http.StatusBadRequest, "Idempotency-Key is missing"
+	case errors.Is(err, ErrInvalidKey):
+		return http.StatusBadRequest, "Idempotency-Key is invalid"
+	case errors.Is(err, ErrMismatch):
+		return http.StatusUnprocessableEntity, "Idempotency-Key is already used"
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict, "A request is outstanding for this Idempotency-Key"
+	default:
+		return status, http.StatusText(status)
+	}
+}
+
+func (cfg *config) writeProblem(w http.ResponseWriter, status int, err error) {
+	status, title := problem(status, err)
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(&Problem{
+		Type:   cfg.problemType,
+		Title:  title,
+		Status: status,
+		Detail: err.Error(),
+	})
+}
+
+func missingKeyError(r *http.Request) error {
+	return jsrest.Errorf(jsrest.ErrBadRequest, "%s %s (%w)", r.Method, r.URL.Path, ErrMissingKey)
+}
@@ -0,0 +1,79 @@
+package potency_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithConformance("https://example.com/problems/idempotency"))
+	defer ts.shutdown(t)
+
+	problem := func(status int, resp []byte) *potency.Problem {
+		p := &potency.Problem{}
+		require.NoError(t, json.Unmarshal(resp, p))
+		require.Equal(t, "https://example.com/problems/idempotency", p.Type)
+		require.Equal(t, status, p.Status)
+
+		return p
+	}
+
+	resp, err := ts.r().Post("/")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode())
+	require.Equal(t, "application/problem+json", resp.Header().Get("Content-Type"))
+	require.Equal(t, "Idempotency-Key is missing", problem(http.StatusBadRequest, resp.Body()).Title)
+
+	// Keys aren't required for other methods
+	resp, err = ts.r().Put("/")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", `"a\"b`).
+		Post("/")
+	require.NoError(t, err)
+	require.Equal(t, "Idempotency-Key is invalid", problem(http.StatusBadRequest, resp.Body()).Title)
+
+	key := `"` + uniuri.New() + `\\"`
+
+	resp1, err := ts.r().
+		SetHeader("Idempotency-Key", key).
+		SetBody("one").
+		Post("/")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp1.StatusCode())
+
+	resp2, err := ts.r().
+		SetHeader("Idempotency-Key", key).
+		SetBody("one").
+		Post("/")
+	require.NoError(t, err)
+	require.Equal(t, resp1.Body(), resp2.Body())
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", key).
+		SetBody("two").
+		Post("/")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode())
+	require.Equal(t, "Idempotency-Key is already used", problem(http.StatusUnprocessableEntity, resp.Body()).Title)
+
+	resps := ts.storm(t, uniuri.New(), 2)
+
+	statuses := []int{resps[0].StatusCode(), resps[1].StatusCode()}
+	require.ElementsMatch(t, []int{http.StatusOK, http.StatusConflict}, statuses)
+
+	for _, resp := range resps {
+		if resp.StatusCode() == http.StatusConflict {
+			require.Equal(t, "A request is outstanding for this Idempotency-Key", problem(http.StatusConflict, resp.Body()).Title)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package potency_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentLength(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		// Flushing before the handler returns forces chunked encoding
+		_, _ = w.Write([]byte("hello "))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("world"))
+	}))
+
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	do := func(path, key string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+path, nil)
+		require.NoError(t, err)
+
+		req.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+		resp, err := srv.Client().Do(req)
+		require.NoError(t, err)
+
+		resp.Body.Close()
+
+		return resp
+	}
+
+	key1 := uniuri.New()
+
+	resp := do("/", key1)
+	require.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	require.Equal(t, int64(-1), resp.ContentLength)
+
+	resp = do("/", key1)
+	require.Equal(t, "true", resp.Header.Get(potency.ReplayedHeader))
+	require.Empty(t, resp.TransferEncoding)
+	require.Equal(t, int64(len("hello world")), resp.ContentLength)
+
+	key2 := uniuri.New()
+
+	do("/empty", key2)
+
+	resp = do("/empty", key2)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Equal(t, "true", resp.Header.Get(potency.ReplayedHeader))
+	require.Empty(t, resp.Header.Get("Content-Length"))
+}
@@ -0,0 +1,115 @@
+package potency
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gopatchy/jsrest"
+)
+
+// WithIdentityDigest saves a single hash of the URL and identity headers
+// (using the WithHash function) in SavedResult.RequestDigest instead of the
+// fields themselves, shrinking entries with long URLs or tokens. Mismatches
+// are then reported without saying what differs; keepFields saves the fields
+// too, for diagnostics while debugging. Entries saved before enabling it are
+// still compared field by field.
+func WithIdentityDigest(keepFields bool) Option {
+	return func(cfg *config) {
+		cfg.identityDigest = true
+		cfg.identityDigestFields = keepFields
+	}
+}
+
+// requestDigest hashes url and the non-empty values of header, with header
+// names sorted so map order doesn't matter.
+func (cfg *config) requestDigest(url string, header http.Header) []byte {
+	h := cfg.newHash()
+
+	h.Write([]byte(url))
+	h.Write([]byte{0})
+
+	names := make([]string, 0, len(header))
+
+	for name := range header {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		// Absent and empty headers are equal, as in headerMismatch
+		val := strings.Join(header.Values(name), ",")
+		if val == "" {
+			continue
+		}
+
+		h.Write([]byte(name))
+		h.Write([]byte{':'})
+		h.Write([]byte(val))
+		h.Write([]byte{0})
+	}
+
+	return h.Sum(nil)
+}
+
+// identify records everything but the body of r in sr, for checkIdentity,
+// along with the request ID, principal and provenance.
+func (cfg *config) identify(r *http.Request, sr *SavedResult) {
+	sr.Method = r.Method
+	sr.RequestID = cfg.requestID(r)
+	sr.Principal = cfg.principalOf(r)
+
+	cfg.recordProvenance(r, sr)
+
+	u := cfg.requestURL(r)
+	header := cfg.identityHeader(r)
+
+	if cfg.identityDigest {
+		sr.RequestDigest = cfg.requestDigest(u, header)
+	}
+
+	if !cfg.identityDigest || cfg.identityDigestFields {
+		sr.URL = u
+		sr.RequestHeader = header
+	}
+}
+
+// checkIdentity compares everything but the body of r to saved.
+func (cfg *config) checkIdentity(r *http.Request, saved *SavedResult) error {
+	if r.Method != saved.Method {
+		return jsrest.SilentJoin(&MismatchError{Field: "method", Got: r.Method, Want: saved.Method}, jsrest.ErrBadRequest)
+	}
+
+	u := cfg.requestURL(r)
+	header := cfg.identityHeader(r)
+
+	if saved.RequestDigest != nil {
+		digest := cfg.requestDigest(u, header)
+		if bytes.Equal(digest, saved.RequestDigest) {
+			return nil
+		}
+
+		if saved.URL == "" {
+			return jsrest.SilentJoin(&MismatchError{Field: "identity", Got: hex.EncodeToString(digest), Want: hex.EncodeToString(saved.RequestDigest)}, jsrest.ErrBadRequest)
+		}
+	}
+
+	if u != saved.URL {
+		return jsrest.SilentJoin(&MismatchError{Field: "URL", Got: u, Want: saved.URL}, jsrest.ErrBadRequest)
+	}
+
+	if h := headerMismatch(saved.RequestHeader, header); h != "" {
+		return jsrest.SilentJoin(&MismatchError{Field: h, Got: r.Header.Get(h), Want: saved.RequestHeader.Get(h)}, jsrest.ErrBadRequest)
+	}
+
+	if saved.RequestDigest != nil {
+		// The fields match but the digest doesn't, e.g. after WithHash
+		// changed
+		return jsrest.SilentJoin(&MismatchError{Field: "identity", Got: hex.EncodeToString(cfg.requestDigest(u, header)), Want: hex.EncodeToString(saved.RequestDigest)}, jsrest.ErrBadRequest)
+	}
+
+	return nil
+}
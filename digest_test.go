@@ -0,0 +1,102 @@
+package potency_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentityDigest(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithIdentityDigest(false))
+	defer ts.shutdown(t)
+
+	key := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key)).
+		SetHeader("Accept", "text/plain").
+		SetBody("test").
+		Post("x")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	sr := mustLookup(t, ts.pot, key)
+	require.NotNil(t, sr)
+	require.Equal(t, http.MethodPost, sr.Method)
+	require.Empty(t, sr.URL)
+	require.Nil(t, sr.RequestHeader)
+	require.NotEmpty(t, sr.RequestDigest)
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key)).
+		SetHeader("Accept", "text/plain").
+		SetBody("test").
+		Post("x")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, resp1, resp.String())
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key)).
+		SetHeader("Accept", "application/json").
+		SetBody("test").
+		Post("x")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode())
+	require.Contains(t, resp.String(), potency.ErrIdentityMismatch.Error())
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key)).
+		SetHeader("Accept", "text/plain").
+		SetBody("test").
+		Post("y")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode())
+	require.Contains(t, resp.String(), potency.ErrIdentityMismatch.Error())
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key)).
+		SetHeader("Accept", "text/plain").
+		SetBody("test").
+		Put("x")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode())
+	require.Contains(t, resp.String(), potency.ErrMethodMismatch.Error())
+}
+
+func TestIdentityDigestKeepFields(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithIdentityDigest(true))
+	defer ts.shutdown(t)
+
+	key := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key)).
+		SetBody("test").
+		Post("x")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	sr := mustLookup(t, ts.pot, key)
+	require.NotNil(t, sr)
+	require.NotEmpty(t, sr.URL)
+	require.NotEmpty(t, sr.RequestDigest)
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key)).
+		SetBody("test").
+		Post("y")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode())
+	require.Contains(t, resp.String(), potency.ErrURLMismatch.Error())
+}
@@ -0,0 +1,97 @@
+package potency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Result is the outcome of an operation run through Do.
+type Result struct {
+	Value []byte
+}
+
+const doMethod = "DO"
+
+// Do runs fn at most once per key across the lifetime of its saved result,
+// for callers outside HTTP such as background workers and queue consumers.
+// It returns the saved result and true if fn already ran. Errors from fn are
+// returned without being saved, so the operation may be retried. ErrStore
+// after fn succeeded means the result is cached locally only.
+//
+// A concurrent Do for the same key returns ErrConflict unless the conflict
+// policy (called with a nil request) is ConflictWait or ConflictProxy, in
+// which case it waits for the first to finish or ctx to be done.
+func (p *Potency) Do(ctx context.Context, key string, fn func(context.Context) (Result, error)) (Result, bool, error) {
+	cfg := p.config().forMethod(doMethod)
+	policy := p.conflictPolicy(nil, cfg)
+
+	for {
+		saved, err := p.lookup(ctx, key, cfg)
+		if err != nil {
+			return Result{}, false, err
+		}
+
+		if saved != nil {
+			if saved.Method != doMethod {
+				return Result{}, false, fmt.Errorf("%s (%w)", saved.Method, ErrMethodMismatch)
+			}
+
+			body, err := saved.body()
+			if err != nil {
+				p.dropCorrupt(saved)
+				continue
+			}
+
+			if !p.countReplay(saved, cfg.maxReplays) {
+				return Result{}, false, fmt.Errorf("%s: %d (%w)", key, cfg.maxReplays, ErrTooManyReplays)
+			}
+
+			return Result{Value: body}, true, nil
+		}
+
+		err = p.checkTombstone(nil, key, cfg)
+		if err != nil {
+			return Result{}, false, err
+		}
+
+		exec, raced, err := p.lockMissing(key, execSummary{method: doMethod}, cfg.lease)
+		if raced {
+			continue
+		}
+
+		if err == nil {
+			defer p.unlockKey(key, exec)
+
+			fnCtx, cancel := exec.context(ctx)
+			defer cancel()
+
+			res, err := fn(fnCtx)
+			if err != nil {
+				return Result{}, false, err
+			}
+
+			if !exec.owned() {
+				return res, false, fmt.Errorf("%s (%w)", key, ErrLeaseLost)
+			}
+
+			err = p.write(ctx, &SavedResult{
+				Key:          key,
+				Method:       doMethod,
+				ResponseBody: res.Value,
+			}, cfg)
+
+			return res, false, err
+		}
+
+		if errors.Is(err, ErrShuttingDown) || policy == ConflictError {
+			return Result{}, false, err
+		}
+
+		select {
+		case <-exec.done:
+		case <-ctx.Done():
+			return Result{}, false, &InProgressError{Key: key, Since: exec.started, cause: ctx.Err()}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package potency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDo(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler())
+
+	key1 := uniuri.New()
+	calls := 0
+
+	fn := func(context.Context) (potency.Result, error) {
+		calls++
+		return potency.Result{Value: []byte(uniuri.New())}, nil
+	}
+
+	res1, replayed, err := p.Do(context.Background(), key1, fn)
+	require.NoError(t, err)
+	require.False(t, replayed)
+
+	res2, replayed, err := p.Do(context.Background(), key1, fn)
+	require.NoError(t, err)
+	require.True(t, replayed)
+	require.Equal(t, res1, res2)
+	require.Equal(t, 1, calls)
+
+	errFail := errors.New("fail")
+
+	key2 := uniuri.New()
+
+	_, _, err = p.Do(context.Background(), key2, func(context.Context) (potency.Result, error) {
+		return potency.Result{}, errFail
+	})
+	require.ErrorIs(t, err, errFail)
+
+	_, replayed, err = p.Do(context.Background(), key2, fn)
+	require.NoError(t, err)
+	require.False(t, replayed)
+	require.Equal(t, 2, calls)
+}
+
+func TestDoMismatch(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	_, _, err = ts.pot.Do(context.Background(), key1, func(context.Context) (potency.Result, error) {
+		return potency.Result{}, nil
+	})
+	require.ErrorIs(t, err, potency.ErrMismatch)
+}
+
+func TestDoWait(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler())
+	p.SetConflictPolicy(potency.ConflictWait)
+
+	key1 := uniuri.New()
+	calls := int32(0)
+
+	fn := func(context.Context) (potency.Result, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+
+		return potency.Result{Value: []byte(uniuri.New())}, nil
+	}
+
+	results := make([]potency.Result, 3)
+	wg := sync.WaitGroup{}
+
+	for i := range results {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			res, _, err := p.Do(context.Background(), key1, fn)
+			require.NoError(t, err)
+
+			results[i] = res
+		}(i)
+	}
+
+	wg.Wait()
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	require.Equal(t, results[0], results[1])
+	require.Equal(t, results[0], results[2])
+}
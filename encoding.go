@@ -0,0 +1,78 @@
+package potency
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// negotiateEncoding returns the body and header to replay saved with. A
+// gzip-encoded body is decoded for clients that don't accept gzip; other
+// encodings are replayed as stored. It returns ErrCorrupt if a compressed
+// body can't be decoded (see WithBodyCompression).
+func negotiateEncoding(r *http.Request, saved *SavedResult, cfg config) ([]byte, http.Header, error) {
+	encoding := strings.ToLower(strings.TrimSpace(saved.ResponseHeader.Get("Content-Encoding")))
+
+	if (encoding != "gzip" && encoding != "x-gzip") || acceptsEncoding(r, "gzip") || len(saved.ResponseBody) == 0 {
+		body, err := saved.body()
+		return body, saved.ResponseHeader, err
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(saved.ResponseBody))
+	if err != nil {
+		return saved.ResponseBody, saved.ResponseHeader, nil
+	}
+
+	body, err := io.ReadAll(gz)
+	if err != nil {
+		return saved.ResponseBody, saved.ResponseHeader, nil
+	}
+
+	header := saved.ResponseHeader.Clone()
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+
+	if header.Get("ETag") != "" {
+		header.Set("ETag", newETag(cfg.newHash(), body))
+	}
+
+	return body, header, nil
+}
+
+// acceptsEncoding reports whether r's Accept-Encoding allows coding. A
+// missing header is treated as identity only.
+func acceptsEncoding(r *http.Request, coding string) bool {
+	for _, ae := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(ae, ",") {
+			name, params, _ := strings.Cut(part, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+
+			if name != coding && name != "*" {
+				continue
+			}
+
+			return qvalue(params) > 0
+		}
+	}
+
+	return false
+}
+
+func qvalue(params string) float64 {
+	for _, param := range strings.Split(params, ";") {
+		k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if strings.EqualFold(k, "q") {
+			q, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return 0
+			}
+
+			return q
+		}
+	}
+
+	return 1
+}
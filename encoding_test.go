@@ -0,0 +1,79 @@
+package potency_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentEncoding(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Vary", "Accept-Encoding")
+
+		gz := gzip.NewWriter(w)
+		_, _ = gz.Write([]byte("hello world"))
+		_ = gz.Close()
+	}))
+
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	defer client.CloseIdleConnections()
+
+	do := func(key, acceptEncoding string) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodPost, srv.URL, nil)
+		require.NoError(t, err)
+
+		req.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return resp, body
+	}
+
+	key1 := uniuri.New()
+
+	resp, body1 := do(key1, "gzip")
+	require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+
+	resp, body := do(key1, "gzip, deflate")
+	require.Equal(t, "true", resp.Header.Get(potency.ReplayedHeader))
+	require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	require.Equal(t, body1, body)
+
+	for _, ae := range []string{"", "identity", "gzip;q=0", "br"} {
+		resp, body = do(key1, ae)
+		require.Equal(t, "true", resp.Header.Get(potency.ReplayedHeader))
+		require.Empty(t, resp.Header.Get("Content-Encoding"), ae)
+		require.Equal(t, "hello world", string(body), ae)
+		require.Equal(t, int64(len("hello world")), resp.ContentLength)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(body1))
+	require.NoError(t, err)
+
+	plain, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(plain))
+}
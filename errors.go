@@ -0,0 +1,115 @@
+package potency
+
+import (
+	"fmt"
+	"time"
+)
+
+// MismatchError reports how a retry differs from the request saved under its
+// key. It unwraps to ErrMethodMismatch, ErrURLMismatch, ErrBodyMismatch or
+// ErrHeaderMismatch, and so to ErrMismatch.
+type MismatchError struct {
+	// Field is "method", "URL", "body", the canonical name of the header
+	// that differs, or "identity" when only digests were saved (see
+	// WithIdentityDigest).
+	Field string
+
+	// Got is the retry's value and Want the original's. Bodies are compared
+	// by hash, in hex. Header values may be credentials (e.g. Authorization),
+	// so take care when rendering Want.
+	Got  string
+	Want string
+}
+
+func (e *MismatchError) Error() string {
+	switch e.Field {
+	case "method", "URL":
+		return fmt.Sprintf("%s (%s)", e.Got, e.Unwrap())
+	case "body", "identity":
+		return fmt.Sprintf("%s vs %s (%s)", e.Got, e.Want, e.Unwrap())
+	default:
+		return fmt.Sprintf("%s: %s (%s)", e.Field, e.Got, e.Unwrap())
+	}
+}
+
+func (e *MismatchError) Unwrap() error {
+	switch e.Field {
+	case "method":
+		return ErrMethodMismatch
+	case "URL":
+		return ErrURLMismatch
+	case "body":
+		return ErrBodyMismatch
+	case "identity":
+		return ErrIdentityMismatch
+	default:
+		return ErrHeaderMismatch
+	}
+}
+
+// InProgressError reports that a key is already executing. It unwraps to
+// ErrConflict, and to the context error when a wait for the original gave
+// up.
+type InProgressError struct {
+	Key string
+
+	// Since is when the original execution started.
+	Since time.Time
+
+	cause error
+}
+
+func (e *InProgressError) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s: %s (%s)", e.Key, e.cause, ErrConflict)
+	}
+
+	return fmt.Sprintf("%s (%s)", e.Key, ErrConflict)
+}
+
+func (e *InProgressError) Unwrap() []error {
+	if e.cause != nil {
+		return []error{ErrConflict, e.cause}
+	}
+
+	return []error{ErrConflict}
+}
+
+// SavedError reports that Reserve lost a race with an execution that saved
+// its result after the caller's Lookup. It unwraps to ErrAlreadySaved; replay
+// Result rather than executing again.
+type SavedError struct {
+	Result *SavedResult
+}
+
+func (e *SavedError) Error() string {
+	return fmt.Sprintf("%s (%s)", e.Result.Key, ErrAlreadySaved)
+}
+
+func (e *SavedError) Unwrap() error {
+	return ErrAlreadySaved
+}
+
+// InvalidKeyError reports an idempotency key that couldn't be parsed. It
+// unwraps to ErrInvalidKey, and to the parse error if there is one.
+type InvalidKeyError struct {
+	Key string
+
+	cause error
+}
+
+func (e *InvalidKeyError) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s (%s)", e.cause, ErrInvalidKey)
+	}
+
+	return fmt.Sprintf("%s (%s)", e.Key, ErrInvalidKey)
+}
+
+func (e *InvalidKeyError) Unwrap() []error {
+	if e.cause != nil {
+		return []error{ErrInvalidKey, e.cause}
+	}
+
+	return []error{ErrInvalidKey}
+}
@@ -0,0 +1,96 @@
+package potency_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMismatchError(t *testing.T) {
+	t.Parallel()
+
+	err := error(&potency.MismatchError{Field: "X-App-Tenant", Got: "b", Want: "a"})
+	require.ErrorIs(t, err, potency.ErrHeaderMismatch)
+	require.ErrorIs(t, err, potency.ErrMismatch)
+	require.Equal(t, "X-App-Tenant: b (Header mismatch: idempotency mismatch)", err.Error())
+
+	err = &potency.MismatchError{Field: "method", Got: "PUT", Want: "POST"}
+	require.ErrorIs(t, err, potency.ErrMethodMismatch)
+	require.NotErrorIs(t, err, potency.ErrBodyMismatch)
+}
+
+func TestInProgressError(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	key := uniuri.New()
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		_, _, err := ts.pot.Do(context.Background(), key, func(context.Context) (potency.Result, error) {
+			close(started)
+			<-release
+
+			return potency.Result{}, nil
+		})
+		require.NoError(t, err)
+	}()
+
+	<-started
+
+	_, _, err := ts.pot.Do(context.Background(), key, func(context.Context) (potency.Result, error) {
+		return potency.Result{}, nil
+	})
+	require.ErrorIs(t, err, potency.ErrConflict)
+
+	ipe := &potency.InProgressError{}
+	require.True(t, errors.As(err, &ipe))
+	require.Equal(t, key, ipe.Key)
+	require.WithinDuration(t, time.Now(), ipe.Since, 5*time.Second)
+
+	ts.pot.SetConflictPolicy(potency.ConflictWait)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, _, err = ts.pot.Do(ctx, key, func(context.Context) (potency.Result, error) {
+		return potency.Result{}, nil
+	})
+	require.ErrorIs(t, err, potency.ErrConflict)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.True(t, errors.As(err, &ipe))
+
+	close(release)
+	wg.Wait()
+}
+
+func TestInvalidKeyError(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequest(http.MethodPost, "/", strings.NewReader("{"))
+	require.NoError(t, err)
+
+	req.Header.Set("Content-Type", "application/json")
+
+	_, err = potency.KeyFromJSONField("id", 0)(req)
+	require.ErrorIs(t, err, potency.ErrInvalidKey)
+
+	ike := &potency.InvalidKeyError{}
+	require.True(t, errors.As(err, &ike))
+}
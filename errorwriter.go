@@ -0,0 +1,106 @@
+package potency
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gopatchy/jsrest"
+)
+
+// ErrorCodeHeader carries the ErrorCode of every error response from the
+// middleware, whichever ErrorWriter, Translator or status is configured, so
+// clients (e.g. potencyclient.Check) can classify it without parsing the
+// body.
+const ErrorCodeHeader = "Idempotency-Error-Code"
+
+// WithErrorWriter replaces how every error response from the middleware
+// (invalid key, mismatch, conflict, oversize body, quota, rate limit, store
+// failure, shutdown) is written, e.g. to match the application's error
+// envelope. WithConflictErrorWriter takes precedence for conflicts. The
+// default writes jsrest's {"messages": [...]}.
+func WithErrorWriter(writer ErrorWriter) Option {
+	return func(cfg *config) {
+		cfg.errorWriter = writer
+	}
+}
+
+// JSONErrorWriter returns an ErrorWriter that writes the value returned by
+// envelope as JSON, e.g.
+//
+//	potency.JSONErrorWriter(func(status int, code, message string) any {
+//		return map[string]any{"error": map[string]any{"code": code, "message": message}}
+//	})
+func JSONErrorWriter(envelope func(status int, code, message string) any) ErrorWriter {
+	return func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+
+		_ = json.NewEncoder(w).Encode(envelope(status, ErrorCode(err), err.Error()))
+	}
+}
+
+// ErrorCode returns a stable, machine-readable code for an error from the
+// middleware: "missing_key", "invalid_key", "mismatch", "conflict",
+// "replay_forbidden", "key_retired", "too_many_replays", "body_too_large",
+// "quota_exceeded", "rate_limited", "precondition_failed",
+// "store_unavailable", "peer_unavailable", "shutting_down" or "error".
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrMissingKey):
+		return "missing_key"
+	case errors.Is(err, ErrInvalidKey):
+		return "invalid_key"
+	case errors.Is(err, ErrMismatch):
+		return "mismatch"
+	case errors.Is(err, ErrConflict):
+		return "conflict"
+	case errors.Is(err, ErrReplayForbidden):
+		return "replay_forbidden"
+	case errors.Is(err, ErrKeyRetired):
+		return "key_retired"
+	case errors.Is(err, ErrTooManyReplays):
+		return "too_many_replays"
+	case errors.Is(err, ErrBodyTooLarge):
+		return "body_too_large"
+	case errors.Is(err, ErrQuotaExceeded):
+		return "quota_exceeded"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrPreconditionFailed):
+		return "precondition_failed"
+	case errors.Is(err, ErrStore):
+		return "store_unavailable"
+	case errors.Is(err, ErrPeer):
+		return "peer_unavailable"
+	case errors.Is(err, ErrShuttingDown):
+		return "shutting_down"
+	default:
+		return "error"
+	}
+}
+
+func (cfg *config) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := jsrest.ToJSONError(err).Code
+	w.Header().Set(ErrorCodeHeader, ErrorCode(err))
+	err = cfg.translate(r, err)
+
+	switch {
+	case errors.Is(err, ErrConflict) && cfg.conflictErrorWriter != nil:
+		cfg.conflictErrorWriter(w, r, cfg.conflictStatus, err)
+
+	case cfg.errorWriter != nil:
+		cfg.errorWriter(w, r, status, err)
+
+	case cfg.conformance:
+		cfg.writeProblem(w, status, err)
+
+	default:
+		if te, ok := err.(*translatedError); ok {
+			writeTranslated(w, status, te)
+			return
+		}
+
+		jsrest.WriteError(w, err)
+	}
+}
@@ -0,0 +1,67 @@
+package potency_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+type errorEnvelope struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func TestErrorWriter(t *testing.T) {
+	t.Parallel()
+
+	writer := potency.JSONErrorWriter(func(status int, code, message string) any {
+		return map[string]any{"error": map[string]any{"code": code, "message": message}}
+	})
+
+	ts := newTestServer(t, potency.WithErrorWriter(writer))
+	defer ts.shutdown(t)
+
+	check := func(status int, code, key, body string) {
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", key).
+			SetBody(body).
+			Post("")
+		require.NoError(t, err)
+		require.Equal(t, status, resp.StatusCode())
+		require.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+
+		env := &errorEnvelope{}
+		require.NoError(t, json.Unmarshal(resp.Body(), env))
+		require.Equal(t, code, env.Error.Code)
+		require.NotEmpty(t, env.Error.Message)
+	}
+
+	check(http.StatusBadRequest, "invalid_key", "unquoted", "test")
+
+	key := fmt.Sprintf(`"%s"`, uniuri.New())
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", key).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	check(http.StatusBadRequest, "mismatch", key, "test2")
+}
+
+func TestErrorCode(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "mismatch", potency.ErrorCode(&potency.MismatchError{Field: "body"}))
+	require.Equal(t, "conflict", potency.ErrorCode(&potency.InProgressError{Key: "a"}))
+	require.Equal(t, "quota_exceeded", potency.ErrorCode(potency.ErrQuotaExceeded))
+	require.Equal(t, "error", potency.ErrorCode(fmt.Errorf("other")))
+}
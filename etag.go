@@ -0,0 +1,64 @@
+package potency
+
+import (
+	"encoding/base64"
+	"errors"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+var ErrPreconditionFailed = errors.New("If-None-Match matched saved response")
+
+// notModifiedHeaders are copied from the saved response onto a 304, per RFC
+// 9110 section 15.4.5.
+var notModifiedHeaders = []string{
+	"Cache-Control",
+	"Content-Location",
+	"Date",
+	"ETag",
+	"Expires",
+	"Vary",
+}
+
+func newETag(h hash.Hash, body []byte) string {
+	_, _ = h.Write(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(h.Sum(nil)) + `"`
+}
+
+// notModified reports whether r's If-None-Match matches etag, using weak
+// comparison. Per RFC 9110 section 13.1.2, a match means 304 for GET and
+// HEAD and 412 for other methods.
+func notModified(r *http.Request, etag string) bool {
+	if etag == "" {
+		return false
+	}
+
+	for _, inm := range r.Header.Values("If-None-Match") {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func writeNotModified(w http.ResponseWriter, header http.Header, requestID string) {
+	for _, h := range notModifiedHeaders {
+		if val := header.Get(h); val != "" {
+			w.Header().Set(h, val)
+		}
+	}
+
+	w.Header().Set(ReplayedHeader, "true")
+
+	if requestID != "" {
+		w.Header().Set(OriginalRequestIDHeader, requestID)
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+}
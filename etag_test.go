@@ -0,0 +1,103 @@
+package potency_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestETag(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+	require.Equal(t, resp1, resp.String())
+
+	etag := resp.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	require.NotContains(t, etag, "W/")
+
+	// Only GET and HEAD get 304; the POST would have been performed
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("If-None-Match", `"other", W/`+etag).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode())
+	require.Equal(t, "precondition_failed", resp.Header().Get(potency.ErrorCodeHeader))
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("If-None-Match", `"other"`).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+	require.Equal(t, resp1, resp.String())
+
+	// Mismatched bodies are still rejected rather than answered with 304
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("If-None-Match", etag).
+		SetBody("test2").
+		Post("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode())
+}
+
+func TestETagGET(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Get("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Get("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+
+	etag := resp.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("If-None-Match", `"other", W/`+etag).
+		Get("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotModified, resp.StatusCode())
+	require.Equal(t, etag, resp.Header().Get("ETag"))
+	require.Equal(t, "true", resp.Header().Get(potency.ReplayedHeader))
+	require.Empty(t, resp.String())
+}
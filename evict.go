@@ -0,0 +1,82 @@
+package potency
+
+// EvictReason is why an entry left the cache.
+type EvictReason int
+
+const (
+	// EvictExpired means the entry outlived its lifetime.
+	EvictExpired EvictReason = iota
+
+	// EvictCapacity means the entry was dropped early to stay within a
+	// quota or byte budget.
+	EvictCapacity
+
+	// EvictManual means the entry was invalidated, locally or by a replica.
+	EvictManual
+
+	// EvictCorrupt means the entry's compressed body couldn't be decoded
+	// (see WithBodyCompression).
+	EvictCorrupt
+)
+
+type eviction struct {
+	sr     *SavedResult
+	reason EvictReason
+}
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictExpired:
+		return "expired"
+	case EvictCapacity:
+		return "capacity"
+	case EvictManual:
+		return "manual"
+	case EvictCorrupt:
+		return "corrupt"
+	default:
+		return "unknown"
+	}
+}
+
+// WithOnEvict calls onEvict for each entry removed from the local cache. It
+// is called synchronously, outside of internal locks, on the goroutine that
+// caused the eviction. Expired entries are noticed lazily, when a later
+// write or read reaches them.
+func WithOnEvict(onEvict func(*SavedResult, EvictReason)) Option {
+	return func(cfg *config) {
+		cfg.onEvict = onEvict
+	}
+}
+
+// unlockAndNotify releases cacheMu and then reports evictions recorded while
+// it was held.
+func (p *Potency) unlockAndNotify() {
+	evicted := p.evicted
+	p.evicted = nil
+	onEvict := p.cfg.onEvict
+
+	// The feed leaves the process, so it gets unpacked, scrubbed copies
+	var results []*SavedResult
+
+	if p.hasSubscribers() {
+		results = make([]*SavedResult, len(evicted))
+
+		for i, ev := range evicted {
+			sr, _ := p.unpackLocked(ev.sr)
+			results[i] = p.cfg.scrub(sr)
+		}
+	}
+
+	p.cacheMu.Unlock()
+
+	for i, ev := range evicted {
+		if onEvict != nil {
+			onEvict(ev.sr, ev.reason)
+		}
+
+		if ev.reason != EvictManual && results != nil {
+			p.emit(Event{Op: EventEvict, Key: ev.sr.Key, Result: results[i], Reason: ev.reason})
+		}
+	}
+}
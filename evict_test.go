@@ -0,0 +1,80 @@
+package potency_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnEvict(t *testing.T) {
+	t.Parallel()
+
+	mu := sync.Mutex{}
+	evicted := map[string]potency.EvictReason{}
+
+	ts := newTestServer(t,
+		potency.WithMaxBytes(2000),
+		potency.WithOnEvict(func(sr *potency.SavedResult, reason potency.EvictReason) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			evicted[sr.Key] = reason
+		}),
+	)
+	defer ts.shutdown(t)
+
+	reason := func(key string) (potency.EvictReason, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		r, ok := evicted[key]
+
+		return r, ok
+	}
+
+	post := func() string {
+		key := uniuri.New()
+
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key)).
+			Post("")
+		require.NoError(t, err)
+		require.False(t, resp.IsError())
+
+		return key
+	}
+
+	key1 := post()
+
+	require.NoError(t, ts.pot.Invalidate(context.Background(), key1))
+
+	r, ok := reason(key1)
+	require.True(t, ok)
+	require.Equal(t, potency.EvictManual, r)
+
+	keys := []string{}
+	for i := 0; i < 5; i++ {
+		keys = append(keys, post())
+	}
+
+	r, ok = reason(keys[0])
+	require.True(t, ok)
+	require.Equal(t, potency.EvictCapacity, r)
+	require.Equal(t, "capacity", r.String())
+
+	ts.pot.SetLifetime(100 * time.Millisecond)
+
+	time.Sleep(150 * time.Millisecond)
+
+	post()
+
+	r, ok = reason(keys[4])
+	require.True(t, ok)
+	require.Equal(t, potency.EvictExpired, r)
+}
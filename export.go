@@ -0,0 +1,141 @@
+package potency
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Export format: newline-delimited JSON, one object per saved result, oldest
+// first:
+//
+//	{"key":"...","method":"POST","url":"/foo","requestHeader":{...},
+//	 "bodyHash":"<base64>","statusCode":201,"responseHeader":{...},
+//	 "responseBody":"<base64>","responseTrailer":{...},
+//	 "added":"2006-01-02T15:04:05.999999999Z","requestId":"...",
+//	 "principal":"...","requestDigest":"<base64>","clientIp":"...",
+//	 "userAgent":"..."}
+//
+// Headers are objects of string arrays; bodyHash, responseBody and
+// requestDigest are standard base64. clientIp and userAgent describe the
+// client that created the result (see WithProvenance) and are omitted when
+// empty.
+type exportEntry struct {
+	Key string `json:"key"`
+
+	Method        string      `json:"method"`
+	URL           string      `json:"url"`
+	RequestHeader http.Header `json:"requestHeader,omitempty"`
+	BodyHash      []byte      `json:"bodyHash"`
+
+	StatusCode      int         `json:"statusCode"`
+	ResponseHeader  http.Header `json:"responseHeader,omitempty"`
+	ResponseBody    []byte      `json:"responseBody"`
+	ResponseTrailer http.Header `json:"responseTrailer,omitempty"`
+
+	Added time.Time `json:"added"`
+
+	RequestID string `json:"requestId,omitempty"`
+	Principal string `json:"principal,omitempty"`
+
+	RequestDigest []byte `json:"requestDigest,omitempty"`
+
+	ClientIP  string `json:"clientIp,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+var ErrImportFormat = errors.New("invalid import format")
+
+// Export writes the cache contents to w as NDJSON.
+func (p *Potency) Export(w io.Writer) error {
+	enc := json.NewEncoder(w)
+
+	for _, sr := range p.snapshot() {
+		err := enc.Encode(&exportEntry{
+			Key: sr.Key,
+
+			Method:        sr.Method,
+			URL:           sr.URL,
+			RequestHeader: sr.RequestHeader,
+			BodyHash:      sr.BodyHash,
+
+			StatusCode:      sr.StatusCode,
+			ResponseHeader:  sr.ResponseHeader,
+			ResponseBody:    sr.ResponseBody,
+			ResponseTrailer: sr.ResponseTrailer,
+
+			Added: sr.Added,
+
+			RequestID: sr.RequestID,
+			Principal: sr.Principal,
+
+			RequestDigest: sr.RequestDigest,
+
+			ClientIP:  sr.ClientIP,
+			UserAgent: sr.UserAgent,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Import reads NDJSON written by Export and preloads the entries. Nothing is
+// imported if any line is invalid.
+func (p *Potency) Import(r io.Reader) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	dec.DisallowUnknownFields()
+
+	entries := []*SavedResult{}
+
+	for {
+		e := &exportEntry{}
+
+		err := dec.Decode(e)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("entry %d: %s (%w)", len(entries)+1, err, ErrImportFormat)
+		}
+
+		if e.Key == "" {
+			return fmt.Errorf("entry %d: missing key (%w)", len(entries)+1, ErrImportFormat)
+		}
+
+		entries = append(entries, &SavedResult{
+			Key: e.Key,
+
+			Method:        e.Method,
+			URL:           e.URL,
+			RequestHeader: e.RequestHeader,
+			BodyHash:      e.BodyHash,
+
+			StatusCode:      e.StatusCode,
+			ResponseHeader:  e.ResponseHeader,
+			ResponseBody:    e.ResponseBody,
+			ResponseTrailer: e.ResponseTrailer,
+
+			Added: e.Added,
+
+			RequestID: e.RequestID,
+			Principal: e.Principal,
+
+			RequestDigest: e.RequestDigest,
+
+			ClientIP:  e.ClientIP,
+			UserAgent: e.UserAgent,
+		})
+	}
+
+	p.Preload(entries)
+
+	return nil
+}
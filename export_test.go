@@ -0,0 +1,67 @@
+package potency_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	t.Parallel()
+
+	ts1 := newTestServer(t)
+	defer ts1.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts1.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, ts1.pot.Export(buf))
+
+	line := map[string]any{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, key1, line["key"])
+	require.Equal(t, http.MethodPost, line["method"])
+
+	ts2 := newTestServer(t)
+	defer ts2.shutdown(t)
+
+	require.NoError(t, ts2.pot.Import(buf))
+	require.Equal(t, 1, ts2.pot.NumCached())
+
+	resp, err = ts2.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, resp1, resp.String())
+}
+
+func TestImportInvalid(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler())
+
+	err := p.Import(strings.NewReader(`{"key":"a","added":"2000-01-01T00:00:00Z"}` + "\n" + `{"bogus":1}` + "\n"))
+	require.ErrorIs(t, err, potency.ErrImportFormat)
+	require.Equal(t, 0, p.NumCached())
+
+	err = p.Import(strings.NewReader(`{"method":"POST"}`))
+	require.ErrorIs(t, err, potency.ErrImportFormat)
+}
@@ -0,0 +1,110 @@
+package potency
+
+import "sync/atomic"
+
+type EventOp int
+
+const (
+	// EventStore is a result saved by this instance.
+	EventStore EventOp = iota + 1
+
+	// EventInvalidate is a key invalidated on this instance (Invalidate or
+	// InvalidateWhere).
+	EventInvalidate
+
+	// EventEvict is an entry dropped from the local cache because it
+	// expired or to stay within capacity. Other instances make the same
+	// decisions independently.
+	EventEvict
+)
+
+// Event is one change in the feed returned by Subscribe.
+type Event struct {
+	Op  EventOp
+	Key string
+
+	// Result is set for EventStore and EventEvict.
+	Result *SavedResult
+
+	// Reason is set for EventEvict.
+	Reason EvictReason
+
+	// Missed counts events dropped for this subscriber since the last one it
+	// received because its buffer was full. A consumer that must not miss
+	// changes (e.g. cross-region replication) should resynchronize, for
+	// example with Export.
+	Missed int
+}
+
+type subscriber struct {
+	ch     chan Event
+	missed int
+}
+
+// Subscribe returns a feed of local changes, e.g. to replicate idempotency
+// state asynchronously to another region. Results received from replicas,
+// peers or the store are not included. Events are delivered without blocking
+// the request path: when the buffer is full they are dropped and counted in
+// Event.Missed. The channel is closed by cancel or Shutdown.
+func (p *Potency) Subscribe(buffer int) (<-chan Event, func()) {
+	sub := &subscriber{
+		ch: make(chan Event, buffer),
+	}
+
+	p.subscribersMu.Lock()
+	p.subscribers[sub] = struct{}{}
+	atomic.AddInt32(&p.subscriberCount, 1)
+	p.subscribersMu.Unlock()
+
+	cancel := func() {
+		p.subscribersMu.Lock()
+		defer p.subscribersMu.Unlock()
+
+		p.unsubscribeLocked(sub)
+	}
+
+	return sub.ch, cancel
+}
+
+func (p *Potency) unsubscribeLocked(sub *subscriber) {
+	if _, found := p.subscribers[sub]; !found {
+		return
+	}
+
+	delete(p.subscribers, sub)
+	atomic.AddInt32(&p.subscriberCount, -1)
+	close(sub.ch)
+}
+
+func (p *Potency) closeSubscribers() {
+	p.subscribersMu.Lock()
+	defer p.subscribersMu.Unlock()
+
+	for sub := range p.subscribers {
+		p.unsubscribeLocked(sub)
+	}
+}
+
+func (p *Potency) hasSubscribers() bool {
+	return atomic.LoadInt32(&p.subscriberCount) > 0
+}
+
+func (p *Potency) emit(ev Event) {
+	if !p.hasSubscribers() {
+		return
+	}
+
+	p.subscribersMu.Lock()
+	defer p.subscribersMu.Unlock()
+
+	for sub := range p.subscribers {
+		ev.Missed = sub.missed
+
+		select {
+		case sub.ch <- ev:
+			sub.missed = 0
+		default:
+			sub.missed++
+		}
+	}
+}
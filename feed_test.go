@@ -0,0 +1,87 @@
+package potency_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribe(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	events, cancel := ts.pot.Subscribe(10)
+	defer cancel()
+
+	next := func() potency.Event {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "no event")
+			return potency.Event{}
+		}
+	}
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	ev := next()
+	require.Equal(t, potency.EventStore, ev.Op)
+	require.Equal(t, key1, ev.Key)
+	require.Equal(t, resp.String(), string(ev.Result.ResponseBody))
+
+	require.NoError(t, ts.pot.Invalidate(context.Background(), key1))
+
+	ev = next()
+	require.Equal(t, potency.EventInvalidate, ev.Op)
+	require.Equal(t, key1, ev.Key)
+
+	ts.pot.Preload([]*potency.SavedResult{{Key: uniuri.New()}})
+	ts.pot.SetLifetime(time.Nanosecond)
+
+	ev = next()
+	require.Equal(t, potency.EventEvict, ev.Op)
+	require.Equal(t, potency.EvictExpired, ev.Reason)
+
+	require.NoError(t, ts.pot.Shutdown(context.Background()))
+
+	_, ok := <-events
+	require.False(t, ok)
+}
+
+func TestSubscribeMissed(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	events, cancel := ts.pot.Subscribe(1)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, ts.pot.Invalidate(context.Background(), uniuri.New()))
+	}
+
+	require.Equal(t, 0, (<-events).Missed)
+
+	require.NoError(t, ts.pot.Invalidate(context.Background(), uniuri.New()))
+	require.Equal(t, 2, (<-events).Missed)
+
+	cancel()
+	cancel()
+
+	_, ok := <-events
+	require.False(t, ok)
+}
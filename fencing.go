@@ -0,0 +1,21 @@
+package potency
+
+import (
+	"context"
+)
+
+type fencingTokenKey struct{}
+
+// FencingToken returns the fencing token of the execution running under ctx.
+// Tokens increase monotonically with each reservation made by a Potency
+// (seeded from the clock, so they usually keep increasing across restarts).
+// Handlers can attach the token to their writes so that downstream systems
+// reject writes from an execution that has been superseded.
+func FencingToken(ctx context.Context) (uint64, bool) {
+	token, ok := ctx.Value(fencingTokenKey{}).(uint64)
+	return token, ok
+}
+
+func withFencingToken(ctx context.Context, token uint64) context.Context {
+	return context.WithValue(ctx, fencingTokenKey{}, token)
+}
@@ -0,0 +1,64 @@
+package potency_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFencingToken(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := potency.FencingToken(r.Context())
+		require.True(t, ok)
+
+		_, _ = w.Write([]byte(strconv.FormatUint(token, 10)))
+	}))
+
+	tokens := []uint64{}
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New()))
+
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+
+		token, err := strconv.ParseUint(rec.Body.String(), 10, 64)
+		require.NoError(t, err)
+
+		tokens = append(tokens, token)
+	}
+
+	require.Less(t, tokens[0], tokens[1])
+	require.Less(t, tokens[1], tokens[2])
+
+	_, _, err := p.Do(context.Background(), uniuri.New(), func(ctx context.Context) (potency.Result, error) {
+		token, ok := potency.FencingToken(ctx)
+		require.True(t, ok)
+		require.Greater(t, token, tokens[2])
+
+		return potency.Result{}, nil
+	})
+	require.NoError(t, err)
+
+	res, err := p.Reserve(uniuri.New())
+	require.NoError(t, err)
+
+	defer res.Release()
+
+	token, ok := potency.FencingToken(res.Context(context.Background()))
+	require.True(t, ok)
+	require.Equal(t, res.Token(), token)
+
+	_, ok = potency.FencingToken(context.Background())
+	require.False(t, ok)
+}
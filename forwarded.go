@@ -0,0 +1,85 @@
+package potency
+
+import (
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+type ForwardedPolicy int
+
+const (
+	// ForwardedIgnore keeps headers added by proxies (Forwarded,
+	// X-Forwarded-*, X-Real-Ip) out of the identity even when they match
+	// WithIdentityHeaders, so a retry that takes a different route through
+	// the load balancers still replays.
+	ForwardedIgnore ForwardedPolicy = iota
+
+	// ForwardedClientIP adds the originating client IP to the identity,
+	// recorded as ClientIPHeader, so a key can't be replayed from another
+	// address. It is taken from the first Forwarded or X-Forwarded-For hop,
+	// then X-Real-Ip, then the connection. Only use it when every request
+	// passes through proxies that overwrite these headers.
+	ForwardedClientIP
+
+	// ForwardedHeaders treats proxy headers like any other request header,
+	// subject to WithIdentityHeaders.
+	ForwardedHeaders
+)
+
+// ClientIPHeader is the pseudo-header under which ForwardedClientIP records
+// the client IP in SavedResult.RequestHeader.
+const ClientIPHeader = "Potency-Client-Ip"
+
+// WithForwardedIdentity chooses how proxy headers take part in the request
+// identity (default ForwardedIgnore).
+func WithForwardedIdentity(policy ForwardedPolicy) Option {
+	return func(cfg *config) {
+		cfg.forwardedPolicy = policy
+	}
+}
+
+func isForwardedHeader(name string) bool {
+	return name == "Forwarded" || name == "X-Real-Ip" || strings.HasPrefix(name, "X-Forwarded-")
+}
+
+// clientIP returns the originating client address of r.
+func clientIP(r *http.Request) string {
+	if fwd := r.Header.Get("Forwarded"); fwd != "" {
+		first, _, _ := strings.Cut(fwd, ",")
+
+		for _, pair := range strings.Split(first, ";") {
+			name, val, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			if strings.EqualFold(name, "for") {
+				return stripPort(strings.Trim(val, `"`))
+			}
+		}
+	}
+
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		first, _, _ := strings.Cut(xff, ",")
+		return stripPort(strings.TrimSpace(first))
+	}
+
+	if xri := r.Header.Get("X-Real-Ip"); xri != "" {
+		return stripPort(strings.TrimSpace(xri))
+	}
+
+	return stripPort(r.RemoteAddr)
+}
+
+// stripPort removes any port and IPv6 brackets from addr.
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
+
+func (cfg *config) forwardedIdentity(r *http.Request, ret http.Header) {
+	if cfg.forwardedPolicy == ForwardedClientIP {
+		ret[textproto.CanonicalMIMEHeaderKey(ClientIPHeader)] = []string{clientIP(r)}
+	}
+}
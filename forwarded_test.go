@@ -0,0 +1,114 @@
+package potency_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardedIgnore(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithIdentityHeaders("X-*"))
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("X-Forwarded-For", "192.0.2.1, 10.0.0.1").
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("X-Forwarded-For", "192.0.2.1, 10.0.0.2").
+		SetHeader("X-Real-Ip", "192.0.2.1").
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, resp1, resp.String())
+}
+
+func TestForwardedClientIP(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithForwardedIdentity(potency.ForwardedClientIP))
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("X-Forwarded-For", "192.0.2.1, 10.0.0.1").
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("Forwarded", `for="192.0.2.1:1234";proto=https, for=10.0.0.2`).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, resp1, resp.String())
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("X-Forwarded-For", "198.51.100.1, 10.0.0.1").
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+	require.Contains(t, resp.String(), potency.ClientIPHeader)
+
+	// Without proxy headers, the connection address is used
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+	require.Contains(t, resp.String(), potency.ErrHeaderMismatch.Error())
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t,
+		potency.WithIdentityHeaders("X-Forwarded-For"),
+		potency.WithForwardedIdentity(potency.ForwardedHeaders),
+	)
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("X-Forwarded-For", "192.0.2.1").
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("X-Forwarded-For", "192.0.2.1, 10.0.0.1").
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+	require.Contains(t, resp.String(), "X-Forwarded-For")
+}
@@ -0,0 +1,473 @@
+package potency
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config mirrors the options for services that configure the middleware from
+// a JSON or YAML file. Zero values keep the defaults. Options that take
+// functions (metrics, principals, hooks) still have to be passed in code,
+// after those returned by FromConfig.
+type Config struct {
+	Lifetime       Duration `json:"lifetime,omitempty"       yaml:"lifetime,omitempty"`
+	ErrorLifetime  Duration `json:"errorLifetime,omitempty"  yaml:"errorLifetime,omitempty"`
+	LifetimeJitter float64  `json:"lifetimeJitter,omitempty" yaml:"lifetimeJitter,omitempty"`
+	StrictWindow   Duration `json:"strictWindow,omitempty"   yaml:"strictWindow,omitempty"`
+
+	// Tombstones enables WithTombstones, refusing retries with
+	// TombstoneStatus (default 410).
+	Tombstones      Duration `json:"tombstones,omitempty"      yaml:"tombstones,omitempty"`
+	TombstoneStatus int      `json:"tombstoneStatus,omitempty" yaml:"tombstoneStatus,omitempty"`
+
+	// KeyHeader takes the key from the raw (unquoted) value of the named
+	// header instead of a quoted Idempotency-Key.
+	KeyHeader string `json:"keyHeader,omitempty" yaml:"keyHeader,omitempty"`
+
+	// KeyParsing is "lenient" or "strict".
+	KeyParsing string `json:"keyParsing,omitempty" yaml:"keyParsing,omitempty"`
+
+	// MinKeyLength and MinKeyEntropy (in bits) enable WithKeyPolicy.
+	MinKeyLength  int     `json:"minKeyLength,omitempty"  yaml:"minKeyLength,omitempty"`
+	MinKeyEntropy float64 `json:"minKeyEntropy,omitempty" yaml:"minKeyEntropy,omitempty"`
+
+	IdentityHeaders         []string `json:"identityHeaders,omitempty"         yaml:"identityHeaders,omitempty"`
+	IdentityHeadersExcluded []string `json:"identityHeadersExcluded,omitempty" yaml:"identityHeadersExcluded,omitempty"`
+
+	// IdentityDigest enables WithIdentityDigest.
+	IdentityDigest           bool `json:"identityDigest,omitempty"           yaml:"identityDigest,omitempty"`
+	IdentityDigestKeepFields bool `json:"identityDigestKeepFields,omitempty" yaml:"identityDigestKeepFields,omitempty"`
+
+	// ForwardedIdentity is "ignore", "client-ip" or "headers".
+	ForwardedIdentity string `json:"forwardedIdentity,omitempty" yaml:"forwardedIdentity,omitempty"`
+
+	BypassMethods         []string `json:"bypassMethods,omitempty"         yaml:"bypassMethods,omitempty"`
+	StreamingContentTypes []string `json:"streamingContentTypes,omitempty" yaml:"streamingContentTypes,omitempty"`
+	ScrubbedHeaders       []string `json:"scrubbedHeaders,omitempty"       yaml:"scrubbedHeaders,omitempty"`
+	CacheControlNoStore   bool     `json:"cacheControlNoStore,omitempty"   yaml:"cacheControlNoStore,omitempty"`
+	SkipUnwritten         bool     `json:"skipUnwritten,omitempty"         yaml:"skipUnwritten,omitempty"`
+	ReceiptThreshold      int64    `json:"receiptThreshold,omitempty"      yaml:"receiptThreshold,omitempty"`
+	StatusOnly            bool     `json:"statusOnly,omitempty"            yaml:"statusOnly,omitempty"`
+	StrictResponses       bool     `json:"strictResponses,omitempty"       yaml:"strictResponses,omitempty"`
+	CacheStatus           bool     `json:"cacheStatus,omitempty"           yaml:"cacheStatus,omitempty"`
+
+	// Conformance enables WithConformance, with ProblemType as the type of
+	// its problem documents.
+	Conformance bool   `json:"conformance,omitempty" yaml:"conformance,omitempty"`
+	ProblemType string `json:"problemType,omitempty" yaml:"problemType,omitempty"`
+
+	// OversizePolicy is "reject" or "bypass".
+	MaxRequestBodySize   int64  `json:"maxRequestBodySize,omitempty"   yaml:"maxRequestBodySize,omitempty"`
+	OversizePolicy       string `json:"oversizePolicy,omitempty"       yaml:"oversizePolicy,omitempty"`
+	RequestBodyBuffering int64  `json:"requestBodyBuffering,omitempty" yaml:"requestBodyBuffering,omitempty"`
+	MaxBytes             int64  `json:"maxBytes,omitempty"             yaml:"maxBytes,omitempty"`
+
+	// EvictionPolicy is "fifo" or "lru".
+	EvictionPolicy string `json:"evictionPolicy,omitempty" yaml:"evictionPolicy,omitempty"`
+	MaxReplays     int64  `json:"maxReplays,omitempty"     yaml:"maxReplays,omitempty"`
+
+	// BodyCompression lists media types whose cached bodies are compressed
+	// with a trained dictionary; see WithBodyCompression.
+	BodyCompression []string `json:"bodyCompression,omitempty" yaml:"bodyCompression,omitempty"`
+
+	// QuotaPolicy is "reject" or "evict-oldest".
+	PrincipalQuota int    `json:"principalQuota,omitempty" yaml:"principalQuota,omitempty"`
+	QuotaPolicy    string `json:"quotaPolicy,omitempty"    yaml:"quotaPolicy,omitempty"`
+
+	// Provenance lists "client-ip" and "user-agent"; see WithProvenance.
+	Provenance []string `json:"provenance,omitempty" yaml:"provenance,omitempty"`
+
+	// ExecutionRateLimit is per principal; see WithExecutionRateLimit.
+	// ExecutionRateBurst defaults to 1.
+	ExecutionRateLimit float64 `json:"executionRateLimit,omitempty" yaml:"executionRateLimit,omitempty"`
+	ExecutionRateBurst int     `json:"executionRateBurst,omitempty" yaml:"executionRateBurst,omitempty"`
+
+	// ConflictPolicy is "error", "wait" or "proxy"; see WithConflictPolicy.
+	ConflictPolicy string `json:"conflictPolicy,omitempty" yaml:"conflictPolicy,omitempty"`
+
+	ConflictStatus   int      `json:"conflictStatus,omitempty"   yaml:"conflictStatus,omitempty"`
+	MaxWait          Duration `json:"maxWait,omitempty"          yaml:"maxWait,omitempty"`
+	WaitWhileSending bool     `json:"waitWhileSending,omitempty" yaml:"waitWhileSending,omitempty"`
+	Lease            Duration `json:"lease,omitempty"            yaml:"lease,omitempty"`
+
+	// Store is a DSN whose scheme selects a store registered with
+	// RegisterStore, e.g. "redis://localhost:6379/0". StoreNamespace
+	// enables WithStoreNamespace.
+	Store           string   `json:"store,omitempty"           yaml:"store,omitempty"`
+	StoreNamespace  string   `json:"storeNamespace,omitempty"  yaml:"storeNamespace,omitempty"`
+	FailOpen        bool     `json:"failOpen,omitempty"        yaml:"failOpen,omitempty"`
+	ReadTimeout     Duration `json:"readTimeout,omitempty"     yaml:"readTimeout,omitempty"`
+	WriteTimeout    Duration `json:"writeTimeout,omitempty"    yaml:"writeTimeout,omitempty"`
+	CompactInterval Duration `json:"compactInterval,omitempty" yaml:"compactInterval,omitempty"`
+
+	// AsyncQueueSize enables WithAsyncWrites. AsyncOverflow is "block",
+	// "write-through" or "drop".
+	AsyncQueueSize     int      `json:"asyncQueueSize,omitempty"     yaml:"asyncQueueSize,omitempty"`
+	AsyncBatchSize     int      `json:"asyncBatchSize,omitempty"     yaml:"asyncBatchSize,omitempty"`
+	AsyncFlushInterval Duration `json:"asyncFlushInterval,omitempty" yaml:"asyncFlushInterval,omitempty"`
+	AsyncOverflow      string   `json:"asyncOverflow,omitempty"      yaml:"asyncOverflow,omitempty"`
+
+	// WatchdogThreshold enables WithWatchdog. StuckPolicy is "report" or
+	// "release".
+	WatchdogThreshold Duration `json:"watchdogThreshold,omitempty" yaml:"watchdogThreshold,omitempty"`
+	StuckPolicy       string   `json:"stuckPolicy,omitempty"       yaml:"stuckPolicy,omitempty"`
+
+	// Methods overrides the configuration per HTTP method; see
+	// WithMethodOptions. They can't set Store or Methods.
+	Methods map[string]Config `json:"methods,omitempty" yaml:"methods,omitempty"`
+}
+
+// Duration is a time.Duration written as a string such as "90s" or "6h".
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+
+	return nil
+}
+
+// StoreOpener creates a Store from a DSN.
+type StoreOpener func(dsn string) (Store, error)
+
+var (
+	ErrInvalidConfig = errors.New("invalid configuration")
+
+	storeOpeners   = map[string]StoreOpener{}
+	storeOpenersMu sync.RWMutex
+)
+
+// RegisterStore makes a Store implementation available to Config.Store for
+// DSNs with the given scheme. Store packages typically call it from init.
+func RegisterStore(scheme string, opener StoreOpener) {
+	storeOpenersMu.Lock()
+	defer storeOpenersMu.Unlock()
+
+	storeOpeners[scheme] = opener
+}
+
+// FromConfig converts c to options for NewPotency or Reconfigure.
+func FromConfig(c Config) ([]Option, error) {
+	opts := []Option{}
+
+	if c.Lifetime > 0 {
+		opts = append(opts, WithLifetime(time.Duration(c.Lifetime)))
+	}
+
+	if c.ErrorLifetime > 0 {
+		opts = append(opts, WithErrorLifetime(time.Duration(c.ErrorLifetime)))
+	}
+
+	if c.LifetimeJitter > 0 {
+		opts = append(opts, WithLifetimeJitter(c.LifetimeJitter))
+	}
+
+	if c.StrictWindow > 0 {
+		opts = append(opts, WithStrictWindow(time.Duration(c.StrictWindow)))
+	}
+
+	if c.TombstoneStatus != 0 && (c.TombstoneStatus < 400 || c.TombstoneStatus > 599) {
+		return nil, fmt.Errorf("tombstoneStatus %d (%w)", c.TombstoneStatus, ErrInvalidConfig)
+	}
+
+	if c.Tombstones > 0 {
+		opts = append(opts, WithTombstones(time.Duration(c.Tombstones), c.TombstoneStatus))
+	}
+
+	switch c.KeyParsing {
+	case "", "lenient":
+	case "strict":
+		opts = append(opts, WithKeyParsing(KeyStrict))
+	default:
+		return nil, fmt.Errorf("keyParsing %q (%w)", c.KeyParsing, ErrInvalidConfig)
+	}
+
+	if c.MinKeyLength > 0 || c.MinKeyEntropy > 0 {
+		opts = append(opts, WithKeyPolicy(c.MinKeyLength, c.MinKeyEntropy))
+	}
+
+	if c.KeyHeader != "" {
+		opts = append(opts, WithKeyExtractor(KeyFromHeader(c.KeyHeader)))
+	}
+
+	if c.IdentityHeaders != nil {
+		opts = append(opts, WithIdentityHeaders(c.IdentityHeaders...))
+	}
+
+	if c.IdentityHeadersExcluded != nil {
+		opts = append(opts, WithIdentityHeadersExcluded(c.IdentityHeadersExcluded...))
+	}
+
+	if c.IdentityDigest {
+		opts = append(opts, WithIdentityDigest(c.IdentityDigestKeepFields))
+	}
+
+	switch c.ForwardedIdentity {
+	case "":
+	case "ignore":
+		opts = append(opts, WithForwardedIdentity(ForwardedIgnore))
+	case "client-ip":
+		opts = append(opts, WithForwardedIdentity(ForwardedClientIP))
+	case "headers":
+		opts = append(opts, WithForwardedIdentity(ForwardedHeaders))
+	default:
+		return nil, fmt.Errorf("forwardedIdentity %q (%w)", c.ForwardedIdentity, ErrInvalidConfig)
+	}
+
+	if c.BypassMethods != nil {
+		opts = append(opts, WithBypassMethods(c.BypassMethods...))
+	}
+
+	if c.StreamingContentTypes != nil {
+		opts = append(opts, WithStreamingContentTypes(c.StreamingContentTypes...))
+	}
+
+	if c.ScrubbedHeaders != nil {
+		opts = append(opts, WithScrubbedHeaders(c.ScrubbedHeaders...))
+	}
+
+	if c.CacheControlNoStore {
+		opts = append(opts, WithCacheControlNoStore())
+	}
+
+	if c.SkipUnwritten {
+		opts = append(opts, WithSkipUnwritten())
+	}
+
+	if c.ReceiptThreshold > 0 {
+		opts = append(opts, WithReceipts(c.ReceiptThreshold))
+	}
+
+	if c.StatusOnly {
+		opts = append(opts, WithStatusOnly())
+	}
+
+	if c.StrictResponses {
+		opts = append(opts, WithStrictResponses(nil))
+	}
+
+	if c.CacheStatus {
+		opts = append(opts, WithCacheStatus())
+	}
+
+	if c.Conformance {
+		opts = append(opts, WithConformance(c.ProblemType))
+	}
+
+	if c.MaxRequestBodySize > 0 {
+		opts = append(opts, WithMaxRequestBodySize(c.MaxRequestBodySize))
+	}
+
+	switch c.OversizePolicy {
+	case "":
+	case "reject":
+		opts = append(opts, WithOversizePolicy(OversizeReject))
+	case "bypass":
+		opts = append(opts, WithOversizePolicy(OversizeBypass))
+	default:
+		return nil, fmt.Errorf("oversizePolicy %q (%w)", c.OversizePolicy, ErrInvalidConfig)
+	}
+
+	if c.RequestBodyBuffering > 0 {
+		opts = append(opts, WithRequestBodyBuffering(c.RequestBodyBuffering))
+	}
+
+	if c.MaxBytes > 0 {
+		opts = append(opts, WithMaxBytes(c.MaxBytes))
+	}
+
+	switch c.EvictionPolicy {
+	case "", "fifo":
+	case "lru":
+		opts = append(opts, WithEvictionPolicy(EvictionLRU))
+	default:
+		return nil, fmt.Errorf("evictionPolicy %q (%w)", c.EvictionPolicy, ErrInvalidConfig)
+	}
+
+	if c.MaxReplays > 0 {
+		opts = append(opts, WithMaxReplays(c.MaxReplays))
+	}
+
+	for _, mediaType := range c.BodyCompression {
+		opts = append(opts, WithBodyCompression(mediaType, nil))
+	}
+
+	if c.PrincipalQuota > 0 {
+		policy := QuotaReject
+
+		switch c.QuotaPolicy {
+		case "", "reject":
+		case "evict-oldest":
+			policy = QuotaEvictOldest
+		default:
+			return nil, fmt.Errorf("quotaPolicy %q (%w)", c.QuotaPolicy, ErrInvalidConfig)
+		}
+
+		opts = append(opts, WithPrincipalQuota(c.PrincipalQuota, policy))
+	}
+
+	if len(c.Provenance) > 0 {
+		fields := Provenance(0)
+
+		for _, field := range c.Provenance {
+			switch field {
+			case "client-ip":
+				fields |= ProvenanceClientIP
+			case "user-agent":
+				fields |= ProvenanceUserAgent
+			default:
+				return nil, fmt.Errorf("provenance %q (%w)", field, ErrInvalidConfig)
+			}
+		}
+
+		opts = append(opts, WithProvenance(fields))
+	}
+
+	if c.ExecutionRateLimit > 0 {
+		burst := c.ExecutionRateBurst
+		if burst <= 0 {
+			burst = 1
+		}
+
+		opts = append(opts, WithExecutionRateLimit(c.ExecutionRateLimit, burst, nil))
+	}
+
+	switch c.ConflictPolicy {
+	case "":
+	case "error":
+		opts = append(opts, WithConflictPolicy(ConflictError))
+	case "wait":
+		opts = append(opts, WithConflictPolicy(ConflictWait))
+	case "proxy":
+		opts = append(opts, WithConflictPolicy(ConflictProxy))
+	default:
+		return nil, fmt.Errorf("conflictPolicy %q (%w)", c.ConflictPolicy, ErrInvalidConfig)
+	}
+
+	if c.ConflictStatus != 0 {
+		if c.ConflictStatus < 400 || c.ConflictStatus > 599 {
+			return nil, fmt.Errorf("conflictStatus %d (%w)", c.ConflictStatus, ErrInvalidConfig)
+		}
+
+		opts = append(opts, WithConflictStatus(c.ConflictStatus))
+	}
+
+	if c.MaxWait > 0 {
+		opts = append(opts, WithMaxWait(time.Duration(c.MaxWait)))
+	}
+
+	if c.Lease > 0 {
+		opts = append(opts, WithLease(time.Duration(c.Lease)))
+	}
+
+	if c.WaitWhileSending {
+		opts = append(opts, WithWaitWhileSending())
+	}
+
+	if c.Store != "" {
+		store, err := openStore(c.Store)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, WithStore(store))
+	}
+
+	if c.StoreNamespace != "" {
+		opts = append(opts, WithStoreNamespace(c.StoreNamespace))
+	}
+
+	if c.FailOpen {
+		opts = append(opts, WithFailOpen(true))
+	}
+
+	if c.ReadTimeout > 0 {
+		opts = append(opts, WithReadTimeout(time.Duration(c.ReadTimeout)))
+	}
+
+	if c.WriteTimeout > 0 {
+		opts = append(opts, WithWriteTimeout(time.Duration(c.WriteTimeout)))
+	}
+
+	if c.CompactInterval > 0 {
+		opts = append(opts, WithCompaction(time.Duration(c.CompactInterval)))
+	}
+
+	if c.AsyncQueueSize > 0 {
+		policy := OverflowBlock
+
+		switch c.AsyncOverflow {
+		case "", "block":
+		case "write-through":
+			policy = OverflowWriteThrough
+		case "drop":
+			policy = OverflowDrop
+		default:
+			return nil, fmt.Errorf("asyncOverflow %q (%w)", c.AsyncOverflow, ErrInvalidConfig)
+		}
+
+		opts = append(opts, WithAsyncWrites(c.AsyncQueueSize, c.AsyncBatchSize, time.Duration(c.AsyncFlushInterval), policy))
+	}
+
+	if c.WatchdogThreshold > 0 {
+		policy := StuckReport
+
+		switch c.StuckPolicy {
+		case "", "report":
+		case "release":
+			policy = StuckRelease
+		default:
+			return nil, fmt.Errorf("stuckPolicy %q (%w)", c.StuckPolicy, ErrInvalidConfig)
+		}
+
+		opts = append(opts, WithWatchdog(time.Duration(c.WatchdogThreshold), policy, nil))
+	}
+
+	for method, mc := range c.Methods {
+		if mc.Store != "" || mc.Methods != nil {
+			return nil, fmt.Errorf("methods %s: store or methods (%w)", method, ErrInvalidConfig)
+		}
+
+		methodOpts, err := FromConfig(mc)
+		if err != nil {
+			return nil, fmt.Errorf("methods %s: %w", method, err)
+		}
+
+		opts = append(opts, WithMethodOptions(method, methodOpts...))
+	}
+
+	return opts, nil
+}
+
+func openStore(dsn string) (Store, error) {
+	scheme, _, ok := strings.Cut(dsn, ":")
+	if !ok {
+		return nil, fmt.Errorf("store %q: missing scheme (%w)", dsn, ErrInvalidConfig)
+	}
+
+	storeOpenersMu.RLock()
+	opener := storeOpeners[scheme]
+	storeOpenersMu.RUnlock()
+
+	if opener == nil {
+		return nil, fmt.Errorf("store %q: unknown scheme %q (%w)", dsn, scheme, ErrInvalidConfig)
+	}
+
+	store, err := opener(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("store %q: %s (%w)", dsn, err, ErrStore)
+	}
+
+	return store, nil
+}
@@ -0,0 +1,97 @@
+package potency_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromConfig(t *testing.T) {
+	t.Parallel()
+
+	store := newTestStore()
+
+	potency.RegisterStore("test-from-config", func(dsn string) (potency.Store, error) {
+		require.Equal(t, "test-from-config://somewhere", dsn)
+		return store, nil
+	})
+
+	c := potency.Config{}
+
+	err := json.Unmarshal([]byte(`{
+		"lifetime": "1h",
+		"keyHeader": "X-Delivery",
+		"maxBytes": 1000000,
+		"store": "test-from-config://somewhere"
+	}`), &c)
+	require.NoError(t, err)
+
+	opts, err := potency.FromConfig(c)
+	require.NoError(t, err)
+
+	ts := newTestServer(t, opts...)
+	defer ts.shutdown(t)
+
+	key := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("X-Delivery", key).
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	resp, err = ts.r().
+		SetHeader("X-Delivery", key).
+		Post("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+	require.Equal(t, resp1, resp.String())
+
+	store.mu.Lock()
+	require.Contains(t, store.entries, key)
+	store.mu.Unlock()
+}
+
+func TestFromConfigInvalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := potency.FromConfig(potency.Config{OversizePolicy: "drop"})
+	require.ErrorIs(t, err, potency.ErrInvalidConfig)
+
+	_, err = potency.FromConfig(potency.Config{KeyParsing: "loose"})
+	require.ErrorIs(t, err, potency.ErrInvalidConfig)
+
+	_, err = potency.FromConfig(potency.Config{Tombstones: potency.Duration(time.Minute), TombstoneStatus: 200})
+	require.ErrorIs(t, err, potency.ErrInvalidConfig)
+
+	_, err = potency.FromConfig(potency.Config{Methods: map[string]potency.Config{"POST": {ConflictPolicy: "queue"}}})
+	require.ErrorIs(t, err, potency.ErrInvalidConfig)
+
+	_, err = potency.FromConfig(potency.Config{Methods: map[string]potency.Config{"POST": {Store: "test://x"}}})
+	require.ErrorIs(t, err, potency.ErrInvalidConfig)
+
+	_, err = potency.FromConfig(potency.Config{EvictionPolicy: "random"})
+	require.ErrorIs(t, err, potency.ErrInvalidConfig)
+
+	_, err = potency.FromConfig(potency.Config{Provenance: []string{"client-ip", "cookie"}})
+	require.ErrorIs(t, err, potency.ErrInvalidConfig)
+
+	_, err = potency.FromConfig(potency.Config{Store: "nosuchscheme://x"})
+	require.ErrorIs(t, err, potency.ErrInvalidConfig)
+
+	_, err = potency.FromConfig(potency.Config{AsyncQueueSize: 10, AsyncOverflow: "spill"})
+	require.ErrorIs(t, err, potency.ErrInvalidConfig)
+
+	_, err = potency.FromConfig(potency.Config{WatchdogThreshold: potency.Duration(time.Minute), StuckPolicy: "kill"})
+	require.ErrorIs(t, err, potency.ErrInvalidConfig)
+
+	c := potency.Config{}
+	require.Error(t, json.Unmarshal([]byte(`{"lifetime": "forever"}`), &c))
+}
@@ -0,0 +1,168 @@
+package potency_test
+
+// Native Go fuzz targets for the code that parses attacker-controlled input
+// on every request. OSS-Fuzz builds them with compile_native_go_fuzzer; run
+// one locally with e.g.:
+//
+//	go test -run=^$ -fuzz=FuzzKeyHeader -fuzztime=1m .
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+)
+
+func newFuzzPotency(opts ...potency.Option) *potency.Potency {
+	return potency.NewPotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(uniuri.New()))
+	}), opts...)
+}
+
+func fuzzServe(p *potency.Potency, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+
+	return rec
+}
+
+func FuzzKeyHeader(f *testing.F) {
+	for _, seed := range []string{`"abc"`, `abc`, `"`, `""`, `"a"b"`, "\"\x00\"", `"` + strings.Repeat("k", 300) + `"`} {
+		f.Add(seed)
+	}
+
+	p := newFuzzPotency()
+
+	f.Fuzz(func(t *testing.T, key string) {
+		post := func() *httptest.ResponseRecorder {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.Header.Set("Idempotency-Key", key)
+
+			return fuzzServe(p, r)
+		}
+
+		rec1 := post()
+
+		if key == "" {
+			// No key: passed straight through
+			return
+		}
+
+		switch rec1.Code {
+		case http.StatusOK:
+		case http.StatusBadRequest:
+			return
+		default:
+			t.Fatalf("key %q: status %d", key, rec1.Code)
+		}
+
+		rec2 := post()
+		if rec2.Code != http.StatusOK || rec2.Body.String() != rec1.Body.String() {
+			t.Fatalf("key %q: retry got %d %q, want replay of %q", key, rec2.Code, rec2.Body.String(), rec1.Body.String())
+		}
+	})
+}
+
+func FuzzURLIdentity(f *testing.F) {
+	for _, seed := range []string{"/", "/a/b?c=d", "/%2F?x", "/a/../b", "//host/path", "/?a=1&a=2", "/%zz"} {
+		f.Add(seed, seed+"x")
+	}
+
+	ps := []*potency.Potency{
+		newFuzzPotency(),
+		newFuzzPotency(potency.WithURLNormalizer(potency.OriginalURL)),
+	}
+
+	f.Fuzz(func(t *testing.T, target1, target2 string) {
+		r1 := fuzzRequest(target1)
+		r2 := fuzzRequest(target2)
+
+		if r1 == nil || r2 == nil {
+			return
+		}
+
+		for _, p := range ps {
+			key := `"` + uniuri.New() + `"`
+
+			r1.Header.Set("Idempotency-Key", key)
+			r2.Header.Set("Idempotency-Key", key)
+
+			rec1 := fuzzServe(p, r1.Clone(r1.Context()))
+			if rec1.Code != http.StatusOK {
+				t.Fatalf("%q: status %d", target1, rec1.Code)
+			}
+
+			rec := fuzzServe(p, r1.Clone(r1.Context()))
+			if rec.Code != http.StatusOK || rec.Body.String() != rec1.Body.String() {
+				t.Fatalf("%q: retry got %d, want replay", target1, rec.Code)
+			}
+
+			rec = fuzzServe(p, r2.Clone(r2.Context()))
+			if rec.Code != http.StatusOK && rec.Code != http.StatusBadRequest {
+				t.Fatalf("%q after %q: status %d", target2, target1, rec.Code)
+			}
+		}
+	})
+}
+
+// fuzzRequest builds a request for target as net/http's server would, or
+// returns nil if the server would reject it.
+func fuzzRequest(target string) *http.Request {
+	u, err := url.ParseRequestURI(target)
+	if err != nil {
+		return nil
+	}
+
+	return &http.Request{
+		Method:     http.MethodPost,
+		URL:        u,
+		RequestURI: target,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Host:       "example.com",
+		RemoteAddr: "192.0.2.1:1234",
+	}
+}
+
+func FuzzHeaderIdentity(f *testing.F) {
+	f.Add("application/json", "application/json", "192.0.2.1", "for=192.0.2.1")
+	f.Add("text/plain", "text/plain;q=1", "10.0.0.1, 10.0.0.2", `for="[2001:db8::1]:80"`)
+	f.Add("", "", "", "for=")
+
+	ps := []*potency.Potency{
+		newFuzzPotency(),
+		newFuzzPotency(potency.WithForwardedIdentity(potency.ForwardedClientIP)),
+	}
+
+	f.Fuzz(func(t *testing.T, accept1, accept2, xff, forwarded string) {
+		for _, p := range ps {
+			key := `"` + uniuri.New() + `"`
+
+			post := func(accept string) *httptest.ResponseRecorder {
+				r := httptest.NewRequest(http.MethodPost, "/", nil)
+				r.Header.Set("Idempotency-Key", key)
+				r.Header.Set("Accept", accept)
+				r.Header.Set("X-Forwarded-For", xff)
+				r.Header.Set("Forwarded", forwarded)
+
+				return fuzzServe(p, r)
+			}
+
+			rec1 := post(accept1)
+			if rec1.Code != http.StatusOK {
+				t.Fatalf("status %d", rec1.Code)
+			}
+
+			rec2 := post(accept2)
+
+			replayed := rec2.Code == http.StatusOK && rec2.Body.String() == rec1.Body.String()
+			if replayed != (accept1 == accept2) {
+				t.Fatalf("Accept %q then %q: replayed %t", accept1, accept2, replayed)
+			}
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package potency
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WithStrictWindow limits strict deduplication to d after a result is
+// saved. Within d, a request that reuses a key with a different request is
+// rejected as a mismatch. After d, until the lifetime ends, the result is
+// only replayed to exact retries; a different request executes normally and
+// replaces it. This suits clients that legitimately reuse keys after a day.
+// Zero (the default) is strict for the whole lifetime. Outside the window,
+// request bodies are buffered in memory while they are compared, up to
+// WithMaxRequestBodySize.
+func WithStrictWindow(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.strictWindow = d
+	}
+}
+
+// strict reports whether a mismatch with sr is an error.
+func (cfg *config) strict(sr *SavedResult) bool {
+	return cfg.strictWindow <= 0 || time.Since(sr.Added) < cfg.strictWindow
+}
+
+// teeBody records what is read from r.Body and returns a function that
+// rewinds r.Body to its start.
+func teeBody(r *http.Request) func() {
+	body := r.Body
+	if body == nil {
+		return func() {}
+	}
+
+	buf := &bytes.Buffer{}
+
+	r.Body = readCloser{
+		Reader: io.TeeReader(body, buf),
+		Closer: body,
+	}
+
+	return func() {
+		r.Body = readCloser{
+			Reader: io.MultiReader(buf, body),
+			Closer: body,
+		}
+	}
+}
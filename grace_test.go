@@ -0,0 +1,60 @@
+package potency_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrictWindow(t *testing.T) {
+	t.Parallel()
+
+	store := newTestStore()
+
+	ts := newTestServer(t, potency.WithStrictWindow(50*time.Millisecond), potency.WithStore(store))
+	defer ts.shutdown(t)
+
+	key := uniuri.New()
+
+	post := func(body string) (int, string) {
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", `"`+key+`"`).
+			SetBody(body).
+			Post("/")
+		require.NoError(t, err)
+
+		return resp.StatusCode(), resp.String()
+	}
+
+	status, a1 := post("a")
+	require.Equal(t, http.StatusOK, status)
+
+	status, _ = post("b")
+	require.Equal(t, http.StatusBadRequest, status)
+
+	time.Sleep(60 * time.Millisecond)
+
+	// Exact retries still replay
+	status, a2 := post("a")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, a1, a2)
+
+	// A different request executes and replaces the result
+	status, b1 := post("b")
+	require.Equal(t, http.StatusOK, status)
+	require.NotEqual(t, a1, b1)
+
+	status, b2 := post("b")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, b1, b2)
+
+	status, _ = post("a")
+	require.Equal(t, http.StatusBadRequest, status)
+
+	sr := mustLookup(t, ts.pot, key)
+	require.Equal(t, b1, string(sr.ResponseBody))
+}
@@ -0,0 +1,49 @@
+package potency_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHEAD(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Head("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+	require.Empty(t, resp.Body())
+
+	contentLength := resp.Header().Get("Content-Length")
+	require.NotEmpty(t, contentLength)
+
+	sr := mustLookup(t, ts.pot, key1)
+	require.Empty(t, sr.ResponseBody)
+	require.Equal(t, contentLength, sr.ResponseHeader.Get("Content-Length"))
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Head("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+	require.Equal(t, "true", resp.Header().Get(potency.ReplayedHeader))
+	require.Equal(t, contentLength, resp.Header().Get("Content-Length"))
+	require.Empty(t, resp.Body())
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Get("")
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+}
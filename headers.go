@@ -0,0 +1,103 @@
+package potency
+
+import (
+	"net/http"
+	"net/textproto"
+	"path"
+	"sort"
+	"strings"
+)
+
+// WithIdentityHeaders replaces the request headers (default Accept,
+// Authorization and Content-Type) that must match on replay. Patterns are
+// case-insensitive and may use path.Match wildcards, e.g. "X-App-*". To stop
+// checking one of the defaults, use WithIdentityHeadersExcluded.
+func WithIdentityHeaders(patterns ...string) Option {
+	return func(cfg *config) {
+		cfg.identityHeaders = canonicalPatterns(patterns)
+	}
+}
+
+// WithIdentityHeadersExcluded removes headers matching any of patterns from
+// the identity headers, e.g. "X-App-Request-Id".
+func WithIdentityHeadersExcluded(patterns ...string) Option {
+	return func(cfg *config) {
+		cfg.identityHeadersExcluded = canonicalPatterns(patterns)
+	}
+}
+
+func canonicalPatterns(patterns []string) []string {
+	ret := []string{}
+
+	for _, pattern := range patterns {
+		ret = append(ret, textproto.CanonicalMIMEHeaderKey(pattern))
+	}
+
+	return ret
+}
+
+func (cfg *config) isIdentityHeader(name string) bool {
+	name = textproto.CanonicalMIMEHeaderKey(name)
+
+	if cfg.scopeByPrincipal && name == "Authorization" {
+		return false
+	}
+
+	if cfg.forwardedPolicy != ForwardedHeaders && isForwardedHeader(name) {
+		return false
+	}
+
+	return matchAny(cfg.identityHeaders, name) && !matchAny(cfg.identityHeadersExcluded, name)
+}
+
+// identityHeader returns the headers of r that are part of the request
+// identity.
+func (cfg *config) identityHeader(r *http.Request) http.Header {
+	ret := http.Header{}
+
+	for name, vals := range r.Header {
+		if cfg.isIdentityHeader(name) {
+			ret[textproto.CanonicalMIMEHeaderKey(name)] = append([]string(nil), vals...)
+		}
+	}
+
+	cfg.forwardedIdentity(r, ret)
+
+	return ret
+}
+
+// headerMismatch returns the first identity header that differs between
+// saved and current, or "" if they match. Absent and empty headers are equal.
+func headerMismatch(saved, current http.Header) string {
+	names := []string{}
+
+	for name := range saved {
+		names = append(names, name)
+	}
+
+	for name := range current {
+		if _, found := saved[name]; !found {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if strings.Join(saved.Values(name), ",") != strings.Join(current.Values(name), ",") {
+			return name
+		}
+	}
+
+	return ""
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,109 @@
+package potency_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentityHeaders(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t,
+		potency.WithIdentityHeaders("x-app-*", "Accept"),
+		potency.WithIdentityHeadersExcluded("X-App-Request-Id"),
+	)
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("X-App-Tenant", "a").
+		SetHeader("X-App-Request-Id", "1").
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	// Excluded and unlisted headers may change
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("X-App-Tenant", "a").
+		SetHeader("X-App-Request-Id", "2").
+		SetHeader("Authorization", "Bearer xyz").
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, resp1, resp.String())
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("X-App-Tenant", "b").
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+	require.Contains(t, resp.String(), potency.ErrHeaderMismatch.Error())
+
+	// Headers matching a pattern that were absent originally must stay absent
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("X-App-Tenant", "a").
+		SetHeader("X-App-Region", "eu").
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+	require.Contains(t, resp.String(), "X-App-Region")
+}
+
+func TestIdentityContentType(t *testing.T) {
+	t.Parallel()
+
+	for _, exclude := range []bool{false, true} {
+		opts := []potency.Option{}
+		if exclude {
+			opts = append(opts, potency.WithIdentityHeadersExcluded("Content-Type"))
+		}
+
+		ts := newTestServer(t, opts...)
+
+		key1 := uniuri.New()
+
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+			SetHeader("Accept", "*/*").
+			SetHeader("Content-Type", "application/json").
+			SetBody(`{"a":1}`).
+			Post("")
+		require.NoError(t, err)
+		require.False(t, resp.IsError())
+
+		resp1 := resp.String()
+
+		resp, err = ts.r().
+			SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+			SetHeader("Accept", "*/*").
+			SetHeader("Content-Type", "application/x-www-form-urlencoded").
+			SetBody(`{"a":1}`).
+			Post("")
+		require.NoError(t, err)
+
+		if exclude {
+			require.False(t, resp.IsError())
+			require.Equal(t, resp1, resp.String())
+		} else {
+			require.True(t, resp.IsError())
+			require.Contains(t, resp.String(), "Content-Type")
+		}
+
+		ts.shutdown(t)
+	}
+}
@@ -0,0 +1,68 @@
+package potency
+
+import (
+	"sort"
+	"time"
+)
+
+// Execution describes a key that is currently executing.
+type Execution struct {
+	Key string
+
+	// Token is the execution's fencing token.
+	Token uint64
+
+	Started time.Time
+
+	// Deadline is when the lease ends (see WithLease), or zero.
+	Deadline time.Time
+
+	// Method and Path summarize the request that holds the key. Method is
+	// "DO" for Do, and both are empty for Reserve.
+	Method string
+	Path   string
+
+	RequestID string
+
+	// Sending is true once the handler has committed a response that will
+	// be stored.
+	Sending bool
+}
+
+type execSummary struct {
+	method    string
+	path      string
+	requestID string
+}
+
+// InProgress returns the keys currently executing on this instance, oldest
+// first, e.g. to find handlers stuck holding a reservation.
+func (p *Potency) InProgress() []Execution {
+	p.inProgressMu.Lock()
+	defer p.inProgressMu.Unlock()
+
+	ret := make([]Execution, 0, len(p.inProgress))
+
+	for key, exec := range p.inProgress {
+		ret = append(ret, exec.describe(key))
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Started.Before(ret[j].Started)
+	})
+
+	return ret
+}
+
+func (exec *execution) describe(key string) Execution {
+	return Execution{
+		Key:       key,
+		Token:     exec.token,
+		Started:   exec.started,
+		Deadline:  exec.deadline,
+		Method:    exec.summary.method,
+		Path:      exec.summary.path,
+		RequestID: exec.summary.requestID,
+		Sending:   exec.isSending(),
+	}
+}
@@ -0,0 +1,60 @@
+package potency_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInProgress(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	p := potency.NewPotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	require.Empty(t, p.InProgress())
+
+	key := uniuri.New()
+
+	req := httptest.NewRequest(http.MethodPost, "/orders?token=secret", nil)
+	req.Header.Set("Idempotency-Key", `"`+key+`"`)
+	req.Header.Set("X-Request-Id", "req-1")
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		p.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	<-started
+
+	res, err := p.Reserve(uniuri.New())
+	require.NoError(t, err)
+
+	execs := p.InProgress()
+	require.Len(t, execs, 2)
+	require.Equal(t, key, execs[0].Key)
+	require.Equal(t, http.MethodPost, execs[0].Method)
+	require.Equal(t, "/orders", execs[0].Path)
+	require.Equal(t, "req-1", execs[0].RequestID)
+	require.False(t, execs[0].Sending)
+	require.NotZero(t, execs[0].Token)
+	require.False(t, execs[0].Started.After(execs[1].Started))
+	require.Empty(t, execs[1].Method)
+
+	res.Release()
+	close(release)
+	<-done
+
+	require.Empty(t, p.InProgress())
+}
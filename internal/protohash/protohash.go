@@ -0,0 +1,22 @@
+// Package protohash fingerprints protobuf request messages for the RPC
+// integrations (potencygrpc and potencyconnect).
+package protohash
+
+import (
+	"crypto/sha256"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Fingerprint returns the SHA-256 of msg's deterministic encoding, for
+// SavedResult.BodyHash.
+func Fingerprint(msg proto.Message) ([]byte, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return sum[:], nil
+}
@@ -0,0 +1,36 @@
+package potency
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+)
+
+// WithLifetimeJitter spreads each entry's lifetime by up to ±fraction (e.g.
+// 0.1 for ±10%) so that a burst of saves doesn't expire all at once. The
+// offset is derived from the key, so every instance and store agrees on when
+// a given entry expires.
+func WithLifetimeJitter(fraction float64) Option {
+	return func(cfg *config) {
+		cfg.lifetimeJitter = fraction
+	}
+}
+
+// expiresAt returns when sr outlives its (jittered) lifetime. Requires
+// cacheMu.
+func (p *Potency) expiresAt(sr *SavedResult) time.Time {
+	return sr.Added.Add(jitter(p.cfg.lifetime, sr.Key, p.cfg.lifetimeJitter))
+}
+
+func jitter(d time.Duration, key string, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
+	}
+
+	sum := sha256.Sum256([]byte(key))
+
+	// Map the hash onto [-1, 1).
+	offset := float64(binary.BigEndian.Uint64(sum[:]))/(1<<63) - 1
+
+	return d + time.Duration(float64(d)*fraction*offset)
+}
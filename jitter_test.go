@@ -0,0 +1,46 @@
+package potency_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifetimeJitter(t *testing.T) {
+	t.Parallel()
+
+	entries := func() []*potency.SavedResult {
+		ret := []*potency.SavedResult{}
+
+		for i := 0; i < 100; i++ {
+			ret = append(ret, &potency.SavedResult{
+				Key:   fmt.Sprintf("key-%d", i),
+				Added: time.Now().Add(-6 * time.Hour),
+			})
+		}
+
+		return ret
+	}
+
+	ts1 := newTestServer(t)
+	defer ts1.shutdown(t)
+
+	ts1.pot.Preload(entries())
+	require.Equal(t, 0, ts1.pot.NumCached())
+
+	ts2 := newTestServer(t, potency.WithLifetimeJitter(0.5))
+	defer ts2.shutdown(t)
+
+	ts2.pot.Preload(entries())
+	require.Greater(t, ts2.pot.NumCached(), 25)
+	require.Less(t, ts2.pot.NumCached(), 75)
+
+	ts3 := newTestServer(t, potency.WithLifetimeJitter(0.5))
+	defer ts3.shutdown(t)
+
+	ts3.pot.Preload(entries())
+	require.Equal(t, ts2.pot.NumCached(), ts3.pot.NumCached())
+}
@@ -0,0 +1,59 @@
+package potency
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+var ErrWeakKey = errors.New("idempotency key too guessable")
+
+// WithKeyPolicy rejects keys shorter than minLength characters or with less
+// than minEntropy bits of estimated entropy, as invalid keys. In deployments
+// without WithPrincipalScope, a client that guesses another's key (e.g.
+// "1") is served their saved response. The estimate is the key's length
+// times the Shannon entropy of its characters, so it is an upper bound: a
+// random UUID scores about 130 bits, "order-42" 22 and "aaaa" 0. Zero
+// disables either check.
+func WithKeyPolicy(minLength int, minEntropy float64) Option {
+	return func(cfg *config) {
+		cfg.minKeyLength = minLength
+		cfg.minKeyEntropy = minEntropy
+	}
+}
+
+// KeyEntropy estimates the entropy of key in bits, as used by
+// WithKeyPolicy.
+func KeyEntropy(key string) float64 {
+	counts := map[rune]int{}
+	n := 0
+
+	for _, c := range key {
+		counts[c]++
+		n++
+	}
+
+	perChar := 0.0
+
+	for _, count := range counts {
+		p := float64(count) / float64(n)
+		perChar -= p * math.Log2(p)
+	}
+
+	return perChar * float64(n)
+}
+
+func (cfg *config) checkKeyPolicy(key string) error {
+	if n := utf8.RuneCountInString(key); n < cfg.minKeyLength {
+		return &InvalidKeyError{Key: key, cause: fmt.Errorf("%d < %d characters (%w)", n, cfg.minKeyLength, ErrWeakKey)}
+	}
+
+	if cfg.minKeyEntropy > 0 {
+		if bits := KeyEntropy(key); bits < cfg.minKeyEntropy {
+			return &InvalidKeyError{Key: key, cause: fmt.Errorf("%.1f < %.1f bits (%w)", bits, cfg.minKeyEntropy, ErrWeakKey)}
+		}
+	}
+
+	return nil
+}
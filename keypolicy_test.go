@@ -0,0 +1,42 @@
+package potency_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyPolicy(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithKeyPolicy(8, 64))
+	defer ts.shutdown(t)
+
+	for _, key := range []string{"1", "order-42", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"} {
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", `"`+key+`"`).
+			Post("/")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode(), key)
+		require.Contains(t, resp.String(), "guessable", key)
+	}
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", `"`+uniuri.NewLen(36)+`"`).
+		Post("/")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+}
+
+func TestKeyEntropy(t *testing.T) {
+	t.Parallel()
+
+	require.Zero(t, potency.KeyEntropy(""))
+	require.Zero(t, potency.KeyEntropy("aaaa"))
+	require.InDelta(t, 2, potency.KeyEntropy("ab"), 0.001)
+	require.InDelta(t, 22, potency.KeyEntropy("order-42"), 0.001)
+	require.Greater(t, potency.KeyEntropy(uniuri.NewLen(36)), 100.0)
+}
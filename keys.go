@@ -0,0 +1,283 @@
+package potency
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gopatchy/jsrest"
+)
+
+// KeyExtractor returns the idempotency key for a request, or "" if the
+// request carries none and should pass straight through. Errors are sent to
+// the client as 400 unless they carry their own jsrest status.
+type KeyExtractor func(r *http.Request) (string, error)
+
+// defaultJSONKeyBodySize is KeyFromJSONField's limit when given none.
+const defaultJSONKeyBodySize = 1 << 20
+
+// WithKeyExtractor replaces the default Idempotency-Key header parsing, e.g.
+// to dedup webhook deliveries by a provider-assigned ID.
+func WithKeyExtractor(extractor KeyExtractor) Option {
+	return func(cfg *config) {
+		cfg.keyExtractor = extractor
+	}
+}
+
+// KeyFromHeader uses the raw (unquoted) value of the named header as the
+// key, e.g. GitHub's X-GitHub-Delivery.
+func KeyFromHeader(name string) KeyExtractor {
+	return func(r *http.Request) (string, error) {
+		return r.Header.Get(name), nil
+	}
+}
+
+// KeyFromJSONField uses a string or number field of a JSON request body as
+// the key, addressed by a dot-separated path (e.g. "id" for Stripe events or
+// "data.object.id"). The body is buffered and restored for the handler.
+// Requests with an empty body or a Content-Type other than application/json
+// (or another +json type) pass through without a key. Bodies over
+// maxBodySize bytes (1 MiB if 0) get 413; pass the WithMaxRequestBodySize
+// limit, if any, so the two agree.
+func KeyFromJSONField(path string, maxBodySize int64) KeyExtractor {
+	fields := strings.Split(path, ".")
+
+	if maxBodySize <= 0 {
+		maxBodySize = defaultJSONKeyBodySize
+	}
+
+	return func(r *http.Request) (string, error) {
+		if !isJSON(r.Header.Get("Content-Type")) {
+			return "", nil
+		}
+
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+		if err != nil {
+			return "", err
+		}
+
+		r.Body = readCloser{
+			Reader: io.MultiReader(bytes.NewReader(data), r.Body),
+			Closer: r.Body,
+		}
+
+		if int64(len(data)) > maxBodySize {
+			return "", jsrest.Errorf(jsrest.ErrRequestEntityTooLarge, "%d > %d (%w)", len(data), maxBodySize, ErrBodyTooLarge)
+		}
+
+		if len(bytes.TrimSpace(data)) == 0 {
+			return "", nil
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+
+		var obj any
+
+		err = dec.Decode(&obj)
+		if err != nil {
+			return "", &InvalidKeyError{cause: err}
+		}
+
+		for _, field := range fields {
+			m, ok := obj.(map[string]any)
+			if !ok {
+				return "", nil
+			}
+
+			obj = m[field]
+		}
+
+		switch val := obj.(type) {
+		case string:
+			return val, nil
+		case json.Number:
+			return val.String(), nil
+		default:
+			return "", nil
+		}
+	}
+}
+
+type KeyParsing int
+
+const (
+	// KeyLenient parses the Idempotency-Key header like other HTTP fields:
+	// whitespace around the quoted key and parameters after it (e.g.
+	// `"abc" ;v=1`, as in RFC 8941) are allowed, and backslash escapes are
+	// decoded. Parameters are ignored.
+	KeyLenient KeyParsing = iota
+
+	// KeyStrict accepts only a quoted string, in which backslash escapes
+	// are decoded.
+	KeyStrict
+)
+
+// WithKeyParsing sets how strictly the Idempotency-Key header is parsed
+// (default KeyLenient). It replaces any key extractor set earlier.
+func WithKeyParsing(parsing KeyParsing) Option {
+	return func(cfg *config) {
+		switch parsing {
+		case KeyStrict:
+			cfg.keyExtractor = strictKeyHeader
+		default:
+			cfg.keyExtractor = idempotencyKeyHeader
+		}
+	}
+}
+
+func idempotencyKeyHeader(r *http.Request) (string, error) {
+	return parseKeyHeader(r, false)
+}
+
+func strictKeyHeader(r *http.Request) (string, error) {
+	val := r.Header.Get("Idempotency-Key")
+	if val == "" {
+		return "", nil
+	}
+
+	// An empty quoted key would otherwise silently disable idempotency
+	key, rest, ok := scanQuoted(val, false)
+	if !ok || key == "" || rest != "" {
+		return "", &InvalidKeyError{Key: val}
+	}
+
+	return key, nil
+}
+
+// parseKeyHeader parses the Idempotency-Key header leniently. sf restricts
+// the key to an RFC 8941 sf-string.
+func parseKeyHeader(r *http.Request, sf bool) (string, error) {
+	val := r.Header.Get("Idempotency-Key")
+	if val == "" {
+		return "", nil
+	}
+
+	key, rest, ok := scanQuoted(strings.TrimLeft(val, " \t"), sf)
+	if !ok || key == "" || !validParams(rest) {
+		return "", &InvalidKeyError{Key: val}
+	}
+
+	return key, nil
+}
+
+// scanQuoted decodes the quoted string at the start of val and returns the
+// rest of val. sf allows only printable ASCII and the \" and \\ escapes, as
+// in an RFC 8941 sf-string; otherwise any byte may be escaped, as in an RFC
+// 9110 quoted-string.
+func scanQuoted(val string, sf bool) (string, string, bool) {
+	if len(val) < 2 || val[0] != '"' {
+		return "", "", false
+	}
+
+	b := strings.Builder{}
+
+	for i := 1; i < len(val); i++ {
+		c := val[i]
+
+		switch {
+		case c == '"':
+			return b.String(), val[i+1:], true
+
+		case c == '\\':
+			i++
+			if i == len(val) || (sf && val[i] != '"' && val[i] != '\\') {
+				return "", "", false
+			}
+
+			b.WriteByte(val[i])
+
+		case sf && (c < 0x20 || c > 0x7e):
+			return "", "", false
+
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", "", false
+}
+
+// validParams reports whether rest is a (possibly empty) list of RFC 8941
+// parameters, e.g. ";v=1;final".
+func validParams(rest string) bool {
+	for {
+		rest = strings.TrimLeft(rest, " \t")
+		if rest == "" {
+			return true
+		}
+
+		if rest[0] != ';' {
+			return false
+		}
+
+		rest = strings.TrimLeft(rest[1:], " ")
+
+		n := 0
+		for n < len(rest) && isParamKeyChar(rest[n], n == 0) {
+			n++
+		}
+
+		if n == 0 {
+			return false
+		}
+
+		rest = rest[n:]
+
+		if !strings.HasPrefix(rest, "=") {
+			continue
+		}
+
+		rest = rest[1:]
+
+		if strings.HasPrefix(rest, `"`) {
+			var ok bool
+
+			_, rest, ok = scanQuoted(rest, true)
+			if !ok {
+				return false
+			}
+
+			continue
+		}
+
+		n = strings.IndexAny(rest, "; \t")
+		if n == -1 {
+			n = len(rest)
+		}
+
+		if n == 0 {
+			return false
+		}
+
+		rest = rest[n:]
+	}
+}
+
+func isParamKeyChar(c byte, first bool) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c == '*':
+		return true
+	case first:
+		return false
+	default:
+		return c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.'
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
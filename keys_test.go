@@ -0,0 +1,251 @@
+package potency_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvalidKey(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", "not-quoted").
+		Post("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode())
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", `""`).
+		Post("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode())
+}
+
+func TestKeyFromJSONField(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithKeyExtractor(potency.KeyFromJSONField("data.id", 0)))
+	defer ts.shutdown(t)
+
+	body := fmt.Sprintf(`{"data": {"id": "%s"}}`, uniuri.New())
+
+	resp, err := ts.r().
+		SetBody(body).
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	resp, err = ts.r().
+		SetBody(body).
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, resp1, resp.String())
+
+	resp, err = ts.r().
+		SetBody(`{"data": {"id": 12345}}`).
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	require.Equal(t, 2, ts.pot.NumCached())
+
+	resp, err = ts.r().
+		SetBody(`{"other": true}`).
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	require.Equal(t, 2, ts.pot.NumCached())
+
+	resp, err = ts.r().
+		SetBody(`{"data":`).
+		Post("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode())
+}
+
+func TestKeyFromJSONFieldPassThrough(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithKeyExtractor(potency.KeyFromJSONField("data.id", 0)))
+	defer ts.shutdown(t)
+
+	// Empty body
+	resp, err := ts.r().
+		SetHeader("Content-Type", "application/json").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	// Not JSON, even if it parses as JSON
+	resp, err = ts.r().
+		SetHeader("Content-Type", "text/plain").
+		SetBody(fmt.Sprintf(`{"data": {"id": "%s"}}`, uniuri.New())).
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp, err = ts.r().
+		SetHeader("Content-Type", "application/x-www-form-urlencoded").
+		SetBody("data.id=1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	require.Equal(t, 0, ts.pot.NumCached())
+
+	// +json types are JSON
+	resp, err = ts.r().
+		SetHeader("Content-Type", "application/cloudevents+json; charset=utf-8").
+		SetBody(fmt.Sprintf(`{"data": {"id": "%s"}}`, uniuri.New())).
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	require.Equal(t, 1, ts.pot.NumCached())
+}
+
+func TestKeyFromJSONFieldSize(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t,
+		potency.WithMaxRequestBodySize(4<<20),
+		potency.WithKeyExtractor(potency.KeyFromJSONField("id", 4<<20)),
+	)
+	defer ts.shutdown(t)
+
+	big := fmt.Sprintf(`{"id": "%s", "pad": "%s"}`, uniuri.New(), strings.Repeat("x", 2<<20))
+
+	resp, err := ts.r().
+		SetBody(big).
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, 1, ts.pot.NumCached())
+
+	resp, err = ts.r().
+		SetBody(fmt.Sprintf(`{"id": "%s", "pad": "%s"}`, uniuri.New(), strings.Repeat("x", 4<<20))).
+		Post("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode())
+}
+
+func TestKeyFromHeader(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithKeyExtractor(potency.KeyFromHeader("X-GitHub-Delivery")))
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("X-GitHub-Delivery", key1).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	resp, err = ts.r().
+		SetHeader("X-GitHub-Delivery", key1).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, resp1, resp.String())
+}
+
+func TestKeyParsing(t *testing.T) {
+	t.Parallel()
+
+	lenient := newTestServer(t)
+	defer lenient.shutdown(t)
+
+	strict := newTestServer(t, potency.WithKeyParsing(potency.KeyStrict))
+	defer strict.shutdown(t)
+
+	post := func(ts *testServer, key string) (int, string) {
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", key).
+			Post("/")
+		require.NoError(t, err)
+
+		return resp.StatusCode(), resp.String()
+	}
+
+	for _, test := range []struct {
+		header    string
+		equiv     string
+		strictErr bool
+	}{
+		{`"%s"`, `"%s"`, false},
+		{"\t\"%s\" ", `"%s"`, false},
+		{`"%s";v=1`, `"%s"`, true},
+		{`"%s" ; n="a;b";final; v=1`, `"%s"`, true},
+	} {
+		id := uniuri.New()
+
+		status, body := post(lenient, fmt.Sprintf(test.header, id))
+		require.Equal(t, http.StatusOK, status, test.header)
+
+		status, replay := post(lenient, fmt.Sprintf(test.equiv, id))
+		require.Equal(t, http.StatusOK, status, test.header)
+		require.Equal(t, body, replay, test.header)
+
+		status, _ = post(strict, fmt.Sprintf(test.header, id))
+		if test.strictErr {
+			require.Equal(t, http.StatusBadRequest, status, test.header)
+		} else {
+			require.Equal(t, http.StatusOK, status, test.header)
+		}
+	}
+
+	for _, header := range []string{`"abc" x`, `"abc";`, `"abc";V=1`, `"abc";v=`, `"abc";v="x`, `"" ;v=1`, `"abc`} {
+		status, _ := post(lenient, header)
+		require.Equal(t, http.StatusBadRequest, status, header)
+	}
+}
+
+func TestKeyEscapes(t *testing.T) {
+	t.Parallel()
+
+	for _, parsing := range []potency.KeyParsing{potency.KeyLenient, potency.KeyStrict} {
+		ts := newTestServer(t, potency.WithKeyParsing(parsing))
+
+		id := uniuri.New()
+
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", `"`+id+`\"\\"`).
+			Post("/")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode())
+
+		sr, err := ts.pot.Lookup(context.Background(), id+`"\`)
+		require.NoError(t, err)
+		require.NotNil(t, sr)
+
+		for _, key := range []string{`"a"b"`, `"a\"`, `"\"`} {
+			resp, err = ts.r().
+				SetHeader("Idempotency-Key", key).
+				Post("/")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusBadRequest, resp.StatusCode(), key)
+		}
+
+		ts.shutdown(t)
+	}
+}
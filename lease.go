@@ -0,0 +1,77 @@
+package potency
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrLeaseLost = errors.New("reservation lost")
+
+type leaseDeadlineKey struct{}
+
+// WithLease limits how long an execution owns its key. The handler's context
+// (or Do's) is canceled when the lease ends, and LeaseDeadline reports when
+// that is, so handlers can bound their own work. A result that completes
+// after the lease is not saved, since a retry may have taken the key and
+// executed again in the meantime. Zero (the default) means no limit.
+func WithLease(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.lease = d
+	}
+}
+
+// LeaseDeadline returns when the lease of the execution running under ctx
+// ends (see WithLease).
+func LeaseDeadline(ctx context.Context) (time.Time, bool) {
+	deadline, ok := ctx.Value(leaseDeadlineKey{}).(time.Time)
+	return deadline, ok
+}
+
+// LeaseRemaining returns how much of the lease of the execution running
+// under ctx is left (see WithLease).
+func LeaseRemaining(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := LeaseDeadline(ctx)
+	if !ok {
+		return 0, false
+	}
+
+	return time.Until(deadline), true
+}
+
+func withLeaseDeadline(ctx context.Context, deadline time.Time) context.Context {
+	if deadline.IsZero() {
+		return ctx
+	}
+
+	return context.WithValue(ctx, leaseDeadlineKey{}, deadline)
+}
+
+// context returns ctx carrying the execution's fencing token and lease,
+// canceled when the lease ends.
+func (exec *execution) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = withFencingToken(ctx, exec.token)
+
+	if exec.deadline.IsZero() {
+		return ctx, func() {}
+	}
+
+	return context.WithDeadline(withLeaseDeadline(ctx, exec.deadline), exec.deadline)
+}
+
+// owned reports whether the execution still holds its key, i.e. it may save
+// its result.
+func (exec *execution) owned() bool {
+	if exec.lost.Load() {
+		return false
+	}
+
+	return exec.deadline.IsZero() || time.Now().Before(exec.deadline)
+}
+
+// lose marks the execution as no longer owning its key and wakes its
+// waiters. The caller removes it from inProgress.
+func (exec *execution) lose() {
+	exec.lost.Store(true)
+	exec.doneOnce.Do(func() { close(exec.done) })
+}
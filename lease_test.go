@@ -0,0 +1,111 @@
+package potency_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLease(t *testing.T) {
+	t.Parallel()
+
+	var remaining time.Duration
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok := r.Context().Deadline()
+		require.True(t, ok)
+
+		leaseDeadline, ok := potency.LeaseDeadline(r.Context())
+		require.True(t, ok)
+		require.Equal(t, leaseDeadline, deadline)
+
+		remaining, ok = potency.LeaseRemaining(r.Context())
+		require.True(t, ok)
+
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+		}
+
+		_, _ = w.Write([]byte(uniuri.New()))
+	})
+
+	p := potency.NewPotency(handler, potency.WithLease(100*time.Millisecond))
+
+	send := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	key1 := uniuri.New()
+
+	send("/", key1)
+	require.Positive(t, remaining)
+	require.LessOrEqual(t, remaining, 100*time.Millisecond)
+	require.NotNil(t, mustLookup(t, p, key1))
+
+	// Outlives the lease, so isn't saved
+	key2 := uniuri.New()
+
+	send("/slow", key2)
+	require.Nil(t, mustLookup(t, p, key2))
+}
+
+func TestLeaseTakeover(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler(), potency.WithLease(50*time.Millisecond))
+
+	key := uniuri.New()
+
+	res1, err := p.Reserve(key)
+	require.NoError(t, err)
+
+	deadline, ok := potency.LeaseDeadline(res1.Context(context.Background()))
+	require.True(t, ok)
+	require.Equal(t, deadline, p.InProgress()[0].Deadline)
+
+	_, err = p.Reserve(key)
+	require.ErrorIs(t, err, potency.ErrConflict)
+
+	time.Sleep(60 * time.Millisecond)
+
+	res2, err := p.Reserve(key)
+	require.NoError(t, err)
+
+	err = res1.Complete(context.Background(), &potency.SavedResult{StatusCode: http.StatusOK, ResponseBody: []byte("first")})
+	require.ErrorIs(t, err, potency.ErrLeaseLost)
+
+	// The stale release doesn't free the new reservation
+	_, err = p.Reserve(key)
+	require.ErrorIs(t, err, potency.ErrConflict)
+
+	err = res2.Complete(context.Background(), &potency.SavedResult{StatusCode: http.StatusOK, ResponseBody: []byte("second")})
+	require.NoError(t, err)
+	require.Equal(t, []byte("second"), mustLookup(t, p, key).ResponseBody)
+}
+
+func TestLeaseDo(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler(), potency.WithLease(50*time.Millisecond))
+
+	_, _, err := p.Do(context.Background(), uniuri.New(), func(ctx context.Context) (potency.Result, error) {
+		<-ctx.Done()
+		return potency.Result{Value: []byte("late")}, nil
+	})
+	require.ErrorIs(t, err, potency.ErrLeaseLost)
+
+	_, ok := potency.LeaseDeadline(context.Background())
+	require.False(t, ok)
+}
@@ -0,0 +1,37 @@
+package potency
+
+// WithMethodOptions applies opts on top of the rest of the configuration
+// for requests with the given method, so one instance can treat methods
+// differently, e.g.:
+//
+//	potency.WithMethodOptions(http.MethodPost, potency.WithConflictPolicy(potency.ConflictWait)),
+//	potency.WithMethodOptions(http.MethodDelete, potency.WithStatusOnly()),
+//
+// Options that act on the cache as a whole, such as WithLifetime,
+// WithMaxBytes and background work, have no effect per method. Methods
+// given to WithBypassMethods skip idempotency handling before per-method
+// options are consulted. Calling it again for the same method replaces its
+// options.
+func WithMethodOptions(method string, opts ...Option) Option {
+	return func(cfg *config) {
+		methodOptions := map[string][]Option{}
+
+		for m, o := range cfg.methodOptions {
+			methodOptions[m] = o
+		}
+
+		methodOptions[method] = opts
+		cfg.methodOptions = methodOptions
+	}
+}
+
+// forMethod returns the configuration for requests with method.
+func (cfg config) forMethod(method string) config {
+	opts := cfg.methodOptions[method]
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return cfg
+}
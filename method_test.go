@@ -0,0 +1,71 @@
+package potency_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMethodOptions(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t,
+		potency.WithMethodOptions(http.MethodGet, potency.WithBypassMethods(http.MethodGet)),
+		potency.WithMethodOptions(http.MethodPost, potency.WithConflictPolicy(potency.ConflictWait)),
+		potency.WithMethodOptions(http.MethodDelete, potency.WithStatusOnly()),
+	)
+	defer ts.shutdown(t)
+
+	resps := ts.storm(t, uniuri.New(), 2)
+	require.Equal(t, http.StatusOK, resps[0].StatusCode())
+	require.Equal(t, http.StatusOK, resps[1].StatusCode())
+	require.Equal(t, resps[0].String(), resps[1].String())
+
+	send := func(method, key string) (int, string) {
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", `"`+key+`"`).
+			Execute(method, "/")
+		require.NoError(t, err)
+
+		return resp.StatusCode(), resp.String()
+	}
+
+	key := uniuri.New()
+
+	status, body1 := send(http.MethodGet, key)
+	require.Equal(t, http.StatusOK, status)
+
+	status, body2 := send(http.MethodGet, key)
+	require.Equal(t, http.StatusOK, status)
+	require.NotEqual(t, body1, body2)
+
+	key = uniuri.New()
+
+	status, body1 = send(http.MethodDelete, key)
+	require.Equal(t, http.StatusOK, status)
+	require.NotEmpty(t, body1)
+
+	status, body2 = send(http.MethodDelete, key)
+	require.Equal(t, http.StatusOK, status)
+	require.Empty(t, body2)
+
+	sr := mustLookup(t, ts.pot, key)
+	require.Empty(t, sr.ResponseBody)
+	require.Equal(t, "bar", sr.ResponseHeader.Get("X-Response"))
+}
+
+func TestMethodOptionsDefault(t *testing.T) {
+	t.Parallel()
+
+	// Other methods keep the instance-wide configuration
+	ts := newTestServer(t, potency.WithMethodOptions(http.MethodPatch, potency.WithConflictPolicy(potency.ConflictWait)))
+	defer ts.shutdown(t)
+
+	resps := ts.storm(t, uniuri.New(), 2)
+
+	statuses := []int{resps[0].StatusCode(), resps[1].StatusCode()}
+	require.ElementsMatch(t, []int{http.StatusOK, http.StatusConflict}, statuses)
+}
@@ -0,0 +1,114 @@
+package potency
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Outcome is how a keyed request was handled.
+type Outcome string
+
+const (
+	// OutcomeStored means the handler ran and its response was saved.
+	OutcomeStored Outcome = "stored"
+
+	// OutcomeNotStored means the handler ran but its response was not saved
+	// (e.g. streaming or an oversize body).
+	OutcomeNotStored Outcome = "not_stored"
+
+	// OutcomeReplayed means a saved response was served.
+	OutcomeReplayed Outcome = "replayed"
+
+	// OutcomeReplayLimited means a saved response was not served because it
+	// had been replayed too many times (see WithMaxReplays).
+	OutcomeReplayLimited Outcome = "replay_limited"
+
+	// OutcomeMismatch means the request did not match the saved request for
+	// its key.
+	OutcomeMismatch Outcome = "mismatch"
+
+	// OutcomeConflict means the key was already executing.
+	OutcomeConflict Outcome = "conflict"
+
+	// OutcomeForwarded means the request was proxied to the peer that owns
+	// the key.
+	OutcomeForwarded Outcome = "forwarded"
+
+	// OutcomeBypassed means the request skipped idempotency handling.
+	OutcomeBypassed Outcome = "bypassed"
+
+	// OutcomeRejected means the request was refused for another reason (e.g.
+	// body too large, shutting down).
+	OutcomeRejected Outcome = "rejected"
+)
+
+// MetricLabels are the low-cardinality labels attached to each observation.
+type MetricLabels struct {
+	Route   string
+	Method  string
+	Outcome Outcome
+}
+
+// Metrics receives one observation per keyed request. Implementations
+// typically increment a labeled counter.
+type Metrics interface {
+	Observe(MetricLabels)
+}
+
+// MetricsFunc adapts a function to Metrics.
+type MetricsFunc func(MetricLabels)
+
+func (f MetricsFunc) Observe(labels MetricLabels) {
+	f(labels)
+}
+
+// RouteLabeler returns a low-cardinality route label (e.g. "/orders/{id}")
+// for a request. Never return raw paths containing IDs.
+type RouteLabeler func(*http.Request) string
+
+func WithMetrics(metrics Metrics) Option {
+	return func(cfg *config) {
+		cfg.metrics = metrics
+	}
+}
+
+// WithRouteLabeler sets how the Route label is derived. By default it is
+// empty.
+func WithRouteLabeler(labeler RouteLabeler) Option {
+	return func(cfg *config) {
+		cfg.routeLabeler = labeler
+	}
+}
+
+func (cfg *config) observe(r *http.Request, outcome Outcome) {
+	if cfg.metrics == nil {
+		return
+	}
+
+	labels := MetricLabels{
+		Method:  r.Method,
+		Outcome: outcome,
+	}
+
+	if cfg.routeLabeler != nil {
+		labels.Route = cfg.routeLabeler(r)
+	}
+
+	cfg.metrics.Observe(labels)
+}
+
+func errorOutcome(err error) Outcome {
+	switch {
+	case errors.Is(err, ErrMismatch):
+		return OutcomeMismatch
+
+	case errors.Is(err, ErrConflict):
+		return OutcomeConflict
+
+	case errors.Is(err, ErrTooManyReplays):
+		return OutcomeReplayLimited
+
+	default:
+		return OutcomeRejected
+	}
+}
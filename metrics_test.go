@@ -0,0 +1,88 @@
+package potency_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+type testMetrics struct {
+	counts map[potency.MetricLabels]int
+	mu     sync.Mutex
+}
+
+func (tm *testMetrics) Observe(labels potency.MetricLabels) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.counts[labels]++
+}
+
+func (tm *testMetrics) get(labels potency.MetricLabels) int {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	return tm.counts[labels]
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	tm := &testMetrics{counts: map[potency.MetricLabels]int{}}
+
+	ts := newTestServer(t,
+		potency.WithMetrics(tm),
+		potency.WithRouteLabeler(func(r *http.Request) string {
+			return "/" + strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")[0]
+		}),
+	)
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	for i := 0; i < 2; i++ {
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+			SetBody("test1").
+			Post("")
+		require.NoError(t, err)
+		require.False(t, resp.IsError())
+	}
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test2").
+		Post("")
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+
+	ts.storm(t, uniuri.New(), 3)
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).
+		Get("events")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	post := func(route string, outcome potency.Outcome) potency.MetricLabels {
+		return potency.MetricLabels{Route: route, Method: http.MethodPost, Outcome: outcome}
+	}
+
+	// Observations are made after the response is written
+	require.Eventually(t, func() bool {
+		return tm.get(potency.MetricLabels{Route: "/events", Method: http.MethodGet, Outcome: potency.OutcomeNotStored}) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, 1, tm.get(post("/", potency.OutcomeStored)))
+	require.Equal(t, 1, tm.get(post("/", potency.OutcomeReplayed)))
+	require.Equal(t, 1, tm.get(post("/", potency.OutcomeMismatch)))
+	require.Equal(t, 1, tm.get(post("/slow", potency.OutcomeStored)))
+	require.Equal(t, 2, tm.get(post("/slow", potency.OutcomeConflict)))
+}
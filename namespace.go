@@ -0,0 +1,88 @@
+package potency
+
+import "strings"
+
+var namespaceEscaper = strings.NewReplacer("%", "%25", ":", "%3A")
+
+// WithStoreNamespace isolates results in a store shared with other
+// services: keys are stored as the namespace, a colon and the key, and
+// results stored under other namespaces are never read, replaced or
+// deleted, including by InvalidateWhere on a Purger. Colons in ns are
+// escaped, so no namespace is a prefix of another. Compact and StoreSize
+// only cover the namespace. The local cache, replicas and peers use
+// unprefixed keys.
+func WithStoreNamespace(ns string) Option {
+	return func(cfg *config) {
+		if ns == "" {
+			cfg.storePrefix = ""
+		} else {
+			cfg.storePrefix = namespaceEscaper.Replace(ns) + ":"
+		}
+	}
+}
+
+// storeKey returns the key for key in the store.
+func (cfg *config) storeKey(key string) string {
+	return cfg.storePrefix + key
+}
+
+// toStore returns sr with its key in the store's namespace.
+func (cfg *config) toStore(sr *SavedResult) *SavedResult {
+	if cfg.storePrefix == "" {
+		return sr
+	}
+
+	return sr.withKey(cfg.storeKey(sr.Key))
+}
+
+// fromStore returns sr, read from the store, with the namespace removed
+// from its key, or nil if it belongs to another namespace.
+func (cfg *config) fromStore(sr *SavedResult) *SavedResult {
+	if cfg.storePrefix == "" {
+		return sr
+	}
+
+	if !strings.HasPrefix(sr.Key, cfg.storePrefix) {
+		return nil
+	}
+
+	return sr.withKey(strings.TrimPrefix(sr.Key, cfg.storePrefix))
+}
+
+// storeMatch adapts match to results read from the store, skipping those
+// of other namespaces.
+func (cfg *config) storeMatch(match func(*SavedResult) bool) func(*SavedResult) bool {
+	if cfg.storePrefix == "" {
+		return match
+	}
+
+	return func(sr *SavedResult) bool {
+		sr = cfg.fromStore(sr)
+		return sr != nil && match(sr)
+	}
+}
+
+// withKey returns a copy of the exported fields of sr with a different key.
+func (sr *SavedResult) withKey(key string) *SavedResult {
+	return &SavedResult{
+		Key: key,
+
+		Method:        sr.Method,
+		URL:           sr.URL,
+		RequestHeader: sr.RequestHeader,
+		BodyHash:      sr.BodyHash,
+		RequestDigest: sr.RequestDigest,
+
+		StatusCode:      sr.StatusCode,
+		ResponseHeader:  sr.ResponseHeader,
+		ResponseBody:    sr.ResponseBody,
+		ResponseTrailer: sr.ResponseTrailer,
+
+		Added: sr.Added,
+
+		Principal: sr.Principal,
+		RequestID: sr.RequestID,
+		ClientIP:  sr.ClientIP,
+		UserAgent: sr.UserAgent,
+	}
+}
@@ -0,0 +1,64 @@
+package potency_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreNamespace(t *testing.T) {
+	t.Parallel()
+
+	store := purgingStore{newTestStore()}
+
+	billing := newTestServer(t, potency.WithStore(store), potency.WithStoreNamespace("billing"))
+	defer billing.shutdown(t)
+
+	shipping := newTestServer(t, potency.WithStore(store), potency.WithStoreNamespace("ship:ping"))
+	defer shipping.shutdown(t)
+
+	key := uniuri.New()
+
+	post := func(ts *testServer) string {
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", `"`+key+`"`).
+			Post("/")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode())
+
+		return resp.String()
+	}
+
+	body1 := post(billing)
+	body2 := post(shipping)
+	require.NotEqual(t, body1, body2)
+
+	store.mu.Lock()
+	require.Contains(t, store.entries, "billing:"+key)
+	require.Contains(t, store.entries, "ship%3Aping:"+key)
+	store.mu.Unlock()
+
+	// A new instance in the namespace finds its results in the store
+	billing2 := newTestServer(t, potency.WithStore(store), potency.WithStoreNamespace("billing"))
+	defer billing2.shutdown(t)
+
+	require.Equal(t, body1, post(billing2))
+
+	sr := mustLookup(t, billing2.pot, key)
+	require.Equal(t, key, sr.Key)
+
+	// Purging only matches the instance's own namespace
+	n, err := shipping.pot.InvalidateWhere(context.Background(), func(sr *potency.SavedResult) bool {
+		return sr.Key == key
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, 1, store.len())
+
+	require.NoError(t, billing2.pot.Invalidate(context.Background(), key))
+	require.Equal(t, 0, store.len())
+}
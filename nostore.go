@@ -0,0 +1,59 @@
+package potency
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ControlHeader is a response header handlers can set to "no-store" to keep
+// that response out of the cache. The key is released, so a retry executes
+// again.
+const ControlHeader = "Idempotency-Control"
+
+// WithCacheControlNoStore also treats "Cache-Control: no-store" on a response
+// as a request not to save it. It is off by default because many APIs send
+// no-store on every response to keep them out of HTTP caches.
+func WithCacheControlNoStore() Option {
+	return func(cfg *config) {
+		cfg.cacheControlNoStore = true
+	}
+}
+
+// WithSkipUnwritten doesn't save responses from handlers that return without
+// calling Write, WriteHeader or Flush. By default these are saved as the 200
+// with an empty body that net/http sends, which is wrong when an outer
+// middleware writes its own response after the handler returns.
+func WithSkipUnwritten() Option {
+	return func(cfg *config) {
+		cfg.skipUnwritten = true
+	}
+}
+
+func (cfg *config) noStore(header http.Header) bool {
+	if hasDirective(header, ControlHeader, "no-store") {
+		return true
+	}
+
+	return cfg.cacheControlNoStore && hasDirective(header, "Cache-Control", "no-store")
+}
+
+func hasDirective(header http.Header, name, directive string) bool {
+	_, found := directiveValue(header, name, directive)
+	return found
+}
+
+// directiveValue returns the (unquoted) argument of a comma-separated
+// directive such as "retention=high".
+func directiveValue(header http.Header, name, directive string) (string, bool) {
+	for _, val := range header.Values(name) {
+		for _, part := range strings.Split(val, ",") {
+			part, arg, _ := strings.Cut(part, "=")
+
+			if strings.EqualFold(strings.TrimSpace(part), directive) {
+				return strings.Trim(strings.TrimSpace(arg), `"`), true
+			}
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,154 @@
+package potency_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNoStore(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/control":
+			w.Header().Set(potency.ControlHeader, "No-Store")
+
+		case "/cache-control":
+			w.Header().Set("Cache-Control", "private, no-store")
+		}
+
+		_, _ = w.Write([]byte(uniuri.New()))
+	})
+
+	for _, honor := range []bool{false, true} {
+		opts := []potency.Option{}
+		if honor {
+			opts = append(opts, potency.WithCacheControlNoStore())
+		}
+
+		p := potency.NewPotency(handler, opts...)
+
+		srv := httptest.NewServer(p)
+
+		post := func(path string) {
+			req, err := http.NewRequest(http.MethodPost, srv.URL+path, nil)
+			require.NoError(t, err)
+
+			req.Header.Set("Idempotency-Key", `"`+uniuri.New()+`"`)
+
+			resp, err := srv.Client().Do(req)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			resp.Body.Close()
+		}
+
+		post("/control")
+		require.Equal(t, 0, p.NumCached())
+
+		post("/cache-control")
+
+		if honor {
+			require.Equal(t, 0, p.NumCached())
+		} else {
+			require.Equal(t, 1, p.NumCached())
+		}
+
+		post("/")
+
+		if honor {
+			require.Equal(t, 1, p.NumCached())
+		} else {
+			require.Equal(t, 2, p.NumCached())
+		}
+
+		srv.Close()
+	}
+}
+
+type writeTracker struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *writeTracker) WriteHeader(statusCode int) {
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *writeTracker) Write(data []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *writeTracker) Flush() {
+	w.wrote = true
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func TestSkipUnwritten(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/flush" {
+			w.(http.Flusher).Flush()
+		}
+	})
+
+	for _, skip := range []bool{false, true} {
+		opts := []potency.Option{}
+		if skip {
+			opts = append(opts, potency.WithSkipUnwritten())
+		}
+
+		p := potency.NewPotency(handler, opts...)
+
+		// Outer middleware that fills in an error when nothing was written
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wt := &writeTracker{ResponseWriter: w}
+			p.ServeHTTP(wt, r)
+
+			if !wt.wrote {
+				w.WriteHeader(http.StatusBadGateway)
+			}
+		}))
+
+		key := uniuri.New()
+
+		post := func(path string) int {
+			req, err := http.NewRequest(http.MethodPost, srv.URL+path, nil)
+			require.NoError(t, err)
+
+			req.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+			resp, err := srv.Client().Do(req)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+
+			return resp.StatusCode
+		}
+
+		require.Equal(t, http.StatusBadGateway, post("/"))
+
+		if skip {
+			require.Equal(t, 0, p.NumCached())
+			require.Equal(t, http.StatusBadGateway, post("/"))
+		} else {
+			require.Equal(t, 1, p.NumCached())
+			require.Equal(t, http.StatusOK, post("/"))
+		}
+
+		// Flushing sends the headers, so the response is saved either way
+		key = uniuri.New()
+
+		require.Equal(t, http.StatusOK, post("/flush"))
+		require.Equal(t, http.StatusOK, post("/flush"))
+
+		srv.Close()
+	}
+}
@@ -0,0 +1,234 @@
+package potency
+
+import (
+	"crypto/sha256"
+	"hash"
+	"net/http"
+	"time"
+)
+
+type Option func(*config)
+
+type config struct {
+	maxRequestBodySize int64
+	oversizePolicy     OversizePolicy
+	bufferBodySize     int64
+
+	streamingContentTypes []string
+	streamingDetectors    []StreamingDetector
+
+	bypassMethods []string
+	methodOptions map[string][]Option
+
+	identityHeaders         []string
+	identityHeadersExcluded []string
+	forwardedPolicy         ForwardedPolicy
+	urlNormalizer           URLNormalizer
+	identityDigest          bool
+	identityDigestFields    bool
+
+	newHash    func() hash.Hash
+	serializer Serializer
+
+	keyExtractor  KeyExtractor
+	minKeyLength  int
+	minKeyEntropy float64
+
+	lifetime       time.Duration
+	errorLifetime  time.Duration
+	lifetimeJitter float64
+	strictWindow   time.Duration
+
+	tombstoneWindow   time.Duration
+	tombstoneLifetime time.Duration
+	tombstoneStatus   int
+	onExpiredReuse    func(*http.Request, ExpiredReuse)
+
+	metrics      Metrics
+	routeLabeler RouteLabeler
+
+	requestIDExtractor RequestIDExtractor
+	provenance         Provenance
+
+	audit            func(AuditEvent)
+	principal        PrincipalFunc
+	scopeByPrincipal bool
+	principalQuota   int
+	replayAuthorizer ReplayAuthorizer
+	quotaPolicy      QuotaPolicy
+	limiter          *limiter
+
+	headerRewriters map[string]HeaderRewriter
+	scrubbedHeaders []string
+
+	cacheControlNoStore bool
+	skipUnwritten       bool
+	receiptThreshold    int64
+	statusOnly          bool
+	strictResponses     bool
+	cacheStatus         bool
+	conformance         bool
+	problemType         string
+	onMalformed         func(*http.Request, error)
+
+	compressors map[string]*compressor
+
+	maxBytes       int64
+	retention      RetentionFunc
+	evictionPolicy EvictionPolicy
+	maxReplays     int64
+
+	onEvict func(*SavedResult, EvictReason)
+
+	lease             time.Duration
+	watchdogThreshold time.Duration
+	stuckPolicy       StuckPolicy
+	onStuck           func(Execution)
+
+	conflictPolicy      func(*http.Request) ConflictPolicy
+	conflictStatus      int
+	conflictErrorWriter ErrorWriter
+	errorWriter         ErrorWriter
+	translator          Translator
+	maxWait             time.Duration
+	waitWhileSending    bool
+
+	store           Store
+	storePrefix     string
+	compactInterval time.Duration
+	asyncQueueSize  int
+	asyncBatchSize  int
+	asyncInterval   time.Duration
+	asyncOverflow   OverflowPolicy
+	failOpen        bool
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+}
+
+type OversizePolicy int
+
+const (
+	// OversizeReject responds 413 to keyed requests with bodies over the
+	// limit.
+	OversizeReject OversizePolicy = iota
+
+	// OversizeBypass passes keyed requests with bodies over the limit
+	// straight to the handler without idempotency handling.
+	OversizeBypass
+)
+
+func newConfig() config {
+	return config{
+		streamingContentTypes: []string{"text/event-stream"},
+		bypassMethods:         []string{http.MethodOptions},
+		scrubbedHeaders:       []string{"Set-Cookie", "WWW-Authenticate"},
+		lifetime:              6 * time.Hour,
+		identityHeaders:       []string{"Accept", "Authorization", "Content-Type"},
+		newHash:               sha256.New,
+		serializer:            WireSerializer{},
+		keyExtractor:          idempotencyKeyHeader,
+		requestIDExtractor:    defaultRequestID,
+		retention:             controlRetention,
+		conflictStatus:        http.StatusConflict,
+		tombstoneStatus:       http.StatusGone,
+		readTimeout:           1 * time.Second,
+		writeTimeout:          5 * time.Second,
+	}
+}
+
+// WithMaxRequestBodySize limits the size of request bodies that are
+// fingerprinted. Bodies without a declared Content-Length that exceed the
+// limit while the handler reads them are never stored.
+func WithMaxRequestBodySize(n int64) Option {
+	return func(cfg *config) {
+		cfg.maxRequestBodySize = n
+	}
+}
+
+// WithRequestBodyBuffering reads request bodies of up to n bytes into memory
+// before running the handler. The fingerprint then covers the whole body even
+// if the handler stops reading early, and the handler can re-read it with
+// r.GetBody.
+func WithRequestBodyBuffering(n int64) Option {
+	return func(cfg *config) {
+		cfg.bufferBodySize = n
+	}
+}
+
+func WithOversizePolicy(policy OversizePolicy) Option {
+	return func(cfg *config) {
+		cfg.oversizePolicy = policy
+	}
+}
+
+// WithBypassMethods replaces the HTTP methods (default OPTIONS, so CORS
+// preflights never touch the cache) that skip idempotency handling entirely.
+func WithBypassMethods(methods ...string) Option {
+	return func(cfg *config) {
+		cfg.bypassMethods = methods
+	}
+}
+
+func (cfg *config) bypassMethod(method string) bool {
+	for _, m := range cfg.bypassMethods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithHash sets the hash used to fingerprint request bodies (default
+// SHA-256). Non-cryptographic hashes are only appropriate when clients are
+// trusted not to craft colliding bodies. Changing the hash invalidates the
+// fingerprints of already-cached entries.
+func WithHash(newHash func() hash.Hash) Option {
+	return func(cfg *config) {
+		cfg.newHash = newHash
+	}
+}
+
+func (p *Potency) config() config {
+	p.cacheMu.RLock()
+	defer p.cacheMu.RUnlock()
+
+	return p.cfg
+}
+
+// Reconfigure applies opts on top of the current configuration, e.g. to
+// shorten the lifetime or enable WithFailOpen during an incident. Requests
+// already in flight finish with the configuration they started with. A
+// shorter lifetime or smaller WithMaxBytes budget is enforced on cached
+// entries immediately.
+func (p *Potency) Reconfigure(opts ...Option) {
+	p.cacheMu.Lock()
+	defer p.unlockAndNotify()
+
+	cfg := p.cfg
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	p.cfg = cfg
+
+	p.removeExpired()
+	p.enforceMaxBytes()
+}
+
+// WithLifetime sets how long results are kept (default 6h). See SetLifetime.
+func WithLifetime(lifetime time.Duration) Option {
+	return func(cfg *config) {
+		cfg.lifetime = lifetime
+	}
+}
+
+// WithErrorLifetime caches 4xx and 5xx responses for a shorter time than
+// successful ones, so retries eventually re-execute against a recovered
+// downstream. Zero (the default) uses the normal lifetime.
+func WithErrorLifetime(lifetime time.Duration) Option {
+	return func(cfg *config) {
+		cfg.errorLifetime = lifetime
+	}
+}
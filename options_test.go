@@ -0,0 +1,301 @@
+package potency_test
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxRequestBodySizeReject(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithMaxRequestBodySize(10))
+	defer ts.shutdown(t)
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).
+		SetBody(strings.Repeat("x", 11)).
+		Post("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode())
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).
+		SetBody(strings.Repeat("x", 10)).
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	require.Equal(t, 1, ts.pot.NumCached())
+}
+
+func TestMaxRequestBodySizeBypass(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t,
+		potency.WithMaxRequestBodySize(10),
+		potency.WithOversizePolicy(potency.OversizeBypass),
+	)
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody(strings.Repeat("x", 11)).
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody(strings.Repeat("x", 11)).
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.NotEqual(t, resp1, resp.String())
+
+	require.Equal(t, 0, ts.pot.NumCached())
+}
+
+func TestBypassOptions(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", "not-quoted").
+		Options("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	require.Equal(t, 0, ts.pot.NumCached())
+}
+
+func TestBypassMethods(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithBypassMethods(http.MethodGet))
+	defer ts.shutdown(t)
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).
+		Get("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	require.Equal(t, 0, ts.pot.NumCached())
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).
+		Options("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	require.Equal(t, 1, ts.pot.NumCached())
+}
+
+func TestHash(t *testing.T) {
+	t.Parallel()
+
+	calls := int32(0)
+
+	ts := newTestServer(t, potency.WithHash(func() hash.Hash {
+		atomic.AddInt32(&calls, 1)
+		return sha512.New512_256()
+	}))
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, resp1, resp.String())
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test2").
+		Post("")
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+
+	require.Positive(t, atomic.LoadInt32(&calls))
+}
+
+func TestErrorLifetime(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithErrorLifetime(200*time.Millisecond))
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Post("error")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+
+	resp1 := resp.String()
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Post("error")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+	require.Equal(t, resp1, resp.String())
+
+	key2 := uniuri.New()
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key2)).
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp2 := resp.String()
+
+	time.Sleep(300 * time.Millisecond)
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Post("error")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+	require.NotEqual(t, resp1, resp.String())
+	require.Empty(t, resp.Header().Get(potency.ReplayedHeader))
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key2)).
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, resp2, resp.String())
+}
+
+func TestReconfigure(t *testing.T) {
+	t.Parallel()
+
+	store := newTestStore()
+	store.block = true
+
+	ts := newTestServer(t, potency.WithStore(store), potency.WithReadTimeout(50*time.Millisecond))
+	defer ts.shutdown(t)
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+
+	ts.pot.Reconfigure(potency.WithFailOpen(true))
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, 0, ts.pot.NumCached())
+
+	store.mu.Lock()
+	store.block = false
+	store.mu.Unlock()
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, 1, ts.pot.NumCached())
+
+	ts.pot.Reconfigure(potency.WithLifetime(1 * time.Nanosecond))
+	require.Equal(t, 0, ts.pot.NumCached())
+}
+
+func TestRequestBodyBuffering(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only look at the first few bytes, then re-read the whole body
+		prefix := make([]byte, 4)
+		_, err := io.ReadFull(r.Body, prefix)
+		require.NoError(t, err)
+
+		require.NotNil(t, r.GetBody)
+
+		body, err := r.GetBody()
+		require.NoError(t, err)
+
+		all, err := io.ReadAll(body)
+		require.NoError(t, err)
+
+		_, _ = w.Write([]byte(fmt.Sprintf("%s %d %s", prefix, len(all), uniuri.New())))
+	})
+
+	p := potency.NewPotency(handler, potency.WithRequestBodyBuffering(1024))
+
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	key := uniuri.New()
+
+	post := func(body string) (int, string) {
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+		require.NoError(t, err)
+
+		req.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+		resp, err := srv.Client().Do(req)
+		require.NoError(t, err)
+
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return resp.StatusCode, string(data)
+	}
+
+	status, body1 := post("abcdefgh")
+	require.Equal(t, http.StatusOK, status)
+	require.True(t, strings.HasPrefix(body1, "abcd 8 "))
+
+	status, body := post("abcdefgh")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, body1, body)
+
+	// Same prefix, but the rest of the body differs
+	status, body = post("abcdXXXX")
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Contains(t, body, potency.ErrBodyMismatch.Error())
+}
@@ -0,0 +1,59 @@
+//go:build go1.23
+
+package potency
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RoutePattern identifies requests by the http.ServeMux pattern that matched
+// them, its path values, and the query parameters, so equivalent encodings of
+// the same URL (e.g. "/orders/a%62" and "/orders/ab") share an identity. The
+// pattern is only known when the middleware runs inside the mux, e.g.
+// mux.Handle("POST /orders/{id}", p.Handler(h)); otherwise it falls back to
+// r.URL.String(). It is only built with Go 1.23 or later, which added
+// r.Pattern. Programs whose main module declares a go version before 1.22
+// also need GODEBUG=httpmuxgo121=0 for the mux to match patterns.
+//
+// r.Pattern is also available to RouteLabeler and SetConflictPolicyFunc for
+// per-pattern metrics and policies.
+func RoutePattern(r *http.Request) string {
+	if r.Pattern == "" {
+		return r.URL.String()
+	}
+
+	values := url.Values{}
+
+	for _, name := range patternWildcards(r.Pattern) {
+		values.Set(name, r.PathValue(name))
+	}
+
+	return r.Pattern + " " + values.Encode() + "?" + r.URL.Query().Encode()
+}
+
+// patternWildcards returns the names of the {name} and {name...} wildcards in
+// a ServeMux pattern.
+func patternWildcards(pattern string) []string {
+	names := []string{}
+
+	for {
+		start := strings.IndexByte(pattern, '{')
+		if start < 0 {
+			return names
+		}
+
+		end := strings.IndexByte(pattern[start:], '}')
+		if end < 0 {
+			return names
+		}
+
+		name := strings.TrimSuffix(pattern[start+1:start+end], "...")
+		if name != "$" {
+			names = append(names, name)
+		}
+
+		pattern = pattern[start+end+1:]
+	}
+}
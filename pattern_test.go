@@ -0,0 +1,68 @@
+//go:build go1.23
+
+// The module predates enhanced ServeMux patterns.
+//go:debug httpmuxgo121=0
+
+package potency_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutePattern(t *testing.T) {
+	t.Parallel()
+
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(uniuri.New()))
+	})
+
+	p := potency.NewPotency(inner, potency.WithURLNormalizer(potency.RoutePattern))
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /orders/{id}/items/{rest...}", p.Handler(inner))
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	key := uniuri.New()
+
+	post := func(path string) (int, string) {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+path, nil)
+		require.NoError(t, err)
+
+		req.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+		resp, err := srv.Client().Do(req)
+		require.NoError(t, err)
+
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return resp.StatusCode, string(body)
+	}
+
+	status, body1 := post("/orders/ab/items/x/y?b=2&a=1")
+	require.Equal(t, http.StatusOK, status)
+
+	status, body := post("/orders/a%62/items/x/y?a=1&b=2")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, body1, body)
+
+	status, body = post("/orders/ac/items/x/y?a=1&b=2")
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Contains(t, body, potency.ErrURLMismatch.Error())
+
+	sr, err := p.Lookup(context.Background(), key)
+	require.NoError(t, err)
+	require.Equal(t, "POST /orders/{id}/items/{rest...} id=ab&rest=x%2Fy?a=1&b=2", sr.URL)
+}
@@ -0,0 +1,276 @@
+package potency
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrPeer = errors.New("peer fetch failed")
+
+// PeerPicker selects the instance that owns a key. It returns false when the
+// local instance is the owner (or no peers are known).
+type PeerPicker interface {
+	PickPeer(key string) (Peer, bool)
+}
+
+// Peer fetches a saved result from a remote instance. Fetch returns nil, nil
+// when the peer has no entry for the key.
+type Peer interface {
+	Fetch(ctx context.Context, key string) (*SavedResult, error)
+}
+
+// Forwarder is optionally implemented by a Peer that can execute a request on
+// the remote instance, used by ConflictProxy.
+type Forwarder interface {
+	Forward(w http.ResponseWriter, r *http.Request)
+}
+
+type HTTPPool struct {
+	self       string
+	ring       *hashRing
+	client     *http.Client
+	serializer Serializer
+	secret     string
+	fetchURL   func(peer string) string
+}
+
+type httpPeer struct {
+	baseURL    string
+	fetchURL   string
+	client     *http.Client
+	serializer Serializer
+	secret     string
+}
+
+type hashRing struct {
+	hashes []uint32
+	nodes  map[uint32]string
+}
+
+const (
+	PeerPath         = "/_potency/"
+	PeerSecretHeader = "Potency-Peer-Secret"
+	hashRingReplicas = 50
+)
+
+func (p *Potency) SetPeerPicker(picker PeerPicker) {
+	p.cacheMu.Lock()
+	defer p.cacheMu.Unlock()
+
+	p.peerPicker = picker
+}
+
+// PeerHandler serves this instance's saved results to peers using
+// HTTPPool. Results include request identity headers (e.g. Authorization)
+// and are served without WithPrincipal or WithReplayAuthorizer checks, so
+// it only answers requests carrying secret in the PeerSecretHeader (see
+// HTTPPool.SetSecret); with an empty secret it refuses every request. Mount
+// it at PeerPath on a listener that only peers can reach, such as an
+// internal port, and point HTTPPool.SetFetchURL at it.
+func (p *Potency) PeerHandler(secret string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get(PeerSecretHeader)
+		if secret == "" || subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		key, err := url.PathUnescape(r.URL.EscapedPath()[strings.LastIndex(r.URL.EscapedPath(), "/")+1:])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sr := p.read(key)
+		if sr == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		unpacked, err := p.unpack(sr)
+		if err != nil {
+			p.dropCorrupt(sr)
+			http.NotFound(w, r)
+
+			return
+		}
+
+		cfg := p.config()
+
+		data, err := cfg.serializer.Marshal(cfg.scrub(unpacked))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/cbor")
+		_, _ = w.Write(data)
+	})
+}
+
+func (p *Potency) fetchFromPeer(ctx context.Context, key string) (*SavedResult, error) {
+	p.cacheMu.RLock()
+	picker := p.peerPicker
+	p.cacheMu.RUnlock()
+
+	if picker == nil {
+		return nil, nil
+	}
+
+	peer, ok := picker.PickPeer(key)
+	if !ok {
+		return nil, nil
+	}
+
+	sr, err := peer.Fetch(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %s (%w)", key, err, ErrPeer)
+	}
+
+	// Peers use unprefixed keys (see WithStoreNamespace), and may keep
+	// results this instance's retention has already expired
+	if sr == nil || sr.Key != key || p.expired(sr) {
+		return nil, nil
+	}
+
+	p.insert(sr)
+
+	return sr, nil
+}
+
+// NewHTTPPool creates a PeerPicker over peer base URLs (e.g.
+// "http://10.0.0.1:8080"). self must appear in peers exactly as this
+// instance's own base URL.
+func NewHTTPPool(self string, peers []string) *HTTPPool {
+	return &HTTPPool{
+		self:       self,
+		ring:       newHashRing(peers),
+		client:     http.DefaultClient,
+		serializer: WireSerializer{},
+		fetchURL:   func(peer string) string { return peer },
+	}
+}
+
+// SetSecret sets the secret sent to peers' PeerHandler.
+func (hp *HTTPPool) SetSecret(secret string) {
+	hp.secret = secret
+}
+
+// SetFetchURL maps a peer's base URL, which ConflictProxy forwards requests
+// to, to the base URL of its PeerHandler listener. By default they are the
+// same.
+func (hp *HTTPPool) SetFetchURL(fetchURL func(peer string) string) {
+	hp.fetchURL = fetchURL
+}
+
+// SetSerializer sets how results fetched from peers are decoded, matching
+// their WithSerializer.
+func (hp *HTTPPool) SetSerializer(serializer Serializer) {
+	hp.serializer = serializer
+}
+
+func (hp *HTTPPool) SetClient(client *http.Client) {
+	hp.client = client
+}
+
+func (hp *HTTPPool) PickPeer(key string) (Peer, bool) {
+	node := hp.ring.get(key)
+	if node == "" || node == hp.self {
+		return nil, false
+	}
+
+	return &httpPeer{
+		baseURL:    node,
+		fetchURL:   hp.fetchURL(node),
+		client:     hp.client,
+		serializer: hp.serializer,
+		secret:     hp.secret,
+	}, true
+}
+
+func (hp *httpPeer) Fetch(ctx context.Context, key string) (*SavedResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(hp.fetchURL, "/")+PeerPath+url.PathEscape(key), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set(PeerSecretHeader, hp.secret)
+
+	resp, err := hp.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("peer %s: %s", hp.baseURL, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return hp.serializer.Unmarshal(data)
+}
+
+func (hp *httpPeer) Forward(w http.ResponseWriter, r *http.Request) {
+	target, err := url.Parse(hp.baseURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = hp.client.Transport
+
+	proxy.ServeHTTP(w, r)
+}
+
+func newHashRing(nodes []string) *hashRing {
+	hr := &hashRing{
+		nodes: map[uint32]string{},
+	}
+
+	for _, node := range nodes {
+		for i := 0; i < hashRingReplicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + node))
+			hr.hashes = append(hr.hashes, h)
+			hr.nodes[h] = node
+		}
+	}
+
+	sort.Slice(hr.hashes, func(i, j int) bool { return hr.hashes[i] < hr.hashes[j] })
+
+	return hr
+}
+
+func (hr *hashRing) get(key string) string {
+	if len(hr.hashes) == 0 {
+		return ""
+	}
+
+	h := crc32.ChecksumIEEE([]byte(key))
+
+	i := sort.Search(len(hr.hashes), func(i int) bool { return hr.hashes[i] >= h })
+	if i == len(hr.hashes) {
+		i = 0
+	}
+
+	return hr.nodes[hr.hashes[i]]
+}
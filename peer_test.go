@@ -0,0 +1,186 @@
+package potency_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeer(t *testing.T) {
+	t.Parallel()
+
+	ts1 := newTestServer(t)
+	defer ts1.shutdown(t)
+
+	ts2 := newTestServer(t)
+	defer ts2.shutdown(t)
+
+	ts1.pot.SetPeerPicker(newTestPool(ts1, ts1))
+	ts2.pot.SetPeerPicker(newTestPool(ts2, ts1))
+
+	key1 := uniuri.New()
+
+	resp, err := ts1.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	require.Equal(t, 0, ts2.pot.NumCached())
+
+	resp, err = ts2.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, resp1, resp.String())
+	require.Equal(t, 1, ts2.pot.NumCached())
+
+	key2 := uniuri.New()
+
+	resp, err = ts2.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key2)).
+		SetBody("test2").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.NotEqual(t, resp1, resp.String())
+}
+
+func TestPeerExpired(t *testing.T) {
+	t.Parallel()
+
+	ts1 := newTestServer(t)
+	defer ts1.shutdown(t)
+
+	ts2 := newTestServer(t, potency.WithLifetime(50*time.Millisecond))
+	defer ts2.shutdown(t)
+
+	ts1.pot.SetPeerPicker(newTestPool(ts1, ts1))
+	ts2.pot.SetPeerPicker(newTestPool(ts2, ts1))
+
+	key := uniuri.New()
+
+	resp, err := ts1.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err = ts2.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.NotEqual(t, resp1, resp.String())
+}
+
+func TestPeerUnavailable(t *testing.T) {
+	t.Parallel()
+
+	ts1 := newTestServer(t)
+	defer ts1.shutdown(t)
+
+	ts2 := newTestServer(t)
+	defer ts2.shutdown(t)
+
+	ts3 := newTestServer(t, potency.WithFailOpen(true))
+	defer ts3.shutdown(t)
+
+	pool := newTestPool(ts2, ts1)
+	pool.SetSecret("wrong")
+	ts2.pot.SetPeerPicker(pool)
+
+	pool = newTestPool(ts3, ts1)
+	pool.SetSecret("wrong")
+	ts3.pot.SetPeerPicker(pool)
+
+	resp, err := ts2.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+	require.Equal(t, "peer_unavailable", resp.Header().Get(potency.ErrorCodeHeader))
+	require.Equal(t, 0, ts2.pot.NumCached())
+
+	resp, err = ts3.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, 0, ts3.pot.NumCached())
+}
+
+func TestHTTPPoolPick(t *testing.T) {
+	t.Parallel()
+
+	peers := []string{"http://a/", "http://b/", "http://c/"}
+	pool := potency.NewHTTPPool("http://a/", peers)
+
+	remote := 0
+
+	for i := 0; i < 300; i++ {
+		_, ok := pool.PickPeer(uniuri.New())
+		if ok {
+			remote++
+		}
+	}
+
+	require.Greater(t, remote, 100)
+	require.Less(t, remote, 300)
+}
+
+func TestPeerHandlerSecret(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	key := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key)).
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	for _, secret := range []string{"", "wrong", testPeerSecret} {
+		req := httptest.NewRequest(http.MethodGet, potency.PeerPath+key, nil)
+		if secret != "" {
+			req.Header.Set(potency.PeerSecretHeader, secret)
+		}
+
+		rec := httptest.NewRecorder()
+		ts.pot.PeerHandler(testPeerSecret).ServeHTTP(rec, req)
+
+		if secret == testPeerSecret {
+			require.Equal(t, http.StatusOK, rec.Code)
+		} else {
+			require.Equal(t, http.StatusForbidden, rec.Code)
+		}
+	}
+
+	// Without a secret, nothing is served
+	req := httptest.NewRequest(http.MethodGet, potency.PeerPath+key, nil)
+	rec := httptest.NewRecorder()
+	ts.pot.PeerHandler("").ServeHTTP(rec, req)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+}
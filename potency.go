@@ -2,13 +2,16 @@ package potency
 
 import (
 	"bytes"
-	"crypto/sha256"
+	"container/list"
+	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gopatchy/jsrest"
@@ -17,75 +20,331 @@ import (
 type Potency struct {
 	handler http.Handler
 
-	lifetime time.Duration
-
-	cache       map[string]*savedResult
-	cacheOldest *savedResult
-	cacheNewest *savedResult
+	cache       map[string]*SavedResult
+	cacheOldest *SavedResult
+	cacheNewest *SavedResult
 	cacheMu     sync.RWMutex
 
-	inProgress   map[string]bool
+	principalCount map[string]int
+	sizeBytes      int64
+	evicted        []eviction
+
+	// lru orders cached entries by last use within each retention class
+	// (see EvictionLRU). Replays reorder it under lruMu alone; adding and
+	// removing entries also requires cacheMu.
+	lru   map[Retention]*list.List
+	lruMu sync.Mutex
+
+	tombstones     map[string]*tombstone
+	tombstoneQueue []*tombstone
+
+	inProgress   map[string]*execution
 	inProgressMu sync.Mutex
+	shuttingDown bool
+	lastToken    uint64
+
+	conflictPolicyFunc func(*http.Request) ConflictPolicy
+
+	instanceID  string
+	replicator  Replicator
+	peerPicker  PeerPicker
+	snapshotter func(context.Context, []*SavedResult) error
+	loader      Loader
+
+	cfg config
+
+	async *asyncWriter
+
+	subscribers     map[*subscriber]struct{}
+	subscribersMu   sync.Mutex
+	subscriberCount int32
+
+	// stop ends background work (see WithCompaction and WithAsyncWrites) at
+	// Shutdown.
+	stop       chan struct{}
+	stopOnce   sync.Once
+	background sync.WaitGroup
 }
 
-type savedResult struct {
-	key string
+type execution struct {
+	token   uint64
+	started time.Time
+	summary execSummary
 
-	method        string
-	url           string
-	requestHeader http.Header
-	sha256        []byte
+	// deadline is when the lease ends (see WithLease), or zero.
+	deadline time.Time
 
-	statusCode     int
-	responseHeader http.Header
-	responseBody   []byte
+	done chan struct{}
 
-	added time.Time
-	newer *savedResult
+	// sending is closed once the handler has committed a response that
+	// will be stored.
+	sending     chan struct{}
+	sendingOnce sync.Once
+
+	// lost is set when the key was taken away (see WithWatchdog and
+	// WithLease); the execution's result must not be saved.
+	lost     atomic.Bool
+	doneOnce sync.Once
+
+	// flagged is set once the watchdog reported the execution. Guarded by
+	// inProgressMu.
+	flagged bool
 }
 
-var (
-	ErrConflict       = errors.New("conflict")
-	ErrMismatch       = errors.New("idempotency mismatch")
-	ErrBodyMismatch   = fmt.Errorf("request body mismatch: %w", ErrMismatch)
-	ErrMethodMismatch = fmt.Errorf("HTTP method mismatch: %w", ErrMismatch)
-	ErrURLMismatch    = fmt.Errorf("URL mismatch: %w", ErrMismatch)
-	ErrHeaderMismatch = fmt.Errorf("Header mismatch: %w", ErrMismatch)
-	ErrInvalidKey     = errors.New("invalid Idempotency-Key")
-
-	criticalHeaders = []string{
-		"Accept",
-		"Authorization",
+func (exec *execution) markSending() {
+	exec.sendingOnce.Do(func() { close(exec.sending) })
+}
+
+func (exec *execution) isSending() bool {
+	select {
+	case <-exec.sending:
+		return true
+	default:
+		return false
 	}
+}
+
+type SavedResult struct {
+	Key string
+
+	Method        string
+	URL           string
+	RequestHeader http.Header
+	BodyHash      []byte
+
+	// RequestDigest replaces URL and RequestHeader with WithIdentityDigest.
+	RequestDigest []byte
+
+	StatusCode      int
+	ResponseHeader  http.Header
+	ResponseBody    []byte
+	ResponseTrailer http.Header
+
+	Added time.Time
+
+	// Principal is the caller that created the result (see WithPrincipal).
+	Principal string
+
+	// RequestID identifies the request that produced the result, for
+	// correlating replays with the original execution's logs.
+	RequestID string
+
+	// ClientIP and UserAgent describe the client that created the result
+	// (see WithProvenance).
+	ClientIP  string
+	UserAgent string
+
+	newer     *SavedResult
+	retention Retention
+	size      int64
+
+	stats *entryStats
+
+	// lruElem is sr's place in the LRU order while cached. Guarded by
+	// cacheMu and lruMu.
+	lruElem *list.Element
+
+	// packed replaces ResponseBody in the cache when codec compressed it
+	// (see WithBodyCompression).
+	packed []byte
+	codec  *codec
+}
+
+const (
+	// ReplayedHeader is set on responses served from the cache.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	// OriginalRequestIDHeader carries the saved RequestID on replays.
+	OriginalRequestIDHeader = "Idempotency-Original-Request-Id"
+)
+
+var (
+	ErrConflict         = errors.New("idempotency conflict: request in progress")
+	ErrMismatch         = errors.New("idempotency mismatch")
+	ErrBodyMismatch     = fmt.Errorf("request body mismatch: %w", ErrMismatch)
+	ErrMethodMismatch   = fmt.Errorf("HTTP method mismatch: %w", ErrMismatch)
+	ErrURLMismatch      = fmt.Errorf("URL mismatch: %w", ErrMismatch)
+	ErrHeaderMismatch   = fmt.Errorf("Header mismatch: %w", ErrMismatch)
+	ErrIdentityMismatch = fmt.Errorf("request identity mismatch: %w", ErrMismatch)
+	ErrInvalidKey       = errors.New("invalid Idempotency-Key")
+	ErrShuttingDown     = errors.New("shutting down")
+	ErrBodyTooLarge     = errors.New("request body too large")
 )
 
-func NewPotency(handler http.Handler) *Potency {
-	return &Potency{
-		handler:    handler,
-		lifetime:   6 * time.Hour,
-		cache:      map[string]*savedResult{},
-		inProgress: map[string]bool{},
+func NewPotency(handler http.Handler, opts ...Option) *Potency {
+	p := &Potency{
+		handler:        handler,
+		cache:          map[string]*SavedResult{},
+		principalCount: map[string]int{},
+		lru:            map[Retention]*list.List{},
+		tombstones:     map[string]*tombstone{},
+		inProgress:     map[string]*execution{},
+		lastToken:      uint64(time.Now().UnixNano()),
+		instanceID:     newInstanceID(),
+		cfg:            newConfig(),
+		subscribers:    map[*subscriber]struct{}{},
+		stop:           make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(&p.cfg)
+	}
+
+	if p.cfg.compactInterval > 0 {
+		p.background.Add(1)
+
+		go p.compactLoop(p.cfg.compactInterval)
+	}
+
+	if p.cfg.watchdogThreshold > 0 {
+		p.background.Add(1)
+
+		go p.watchdogLoop(p.cfg.watchdogThreshold)
+	}
+
+	p.async = newAsyncWriter(p.cfg)
+	if p.async != nil {
+		p.background.Add(1)
+
+		go p.asyncLoop()
 	}
+
+	return p
 }
 
 func (p *Potency) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	val := r.Header.Get("Idempotency-Key")
-	if val == "" {
-		p.handler.ServeHTTP(w, r)
+	p.serve(w, r, p.handler)
+}
+
+// Handler returns an http.Handler that applies idempotency handling in front
+// of next, sharing p's cache and configuration. This lets framework adapters
+// supply a per-request handler.
+func (p *Potency) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.serve(w, r, next)
+	})
+}
+
+func (p *Potency) serve(w http.ResponseWriter, r *http.Request, handler http.Handler) {
+	cfg := p.config()
+
+	if cfg.bypassMethod(r.Method) {
+		handler.ServeHTTP(w, r)
+		return
+	}
+
+	cfg = cfg.forMethod(r.Method)
+
+	if cfg.bypassMethod(r.Method) {
+		handler.ServeHTTP(w, r)
+		return
+	}
+
+	key, err := cfg.keyExtractor(r)
+	if err != nil {
+		cfg.writeError(w, r, jsrest.Errorf(jsrest.ErrBadRequest, "%w", err))
+		return
+	}
+
+	if key == "" {
+		if cfg.conformance && requiresKey(r.Method) {
+			cfg.writeError(w, r, missingKeyError(r))
+			return
+		}
+
+		handler.ServeHTTP(w, r)
 		return
 	}
 
-	err := p.serveHTTP(w, r, val)
+	err = cfg.checkKeyPolicy(key)
 	if err != nil {
-		jsrest.WriteError(w, err)
+		cfg.writeError(w, r, jsrest.Errorf(jsrest.ErrBadRequest, "%w", err))
+		return
 	}
+
+	started := time.Now()
+
+	outcome, err := p.serveHTTP(w, r, handler, cfg.scopedKey(r, key), cfg)
+	if err != nil {
+		outcome = errorOutcome(err)
+		cfg.setCacheStatus(w.Header(), cacheStatusOf(outcome))
+		cfg.writeError(w, r, err)
+	}
+
+	cfg.observe(r, outcome)
+	cfg.auditRequest(r, key, outcome, started)
 }
 
+// SetLifetime changes how long results are kept. The new lifetime applies to
+// every entry, including those already cached: shortening it expires older
+// entries immediately, and lengthening it extends entries that haven't been
+// removed yet.
 func (p *Potency) SetLifetime(lifetime time.Duration) {
 	p.cacheMu.Lock()
-	defer p.cacheMu.Unlock()
+	defer p.unlockAndNotify()
 
-	p.lifetime = lifetime
+	p.cfg.lifetime = lifetime
+	p.removeExpired()
+}
+
+// Invalidate removes key locally, from replicas and from the store.
+func (p *Potency) Invalidate(ctx context.Context, key string) error {
+	p.retire(key)
+	p.publish(replicationInvalidate, key, nil)
+
+	return p.storeDelete(ctx, key, p.config())
+}
+
+// InvalidateWhere removes every local entry for which match returns true,
+// e.g. all entries for a URL prefix or principal, and returns how many there
+// were. Replicas drop the same keys. A store implementing Purger is purged
+// with match too; otherwise only the matched keys are deleted from it. match
+// runs with the cache locked and must not call back into p.
+func (p *Potency) InvalidateWhere(ctx context.Context, match func(*SavedResult) bool) (int, error) {
+	if p.async != nil {
+		p.async.forgetWhere(match)
+	}
+
+	p.cacheMu.Lock()
+
+	keys := []string{}
+
+	for key, sr := range p.cache {
+		if match(sr) {
+			p.deleteLocked(sr, EvictManual)
+			p.bury(key, sr.Added, time.Now(), EvictManual)
+			keys = append(keys, key)
+		}
+	}
+
+	p.unlockAndNotify()
+
+	for _, key := range keys {
+		p.publish(replicationInvalidate, key, nil)
+	}
+
+	cfg := p.config()
+
+	if purger, ok := cfg.store.(Purger); ok {
+		ctx, cancel := withTimeout(ctx, cfg.writeTimeout)
+		defer cancel()
+
+		_, err := purger.DeleteWhere(ctx, cfg.storeMatch(match))
+		if err != nil {
+			return len(keys), fmt.Errorf("delete where: %s (%w)", err, ErrStore)
+		}
+
+		return len(keys), nil
+	}
+
+	for _, key := range keys {
+		err := p.storeDelete(ctx, key, cfg)
+		if err != nil {
+			return len(keys), err
+		}
+	}
+
+	return len(keys), nil
 }
 
 func (p *Potency) NumCached() int {
@@ -95,125 +354,578 @@ func (p *Potency) NumCached() int {
 	return len(p.cache)
 }
 
-func (p *Potency) serveHTTP(w http.ResponseWriter, r *http.Request, val string) error {
-	if len(val) < 2 || !strings.HasPrefix(val, `"`) || !strings.HasSuffix(val, `"`) {
-		return jsrest.Errorf(jsrest.ErrBadRequest, "%s (%w)", val, ErrInvalidKey)
+func (p *Potency) serveHTTP(w http.ResponseWriter, r *http.Request, handler http.Handler, key string, cfg config) (Outcome, error) {
+	if cfg.isStreaming(r, nil) {
+		cfg.setCacheStatus(w.Header(), CacheStatusBypass)
+		handler.ServeHTTP(w, r)
+		return OutcomeBypassed, nil
 	}
 
-	key := val[1 : len(val)-1]
+	if cfg.maxRequestBodySize > 0 && r.ContentLength > cfg.maxRequestBodySize {
+		if cfg.oversizePolicy == OversizeBypass {
+			cfg.setCacheStatus(w.Header(), CacheStatusBypass)
+			handler.ServeHTTP(w, r)
+			return OutcomeBypassed, nil
+		}
+
+		return "", jsrest.Errorf(jsrest.ErrRequestEntityTooLarge, "%d > %d (%w)", r.ContentLength, cfg.maxRequestBodySize, ErrBodyTooLarge)
+	}
 
-	saved := p.read(key)
+	policy := p.conflictPolicy(r, cfg)
 
-	if saved != nil {
-		if r.Method != saved.method {
-			return jsrest.Errorf(jsrest.ErrBadRequest, "%s (%w)", r.Method, ErrMethodMismatch)
+	if policy == ConflictProxy {
+		if p.forwardToPeer(w, r, key) {
+			return OutcomeForwarded, nil
 		}
 
-		if r.URL.String() != saved.url {
-			return jsrest.Errorf(jsrest.ErrBadRequest, "%s (%w)", r.URL.String(), ErrURLMismatch)
+		// This instance owns the key (or the request was forwarded here), so
+		// duplicates wait for it
+		policy = ConflictWait
+	}
+
+	waitCtx := r.Context()
+
+	if cfg.maxWait > 0 {
+		var cancel context.CancelFunc
+
+		waitCtx, cancel = context.WithTimeout(waitCtx, cfg.maxWait)
+		defer cancel()
+	}
+
+	for {
+		saved, err := p.lookup(r.Context(), key, cfg)
+		if err != nil {
+			if cfg.failOpen {
+				cfg.setCacheStatus(w.Header(), CacheStatusBypass)
+				handler.ServeHTTP(w, r)
+				return OutcomeBypassed, nil
+			}
+
+			return "", jsrest.Errorf(jsrest.ErrServiceUnavailable, "%w", err)
 		}
 
-		for _, h := range criticalHeaders {
-			if saved.requestHeader.Get(h) != r.Header.Get(h) {
-				return jsrest.Errorf(jsrest.ErrBadRequest, "%s: %s (%w)", h, r.Header.Get(h), ErrHeaderMismatch)
+		if saved != nil {
+			strict := cfg.strict(saved)
+
+			rewind := func() {}
+			if !strict {
+				rewind = teeBody(r)
 			}
+
+			err := p.replay(w, r, saved, cfg)
+
+			switch {
+			case errors.Is(err, ErrCorrupt):
+				// Its response is lost, so look again or execute afresh
+				rewind()
+				p.dropCorrupt(saved)
+
+				continue
+			case strict || !errors.Is(err, ErrMismatch):
+				return OutcomeReplayed, err
+			}
+
+			// Past the strict window, a different request executes afresh
+			rewind()
+			p.remove(key)
+		}
+
+		err = p.checkTombstone(r, key, cfg)
+		if err != nil {
+			return "", err
 		}
 
-		h := sha256.New()
+		if principal := cfg.principalOf(r); p.overQuota(principal) {
+			return "", jsrest.Errorf(jsrest.ErrTooManyRequests, "%s (%w)", principal, ErrQuotaExceeded)
+		}
+
+		// Store miss, proceed to normal execution with interception
+		exec, raced, err := p.lockMissing(key, execSummary{method: r.Method, path: r.URL.Path, requestID: cfg.requestID(r)}, cfg.lease)
+		if raced {
+			continue
+		}
 
-		_, err := io.Copy(h, r.Body)
+		if err == nil {
+			defer p.unlockKey(key, exec)
+
+			if cfg.limiter != nil {
+				if ok, wait := cfg.limiter.allow(r, &cfg); !ok {
+					w.Header().Set("Retry-After", retryAfter(wait))
+					return "", jsrest.Errorf(jsrest.ErrTooManyRequests, "%s (%w)", key, ErrRateLimited)
+				}
+			}
+
+			ctx, cancel := exec.context(r.Context())
+			defer cancel()
+
+			if p.execute(w, r.WithContext(ctx), handler, key, exec, cfg) {
+				return OutcomeStored, nil
+			}
+
+			return OutcomeNotStored, nil
+		}
+
+		if errors.Is(err, ErrShuttingDown) {
+			return "", jsrest.Errorf(jsrest.ErrServiceUnavailable, "%s (%w)", key, err)
+		}
+
+		if policy != ConflictWait && !(cfg.waitWhileSending && exec.isSending()) {
+			return "", jsrest.SilentJoin(err, cfg.conflictError())
+		}
+
+		select {
+		case <-exec.done:
+		case <-waitCtx.Done():
+			if r.Context().Err() == nil {
+				w.Header().Set("Retry-After", retryAfter(cfg.maxWait))
+			}
+
+			return "", jsrest.SilentJoin(&InProgressError{Key: key, Since: exec.started, cause: waitCtx.Err()}, cfg.conflictError())
+		}
+	}
+}
+
+func (p *Potency) replay(w http.ResponseWriter, r *http.Request, saved *SavedResult, cfg config) error {
+	// Checked first so that a corrupt entry leaves r unread
+	body, header, err := negotiateEncoding(r, saved, cfg)
+	if err != nil {
+		return err
+	}
+
+	err = cfg.authorizeReplay(r, saved)
+	if err != nil {
+		return err
+	}
+
+	err = cfg.checkIdentity(r, saved)
+	if err != nil {
+		return err
+	}
+
+	if !bodiless(r) || !bytes.Equal(saved.BodyHash, cfg.newHash().Sum(nil)) {
+		err := checkBody(r, saved, cfg)
 		if err != nil {
-			return jsrest.Errorf(jsrest.ErrBadRequest, "hash request body failed (%w)", err)
+			return err
 		}
+	}
 
-		sha256 := h.Sum(nil)
-		if !bytes.Equal(sha256, saved.sha256) {
-			return jsrest.Errorf(jsrest.ErrBadRequest, "%s vs %s (%w)", sha256, saved.sha256, ErrBodyMismatch)
+	if !p.countReplay(saved, cfg.maxReplays) {
+		return jsrest.Errorf(jsrest.ErrTooManyRequests, "%s: %d (%w)", saved.Key, cfg.maxReplays, ErrTooManyReplays)
+	}
+
+	cfg.setCacheStatus(w.Header(), CacheStatusReplay)
+
+	if saved.StatusCode >= 200 && saved.StatusCode < 300 && notModified(r, header.Get("ETag")) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			return jsrest.Errorf(jsrest.ErrPreconditionFailed, "%s (%w)", saved.Key, ErrPreconditionFailed)
 		}
 
-		for key, vals := range saved.responseHeader {
-			w.Header().Set(key, vals[0])
+		writeNotModified(w, header, saved.RequestID)
+		return nil
+	}
+
+	for key, vals := range header {
+		// nil values (e.g. a suppressed Content-Type) are kept too
+		w.Header()[key] = append([]string(nil), vals...)
+	}
+
+	cfg.rewriteHeaders(w.Header(), r, saved)
+
+	// Framing comes from the stored body, not the original transfer
+	w.Header().Del("Transfer-Encoding")
+
+	if r.Method != http.MethodHead {
+		w.Header().Del("Content-Length")
+
+		if len(saved.ResponseTrailer) == 0 && bodyAllowedForStatus(saved.StatusCode) {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
 		}
+	}
+
+	w.Header().Set(ReplayedHeader, "true")
 
-		w.WriteHeader(saved.statusCode)
-		_, _ = w.Write(saved.responseBody)
+	if saved.RequestID != "" {
+		w.Header().Set(OriginalRequestIDHeader, saved.RequestID)
+	}
 
+	if ranged(r, saved) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
 		return nil
 	}
 
-	// Store miss, proceed to normal execution with interception
-	err := p.lockKey(key)
+	for key := range saved.ResponseTrailer {
+		w.Header().Add("Trailer", key)
+	}
+
+	w.WriteHeader(saved.StatusCode)
+
+	// Bodies are held in memory, so a single Write is already zero-copy:
+	// net/http hands slices larger than its buffer straight to the
+	// connection. Routing this through io.Copy would only add a buffer.
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+
+	for key, vals := range saved.ResponseTrailer {
+		w.Header()[key] = vals
+	}
+
+	return nil
+}
+
+func checkBody(r *http.Request, saved *SavedResult, cfg config) error {
+	h := cfg.newHash()
+
+	body := io.Reader(r.Body)
+	if cfg.maxRequestBodySize > 0 {
+		body = io.LimitReader(body, cfg.maxRequestBodySize+1)
+	}
+
+	n, err := io.Copy(h, body)
 	if err != nil {
-		return jsrest.Errorf(jsrest.ErrConflict, "%s", key)
+		return jsrest.Errorf(jsrest.ErrBadRequest, "hash request body failed (%w)", err)
 	}
 
-	defer p.unlockKey(key)
+	if cfg.maxRequestBodySize > 0 && n > cfg.maxRequestBodySize {
+		return jsrest.Errorf(jsrest.ErrRequestEntityTooLarge, "%d > %d (%w)", n, cfg.maxRequestBodySize, ErrBodyTooLarge)
+	}
 
-	requestHeader := http.Header{}
-	for _, h := range criticalHeaders {
-		requestHeader.Set(h, r.Header.Get(h))
+	sum := h.Sum(nil)
+	if !bytes.Equal(sum, saved.BodyHash) {
+		return jsrest.SilentJoin(&MismatchError{Field: "body", Got: hex.EncodeToString(sum), Want: hex.EncodeToString(saved.BodyHash)}, jsrest.ErrBadRequest)
 	}
 
-	bi := newBodyIntercept(r.Body)
+	return nil
+}
+
+// ranged reports whether replaying saved should honor r's Range header.
+// Only complete 200 responses without trailers can be served partially.
+func ranged(r *http.Request, saved *SavedResult) bool {
+	return r.Header.Get("Range") != "" && saved.StatusCode == http.StatusOK && len(saved.ResponseTrailer) == 0
+}
+
+// bodyAllowedForStatus mirrors net/http's rule for which statuses may carry
+// a body.
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	default:
+		return true
+	}
+}
+
+// bodiless reports whether r is a request of a method that conventionally
+// carries no body and declares none, so replay can skip reading r.Body.
+func bodiless(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodOptions:
+		return r.ContentLength == 0
+
+	default:
+		return false
+	}
+}
+
+// execute runs handler and saves its response, reporting whether it was saved.
+func (p *Potency) execute(w http.ResponseWriter, r *http.Request, handler http.Handler, key string, exec *execution, cfg config) bool {
+	bi := newBodyIntercept(r.Body, cfg.newHash(), cfg.maxRequestBodySize, cfg.oversizePolicy == OversizeReject)
 	r.Body = bi
 
+	getBody := r.GetBody
+
+	defer func() {
+		r.Body = bi.source
+		r.GetBody = getBody
+		bi.release()
+	}()
+
+	if cfg.bufferBodySize > 0 {
+		bi.buffer(r, cfg.bufferBodySize)
+	}
+
 	rwi := newResponseWriterIntercept(w)
+	rwi.isStreaming = func(header http.Header) bool {
+		if !cfg.isStreaming(r, header) {
+			return false
+		}
+
+		cfg.setCacheStatus(header, CacheStatusBypass)
+
+		return true
+	}
+	rwi.onCommit = exec.markSending
 	w = rwi
 
-	p.handler.ServeHTTP(w, r)
+	cfg.setCacheStatus(w.Header(), CacheStatusStore)
 
-	save := &savedResult{
-		key: key,
+	defer rwi.release()
 
-		method:        r.Method,
-		url:           r.URL.String(),
-		requestHeader: requestHeader,
-		sha256:        bi.sha256.Sum(nil),
+	handler.ServeHTTP(w, r)
 
-		statusCode:     rwi.statusCode,
-		responseHeader: rwi.Header(),
-		responseBody:   rwi.buf.Bytes(),
+	// A fingerprint of a partly read body would let a retry with a different
+	// tail replay, and one with the same body mismatch.
+	if bi.drain() != nil {
+		return false
 	}
 
-	p.write(save)
+	if bi.overLimit() || rwi.streaming || (cfg.skipUnwritten && !rwi.wroteHeader) {
+		return false
+	}
 
-	return nil
+	responseHeader, responseTrailer := rwi.split()
+	responseHeader.Del(CacheStatusHeader)
+
+	if cfg.noStore(responseHeader) {
+		return false
+	}
+
+	statusCode := rwi.statusCode
+	responseBody := rwi.buf.Bytes()
+
+	if cfg.malformed(r, key, statusCode, responseHeader, responseBody) {
+		return false
+	}
+
+	if loc := cfg.receipt(statusCode, responseHeader, len(responseBody)); loc != "" {
+		statusCode = http.StatusSeeOther
+		responseHeader = http.Header{"Location": {loc}}
+		responseBody = nil
+		responseTrailer = nil
+	}
+
+	if cfg.statusOnly {
+		responseHeader.Del("Content-Length")
+		responseHeader.Del("Content-Encoding")
+		responseHeader.Del("Trailer")
+		responseBody = nil
+		responseTrailer = nil
+	}
+
+	// net/http sniffs the Content-Type of responses that don't set one;
+	// record it so replays carry the same header.
+	if _, found := responseHeader["Content-Type"]; !found && responseHeader.Get("Transfer-Encoding") == "" && bodyAllowedForStatus(statusCode) && len(responseBody) > 0 {
+		responseHeader.Set("Content-Type", http.DetectContentType(responseBody))
+	}
+
+	if statusCode >= 200 && statusCode < 300 && responseHeader.Get("ETag") == "" {
+		responseHeader.Set("ETag", newETag(cfg.newHash(), responseBody))
+	}
+
+	responseBody = append([]byte(nil), responseBody...)
+
+	if r.Method == http.MethodHead {
+		// net/http discards HEAD bodies but derives Content-Length from them
+		if responseHeader.Get("Content-Length") == "" && len(responseBody) > 0 {
+			responseHeader.Set("Content-Length", strconv.Itoa(len(responseBody)))
+		}
+
+		responseBody = nil
+	}
+
+	save := &SavedResult{
+		Key: key,
+
+		BodyHash: bi.hash.Sum(nil),
+
+		StatusCode:      statusCode,
+		ResponseHeader:  responseHeader,
+		ResponseBody:    responseBody,
+		ResponseTrailer: responseTrailer,
+	}
+
+	cfg.identify(r, save)
+
+	if !exec.owned() {
+		return false
+	}
+
+	// Detached from the request so a client disconnect doesn't abort the
+	// save. The response has been sent; a store failure leaves it cached
+	// locally.
+	_ = p.write(context.Background(), save, cfg)
+
+	return true
 }
 
-func (p *Potency) lockKey(key string) error {
+// lockKey reserves key for a new execution. If key is already reserved, it
+// returns the existing execution along with an *InProgressError.
+func (p *Potency) lockKey(key string, summary execSummary, lease time.Duration) (*execution, error) {
 	p.inProgressMu.Lock()
 	defer p.inProgressMu.Unlock()
 
-	if p.inProgress[key] {
-		return ErrConflict
+	if p.shuttingDown {
+		return nil, ErrShuttingDown
 	}
 
-	p.inProgress[key] = true
+	now := time.Now()
 
-	return nil
+	if exec := p.inProgress[key]; exec != nil {
+		if exec.deadline.IsZero() || now.Before(exec.deadline) {
+			return exec, &InProgressError{Key: key, Since: exec.started}
+		}
+
+		// The lease ran out; the key is up for grabs
+		exec.lose()
+	}
+
+	p.lastToken++
+
+	exec := &execution{
+		token:   p.lastToken,
+		started: now,
+		summary: summary,
+		done:    make(chan struct{}),
+		sending: make(chan struct{}),
+	}
+
+	if lease > 0 {
+		exec.deadline = now.Add(lease)
+	}
+
+	p.inProgress[key] = exec
+
+	return exec, nil
+}
+
+// lockMissing reserves key after a lookup missed. An execution that saved
+// key and released it in between would otherwise be repeated, so it reports
+// raced, without a reservation, if key is now cached; the caller looks it up
+// again.
+func (p *Potency) lockMissing(key string, summary execSummary, lease time.Duration) (*execution, bool, error) {
+	exec, err := p.lockKey(key, summary, lease)
+	if err != nil {
+		return exec, false, err
+	}
+
+	// The result is cached before its execution is released
+	if p.read(key) != nil || p.readPending(key) != nil {
+		p.unlockKey(key, exec)
+		return nil, true, nil
+	}
+
+	return exec, false, nil
 }
 
-func (p *Potency) unlockKey(key string) {
+func (p *Potency) unlockKey(key string, exec *execution) {
 	p.inProgressMu.Lock()
 	defer p.inProgressMu.Unlock()
 
-	delete(p.inProgress, key)
+	if p.inProgress[key] == exec {
+		delete(p.inProgress, key)
+	}
+
+	exec.doneOnce.Do(func() { close(exec.done) })
 }
 
-func (p *Potency) read(key string) *savedResult {
+func (p *Potency) read(key string) *SavedResult {
 	p.cacheMu.RLock()
-	defer p.cacheMu.RUnlock()
+	sr := p.cache[key]
+	expired := sr != nil && p.expiredLocked(sr)
+	p.cacheMu.RUnlock()
+
+	if !expired {
+		return sr
+	}
 
-	return p.cache[key]
+	p.cacheMu.Lock()
+	defer p.unlockAndNotify()
+
+	if p.cache[key] == sr {
+		p.deleteLocked(sr, EvictExpired)
+	}
+
+	return nil
 }
 
-func (p *Potency) write(sr *savedResult) {
+func (p *Potency) remove(key string) {
+	if p.async != nil {
+		p.async.forget(key)
+	}
+
 	p.cacheMu.Lock()
-	defer p.cacheMu.Unlock()
+	defer p.unlockAndNotify()
+
+	if sr := p.cache[key]; sr != nil {
+		p.deleteLocked(sr, EvictManual)
+	}
+}
 
-	sr.added = time.Now()
+// deleteLocked removes sr, which must be the current entry for its key, from
+// the cache index. It stays in the expiry list until it ages out. Requires
+// cacheMu, released with unlockAndNotify.
+func (p *Potency) deleteLocked(sr *SavedResult, reason EvictReason) {
+	delete(p.cache, sr.Key)
 
-	p.cache[sr.key] = sr
+	if p.cfg.onEvict != nil || p.hasSubscribers() {
+		p.evicted = append(p.evicted, eviction{sr, reason})
+	}
+
+	p.sizeBytes -= sr.size
+	p.lruRemove(sr)
+
+	if reason == EvictExpired {
+		p.bury(sr.Key, sr.Added, p.expiresAt(sr), reason)
+	}
+
+	if sr.Principal != "" {
+		p.principalCount[sr.Principal]--
+
+		if p.principalCount[sr.Principal] <= 0 {
+			delete(p.principalCount, sr.Principal)
+		}
+	}
+}
+
+func (p *Potency) write(ctx context.Context, sr *SavedResult, cfg config) error {
+	sr.Added = time.Now()
+
+	// Scrubbed before it is cached, when replays may start counting
+	ext := cfg.scrub(sr)
+
+	p.insert(sr)
+
+	p.publish(replicationStore, sr.Key, ext)
+
+	if p.async != nil && cfg.store != nil && p.enqueue(ext) {
+		return nil
+	}
+
+	return p.storePut(ctx, ext, cfg)
+}
+
+func (p *Potency) insert(sr *SavedResult) {
+	orig := sr
+	sr = p.pack(sr)
+
+	p.cacheMu.Lock()
+	defer p.unlockAndNotify()
+
+	if existing := p.cache[sr.Key]; existing != nil {
+		if !p.errorExpired(existing) {
+			return
+		}
+
+		p.deleteLocked(existing, EvictExpired)
+	}
+
+	p.cache[sr.Key] = sr
+	delete(p.tombstones, sr.Key)
+
+	sr.size = sizeOf(sr)
+	p.sizeBytes += sr.size
+	sr.retention = p.cfg.retention(orig)
+	p.lruAdd(sr)
+
+	if sr.stats == nil {
+		sr.stats = &entryStats{}
+	}
+
+	if sr.Principal != "" {
+		p.principalCount[sr.Principal]++
+	}
 
 	if p.cacheNewest != nil {
 		p.cacheNewest.newer = sr
@@ -226,13 +938,38 @@ func (p *Potency) write(sr *savedResult) {
 	}
 
 	p.removeExpired()
+	p.enforceQuota(sr)
+	p.enforceMaxBytes()
+}
+
+// errorExpired reports whether sr is an error response older than the error
+// lifetime. Such entries stay in the expiry list until the full lifetime but
+// are no longer served. Requires cacheMu.
+func (p *Potency) errorExpired(sr *SavedResult) bool {
+	if p.cfg.errorLifetime <= 0 || sr.StatusCode < 400 {
+		return false
+	}
+
+	return time.Since(sr.Added) > p.cfg.errorLifetime
 }
 
+// removeExpired walks the expiry list from the oldest entry. With lifetime
+// jitter, an entry that hasn't expired yet holds back newer ones that have;
+// read treats those as misses until they are removed. Requires cacheMu.
 func (p *Potency) removeExpired() {
-	cutoff := time.Now().Add(-1 * p.lifetime)
+	now := time.Now()
 
-	for iter := p.cacheOldest; iter != nil && iter.added.Before(cutoff); iter = iter.newer {
-		delete(p.cache, iter.key)
-		p.cacheOldest = iter
+	for p.cacheOldest != nil && now.After(p.expiresAt(p.cacheOldest)) {
+		iter := p.cacheOldest
+
+		if p.cache[iter.Key] == iter {
+			p.deleteLocked(iter, EvictExpired)
+		}
+
+		p.cacheOldest = iter.newer
+	}
+
+	if p.cacheOldest == nil {
+		p.cacheNewest = nil
 	}
 }
@@ -6,6 +6,9 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
 	"os"
 	"testing"
 	"time"
@@ -30,6 +33,7 @@ func TestGET(t *testing.T) {
 	require.NoError(t, err)
 	require.False(t, resp.IsError())
 	require.Equal(t, "bar", resp.Header().Get("X-Response"))
+	require.Empty(t, resp.Header().Get(potency.ReplayedHeader))
 
 	resp1 := resp.String()
 
@@ -39,6 +43,7 @@ func TestGET(t *testing.T) {
 	require.NoError(t, err)
 	require.False(t, resp.IsError())
 	require.Equal(t, "bar", resp.Header().Get("X-Response"))
+	require.Equal(t, "true", resp.Header().Get(potency.ReplayedHeader))
 	require.Equal(t, resp1, resp.String())
 
 	key2 := uniuri.New()
@@ -123,6 +128,73 @@ func TestPOST(t *testing.T) {
 	require.True(t, resp.IsError())
 }
 
+func TestTrailer(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Get("trailer")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+	checksum := resp.RawResponse.Trailer.Get("X-Checksum")
+	require.NotEmpty(t, checksum)
+	require.Equal(t, "extra", resp.RawResponse.Trailer.Get("X-Extra"))
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Get("trailer")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, resp1, resp.String())
+	require.Equal(t, checksum, resp.RawResponse.Trailer.Get("X-Checksum"))
+	require.Equal(t, "extra", resp.RawResponse.Trailer.Get("X-Extra"))
+	require.Empty(t, resp.Header().Get("X-Checksum"))
+}
+
+func TestEarlyHints(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	hints := 0
+
+	ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			require.Equal(t, http.StatusEarlyHints, code)
+			hints++
+
+			return nil
+		},
+	})
+
+	resp, err := ts.r().
+		SetContext(ctx).
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Get("hints")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+	require.Equal(t, 1, hints)
+
+	resp1 := resp.String()
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Get("hints")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+	require.Equal(t, resp1, resp.String())
+}
+
 func TestExpire(t *testing.T) {
 	t.Parallel()
 
@@ -169,19 +241,59 @@ func TestExpire(t *testing.T) {
 	require.Equal(t, 1, ts.pot.NumCached())
 }
 
+func TestSetLifetimeExisting(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	post := func(key string) string {
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key)).
+			Post("")
+		require.NoError(t, err)
+		require.False(t, resp.IsError())
+
+		return resp.String()
+	}
+
+	key1 := uniuri.New()
+	resp1 := post(key1)
+
+	ts.pot.SetLifetime(200 * time.Millisecond)
+	ts.pot.SetLifetime(1 * time.Hour)
+
+	time.Sleep(300 * time.Millisecond)
+
+	require.Equal(t, resp1, post(key1))
+
+	ts.pot.SetLifetime(200 * time.Millisecond)
+	require.Equal(t, 0, ts.pot.NumCached())
+
+	key2 := uniuri.New()
+	resp2 := post(key2)
+
+	time.Sleep(300 * time.Millisecond)
+
+	require.NotEqual(t, resp2, post(key2))
+}
+
 type testServer struct {
-	dir string
-	pot *potency.Potency
-	srv *http.Server
-	rst *resty.Client
+	url     string
+	peerURL string
+	dir     string
+	pot     *potency.Potency
+	srv     *http.Server
+	peerSrv *http.Server
+	rst     *resty.Client
 }
 
-func newTestServer(t *testing.T) *testServer {
+func newTestServer(t *testing.T, opts ...potency.Option) *testServer {
 	dir, err := os.MkdirTemp("", "")
 	require.NoError(t, err)
 
 	mux := http.NewServeMux()
-	p := potency.NewPotency(mux)
+	p := potency.NewPotency(mux, opts...)
 
 	listener, err := net.Listen("tcp", "[::]:0")
 	require.NoError(t, err)
@@ -196,6 +308,47 @@ func newTestServer(t *testing.T) *testServer {
 		require.NoError(t, err)
 	})
 
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+
+		_, err := w.Write([]byte(uniuri.New()))
+		require.NoError(t, err)
+	})
+
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		_, err := w.Write([]byte(uniuri.New()))
+		require.NoError(t, err)
+	})
+
+	mux.HandleFunc("/trailer", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+
+		_, err := w.Write([]byte(uniuri.New()))
+		require.NoError(t, err)
+
+		w.Header().Set("X-Checksum", uniuri.New())
+		w.Header().Set(http.TrailerPrefix+"X-Extra", "extra")
+	})
+
+	mux.HandleFunc("/hints", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+
+		_, err := w.Write([]byte(uniuri.New()))
+		require.NoError(t, err)
+	})
+
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		_, err := fmt.Fprintf(w, "data: %s\n\n", uniuri.New())
+		require.NoError(t, err)
+
+		w.(http.Flusher).Flush()
+	})
+
 	srv := &http.Server{
 		Handler:           p,
 		ReadHeaderTimeout: 1 * time.Second,
@@ -207,18 +360,57 @@ func newTestServer(t *testing.T) *testServer {
 
 	baseURL := fmt.Sprintf("http://[::1]:%d/", listener.Addr().(*net.TCPAddr).Port)
 
+	// Peers fetch results from a separate, internal listener
+	peerListener, err := net.Listen("tcp", "[::1]:0")
+	require.NoError(t, err)
+
+	peerMux := http.NewServeMux()
+	peerMux.Handle(potency.PeerPath, p.PeerHandler(testPeerSecret))
+
+	peerSrv := &http.Server{
+		Handler:           peerMux,
+		ReadHeaderTimeout: 1 * time.Second,
+	}
+
+	go func() {
+		_ = peerSrv.Serve(peerListener)
+	}()
+
 	rst := resty.New().
 		SetHeader("Content-Type", "application/json").
 		SetBaseURL(baseURL)
 
 	return &testServer{
-		dir: dir,
-		pot: p,
-		srv: srv,
-		rst: rst,
+		url:     baseURL,
+		peerURL: fmt.Sprintf("http://[::1]:%d/", peerListener.Addr().(*net.TCPAddr).Port),
+		dir:     dir,
+		pot:     p,
+		srv:     srv,
+		peerSrv: peerSrv,
+		rst:     rst,
 	}
 }
 
+const testPeerSecret = "test-peer-secret"
+
+// newTestPool returns an HTTPPool for self over peers, fetching from their
+// internal listeners.
+func newTestPool(self *testServer, peers ...*testServer) *potency.HTTPPool {
+	urls := []string{}
+	fetchURLs := map[string]string{}
+
+	for _, peer := range peers {
+		urls = append(urls, peer.url)
+		fetchURLs[peer.url] = peer.peerURL
+	}
+
+	pool := potency.NewHTTPPool(self.url, urls)
+	pool.SetSecret(testPeerSecret)
+	pool.SetFetchURL(func(peer string) string { return fetchURLs[peer] })
+
+	return pool
+}
+
 func (ts *testServer) r() *resty.Request {
 	return ts.rst.R()
 }
@@ -227,5 +419,72 @@ func (ts *testServer) shutdown(t *testing.T) {
 	err := ts.srv.Shutdown(context.Background())
 	require.NoError(t, err)
 
+	err = ts.peerSrv.Shutdown(context.Background())
+	require.NoError(t, err)
+
 	os.RemoveAll(ts.dir)
 }
+
+func TestGETSkipsBody(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(uniuri.New()))
+	}))
+
+	key1 := fmt.Sprintf(`"%s"`, uniuri.New())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Idempotency-Key", key1)
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	resp1 := rec.Body.String()
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Idempotency-Key", key1)
+	req.Body = io.NopCloser(errReader{})
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, resp1, rec.Body.String())
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+func TestInvalidateWhere(t *testing.T) {
+	t.Parallel()
+
+	store := newTestStore()
+
+	ts := newTestServer(t, potency.WithPrincipal(userPrincipal), potency.WithStore(store))
+	defer ts.shutdown(t)
+
+	keyA1 := uniuri.New()
+	keyA2 := uniuri.New()
+	keyB := uniuri.New()
+
+	for _, post := range []struct{ user, key string }{{"a", keyA1}, {"a", keyA2}, {"b", keyB}} {
+		resp := ts.postAs(t, post.user, post.key)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+	}
+
+	require.Equal(t, 3, store.len())
+
+	n, err := ts.pot.InvalidateWhere(context.Background(), func(sr *potency.SavedResult) bool {
+		return sr.Principal == "a"
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	require.Equal(t, 1, ts.pot.NumCached())
+	require.Equal(t, 1, store.len())
+	require.NotNil(t, mustLookup(t, ts.pot, keyB))
+	require.Nil(t, mustLookup(t, ts.pot, keyA1))
+}
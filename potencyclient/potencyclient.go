@@ -0,0 +1,203 @@
+package potencyclient
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transport is an http.RoundTripper that attaches an Idempotency-Key to
+// requests of protected methods and retries them, reusing the same key, on
+// network errors and transient statuses. Between attempts it waits as long as
+// the response's Retry-After asks, or else backs off exponentially. Requests
+// of other methods pass through once, without a key.
+type Transport struct {
+	base http.RoundTripper
+
+	methods     map[string]bool
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+}
+
+func NewTransport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	t := &Transport{
+		base:        base,
+		maxAttempts: 4,
+		minBackoff:  100 * time.Millisecond,
+		maxBackoff:  5 * time.Second,
+	}
+
+	t.SetMethods(http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete)
+
+	return t
+}
+
+func (t *Transport) SetMethods(methods ...string) {
+	t.methods = map[string]bool{}
+
+	for _, method := range methods {
+		t.methods[method] = true
+	}
+}
+
+func (t *Transport) SetMaxAttempts(maxAttempts int) {
+	t.maxAttempts = maxAttempts
+}
+
+func (t *Transport) SetBackoff(minBackoff, maxBackoff time.Duration) {
+	t.minBackoff = minBackoff
+	t.maxBackoff = maxBackoff
+}
+
+// NewKey returns a random key, already quoted for the Idempotency-Key header.
+func NewKey() string {
+	buf := make([]byte, 18)
+	_, _ = rand.Read(buf)
+
+	return `"` + base64.RawURLEncoding.EncodeToString(buf) + `"`
+}
+
+// QuoteKey quotes key for the Idempotency-Key header, escaping backslashes
+// and double quotes, e.g. to send an ID from another system as the key.
+func QuoteKey(key string) string {
+	return `"` + keyEscaper.Replace(key) + `"`
+}
+
+var keyEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.methods[req.Method] {
+		return t.base.RoundTrip(req)
+	}
+
+	getBody, err := bodyGetter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	key := req.Header.Get("Idempotency-Key")
+	if key == "" {
+		key = NewKey()
+	}
+
+	backoff := t.minBackoff
+
+	for attempt := 1; ; attempt++ {
+		attemptReq := req.Clone(req.Context())
+		attemptReq.Header.Set("Idempotency-Key", key)
+
+		if getBody != nil {
+			attemptReq.Body, err = getBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := t.base.RoundTrip(attemptReq)
+
+		if attempt >= t.maxAttempts || !retryable(resp, err) {
+			return resp, err
+		}
+
+		wait, ok := retryAfter(resp)
+		if !ok {
+			wait = backoff
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+
+		backoff *= 2
+		if backoff > t.maxBackoff {
+			backoff = t.maxBackoff
+		}
+	}
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusConflict, // original still in progress
+		http.StatusTooEarly,
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+
+	default:
+		return false
+	}
+}
+
+// retryAfter returns the delay resp's Retry-After header asks for, given in
+// seconds or as an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	val := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if val == "" {
+		return 0, false
+	}
+
+	secs, err := strconv.Atoi(val)
+	if err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	at, err := http.ParseTime(val)
+	if err != nil {
+		return 0, false
+	}
+
+	wait := time.Until(at)
+	if wait < 0 {
+		wait = 0
+	}
+
+	return wait, true
+}
+
+func bodyGetter(req *http.Request) (func() (io.ReadCloser, error), error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if req.GetBody != nil {
+		return req.GetBody, nil
+	}
+
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Body.Close()
+
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}, nil
+}
@@ -0,0 +1,145 @@
+package potencyclient_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/gopatchy/potency/potencyclient"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+
+	calls := int32(0)
+	failures := int32(2)
+
+	p := potency.NewPotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		_, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		_, _ = w.Write([]byte(uniuri.New()))
+	}))
+
+	keys := []string{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			_, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		p.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	tr := potencyclient.NewTransport(srv.Client().Transport)
+	tr.SetBackoff(time.Millisecond, 10*time.Millisecond)
+
+	client := &http.Client{Transport: tr}
+
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("test1"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, potencyclient.Executed, potencyclient.Check(resp))
+	resp.Body.Close()
+
+	require.Len(t, keys, 3)
+	require.NotEmpty(t, keys[0])
+	require.Equal(t, keys[0], keys[1])
+	require.Equal(t, keys[0], keys[2])
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("test1"))
+	require.NoError(t, err)
+	req.Header.Set("Idempotency-Key", keys[0])
+	req.Header.Set("Content-Type", "text/plain")
+
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, potencyclient.Replayed, potencyclient.Check(resp))
+	resp.Body.Close()
+
+	resp, err = client.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Empty(t, keys[len(keys)-1])
+}
+
+func TestTransportRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	failures := int32(1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusConflict)
+
+			return
+		}
+
+		_, _ = w.Write([]byte("done"))
+	}))
+	defer srv.Close()
+
+	tr := potencyclient.NewTransport(srv.Client().Transport)
+	tr.SetBackoff(time.Millisecond, 10*time.Millisecond)
+
+	client := &http.Client{Transport: tr}
+
+	start := time.Now()
+
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("test1"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	require.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestQuoteKey(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, `"abc"`, potencyclient.QuoteKey("abc"))
+	require.Equal(t, `"a\"b\\c"`, potencyclient.QuoteKey(`a"b\c`))
+
+	for _, opt := range []potency.Option{
+		potency.WithKeyParsing(potency.KeyLenient),
+		potency.WithKeyParsing(potency.KeyStrict),
+		potency.WithConformance(""),
+	} {
+		p := potency.NewPotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(uniuri.New()))
+		}), opt)
+
+		key := uniuri.New() + `"\`
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Idempotency-Key", potencyclient.QuoteKey(key))
+
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		saved, err := p.Lookup(context.Background(), key)
+		require.NoError(t, err)
+		require.NotNil(t, saved)
+	}
+}
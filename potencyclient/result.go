@@ -0,0 +1,66 @@
+package potencyclient
+
+import (
+	"net/http"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/gopatchy/potency"
+)
+
+type Result int
+
+const (
+	// Executed means the server ran the request (or the response did not
+	// come from idempotency handling at all).
+	Executed Result = iota
+
+	// Replayed means the response was served from the server's cache.
+	Replayed
+
+	// InProgress means another request with the same key is still running.
+	InProgress
+
+	// Mismatch means the key was reused with a different request.
+	Mismatch
+)
+
+func (r Result) String() string {
+	switch r {
+	case Executed:
+		return "executed"
+	case Replayed:
+		return "replayed"
+	case InProgress:
+		return "in progress"
+	case Mismatch:
+		return "mismatch"
+	default:
+		return "unknown"
+	}
+}
+
+// Check classifies resp by potency.ReplayedHeader and
+// potency.ErrorCodeHeader, so it doesn't depend on the server's error
+// status, body format or language.
+func Check(resp *http.Response) Result {
+	return check(resp.Header)
+}
+
+func CheckResty(resp *resty.Response) Result {
+	return check(resp.Header())
+}
+
+func check(header http.Header) Result {
+	if header.Get(potency.ReplayedHeader) == "true" {
+		return Replayed
+	}
+
+	switch header.Get(potency.ErrorCodeHeader) {
+	case "conflict":
+		return InProgress
+	case "mismatch":
+		return Mismatch
+	default:
+		return Executed
+	}
+}
@@ -0,0 +1,142 @@
+package potencyclient_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/go-resty/resty/v2"
+	"github.com/gopatchy/potency"
+	"github.com/gopatchy/potency/potencyclient"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+
+		if r.URL.Path == "/conflict" {
+			w.WriteHeader(http.StatusConflict)
+		}
+
+		_, _ = w.Write([]byte(uniuri.New()))
+	}))
+
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	rst := resty.New().SetBaseURL(srv.URL)
+
+	key := fmt.Sprintf(`"%s"`, uniuri.New())
+
+	resp, err := rst.R().SetHeader("Idempotency-Key", key).SetBody("test1").Post("/")
+	require.NoError(t, err)
+	require.Equal(t, potencyclient.Executed, potencyclient.CheckResty(resp))
+
+	resp, err = rst.R().SetHeader("Idempotency-Key", key).SetBody("test1").Post("/")
+	require.NoError(t, err)
+	require.Equal(t, potencyclient.Replayed, potencyclient.CheckResty(resp))
+
+	resp, err = rst.R().SetHeader("Idempotency-Key", key).SetBody("test2").Post("/")
+	require.NoError(t, err)
+	require.Equal(t, potencyclient.Mismatch, potencyclient.CheckResty(resp))
+
+	resp, err = rst.R().SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).Post("/conflict")
+	require.NoError(t, err)
+	require.Equal(t, potencyclient.Executed, potencyclient.CheckResty(resp))
+
+	key = fmt.Sprintf(`"%s"`, uniuri.New())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		_, _ = rst.R().SetHeader("Idempotency-Key", key).Post("/slow")
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/slow", strings.NewReader(""))
+	require.NoError(t, err)
+	req.Header.Set("Idempotency-Key", key)
+
+	stdResp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+
+	defer stdResp.Body.Close()
+
+	require.Equal(t, potencyclient.InProgress, potencyclient.Check(stdResp))
+
+	body, err := io.ReadAll(stdResp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "messages")
+
+	<-done
+}
+
+func TestCheckOptions(t *testing.T) {
+	t.Parallel()
+
+	for _, opts := range [][]potency.Option{
+		{potency.WithConflictStatus(http.StatusTooEarly)},
+		{potency.WithTranslator(func(r *http.Request, code string, err error) string { return "Konflikt" })},
+		{potency.WithErrorWriter(func(w http.ResponseWriter, r *http.Request, status int, err error) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte("nope"))
+		})},
+		{potency.WithConformance("")},
+	} {
+		p := potency.NewPotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.ReadAll(r.Body)
+
+			if r.URL.Path == "/slow" {
+				time.Sleep(200 * time.Millisecond)
+			}
+
+			_, _ = w.Write([]byte(uniuri.New()))
+		}), opts...)
+
+		srv := httptest.NewServer(p)
+		rst := resty.New().SetBaseURL(srv.URL)
+
+		key := fmt.Sprintf(`"%s"`, uniuri.New())
+
+		resp, err := rst.R().SetHeader("Idempotency-Key", key).SetBody("test1").Post("/")
+		require.NoError(t, err)
+		require.Equal(t, potencyclient.Executed, potencyclient.CheckResty(resp))
+
+		resp, err = rst.R().SetHeader("Idempotency-Key", key).SetBody("test2").Post("/")
+		require.NoError(t, err)
+		require.Equal(t, potencyclient.Mismatch, potencyclient.CheckResty(resp))
+
+		key = fmt.Sprintf(`"%s"`, uniuri.New())
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			_, _ = rst.R().SetHeader("Idempotency-Key", key).Post("/slow")
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+
+		resp, err = rst.R().SetHeader("Idempotency-Key", key).Post("/slow")
+		require.NoError(t, err)
+		require.Equal(t, potencyclient.InProgress, potencyclient.CheckResty(resp))
+
+		<-done
+
+		srv.Close()
+	}
+}
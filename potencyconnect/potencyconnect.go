@@ -0,0 +1,200 @@
+package potencyconnect
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"connectrpc.com/connect"
+	"github.com/gopatchy/potency"
+	"github.com/gopatchy/potency/internal/protohash"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	HeaderName = "Idempotency-Key"
+
+	method          = "CONNECT"
+	messageTypeName = "Connect-Message-Type"
+)
+
+var ErrNotProto = errors.New("message is not a protobuf message")
+
+// NewInterceptor returns a handler interceptor that applies p's idempotency
+// handling to unary procedures carrying an Idempotency-Key header, over the
+// Connect, gRPC, and gRPC-Web protocols alike. Client-side calls pass
+// through untouched. Each call is presented to p's configuration as a
+// request with method CONNECT, the procedure as its path and the call's
+// headers, so the key is parsed as over HTTP (see WithKeyExtractor) and the
+// key policy, WithPrincipalScope, WithReplayAuthorizer and identity headers
+// apply too.
+func NewInterceptor(p *potency.Potency) connect.UnaryInterceptorFunc {
+	return func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+			if req.Spec().IsClient {
+				return next(ctx, req)
+			}
+
+			procedure := req.Spec().Procedure
+			r := newRequest(ctx, req, procedure)
+
+			key, err := p.Key(r)
+			if err != nil {
+				return nil, connect.NewError(connect.CodeInvalidArgument, err)
+			}
+
+			if key == "" {
+				return next(ctx, req)
+			}
+
+			reqMsg, ok := req.Any().(proto.Message)
+			if !ok {
+				return nil, connect.NewError(connect.CodeInternal, ErrNotProto)
+			}
+
+			bodyHash, err := protohash.Fingerprint(reqMsg)
+			if err != nil {
+				return nil, connect.NewError(connect.CodeInternal, err)
+			}
+
+			saved, err := p.Lookup(ctx, key)
+			if err != nil {
+				return nil, connect.NewError(connect.CodeUnavailable, err)
+			}
+
+			if saved != nil {
+				return replay(p, r, saved, bodyHash)
+			}
+
+			res, err := p.Reserve(key)
+
+			savedErr := &potency.SavedError{}
+
+			switch {
+			case errors.As(err, &savedErr):
+				return replay(p, r, savedErr.Result, bodyHash)
+			case errors.Is(err, potency.ErrShuttingDown):
+				return nil, connect.NewError(connect.CodeUnavailable, err)
+			case err != nil:
+				return nil, connect.NewError(connect.CodeAborted, err)
+			}
+
+			// Frees the key if the handler panics or the result can't be saved
+			defer res.Release()
+
+			resp, err := next(res.Context(ctx), req)
+
+			sr, saveErr := newSavedResult(bodyHash, resp, err)
+			if saveErr != nil {
+				return resp, err
+			}
+
+			p.Identify(r, sr)
+
+			_ = res.Complete(ctx, sr)
+
+			return resp, err
+		}
+	}
+}
+
+// newRequest describes the call to p's configuration.
+func newRequest(ctx context.Context, req connect.AnyRequest, procedure string) *http.Request {
+	r := &http.Request{
+		Method:     method,
+		URL:        &url.URL{Path: procedure},
+		RequestURI: procedure,
+		Header:     req.Header(),
+		RemoteAddr: req.Peer().Addr,
+	}
+
+	return r.WithContext(ctx)
+}
+
+func newSavedResult(bodyHash []byte, resp connect.AnyResponse, handlerErr error) (*potency.SavedResult, error) {
+	sr := &potency.SavedResult{
+		BodyHash: bodyHash,
+	}
+
+	if handlerErr != nil {
+		sr.StatusCode = int(connect.CodeOf(handlerErr))
+
+		connectErr := &connect.Error{}
+		if errors.As(handlerErr, &connectErr) {
+			sr.ResponseBody = []byte(connectErr.Message())
+		} else {
+			sr.ResponseBody = []byte(handlerErr.Error())
+		}
+
+		return sr, nil
+	}
+
+	respMsg, ok := resp.Any().(proto.Message)
+	if !ok {
+		return nil, ErrNotProto
+	}
+
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(respMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	sr.ResponseHeader = resp.Header().Clone()
+	sr.ResponseHeader.Set(messageTypeName, string(respMsg.ProtoReflect().Descriptor().FullName()))
+	sr.ResponseBody = data
+	sr.ResponseTrailer = resp.Trailer().Clone()
+
+	return sr, nil
+}
+
+func replay(p *potency.Potency, r *http.Request, saved *potency.SavedResult, bodyHash []byte) (connect.AnyResponse, error) {
+	err := p.CheckReplay(r, saved)
+
+	switch {
+	case errors.Is(err, potency.ErrMismatch):
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	case err != nil:
+		return nil, connect.NewError(connect.CodePermissionDenied, err)
+	}
+
+	if !bytes.Equal(saved.BodyHash, bodyHash) {
+		return nil, connect.NewError(connect.CodeInvalidArgument, potency.ErrBodyMismatch)
+	}
+
+	if saved.StatusCode != 0 {
+		return nil, connect.NewError(connect.Code(saved.StatusCode), errors.New(string(saved.ResponseBody))) //nolint:goerr113
+	}
+
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(saved.ResponseHeader.Get(messageTypeName)))
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	// The handler serializes whatever proto.Message we return, so a dynamic
+	// message stands in for the concrete response type.
+	msg := dynamicpb.NewMessage(mt.Descriptor())
+
+	err = proto.Unmarshal(saved.ResponseBody, msg)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	resp := connect.NewResponse(msg)
+
+	for key, vals := range saved.ResponseHeader {
+		if key != http.CanonicalHeaderKey(messageTypeName) {
+			resp.Header()[key] = vals
+		}
+	}
+
+	for key, vals := range saved.ResponseTrailer {
+		resp.Trailer()[key] = vals
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,187 @@
+package potencyconnect_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/gopatchy/potency/potencyconnect"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestConnect(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler())
+
+	calls := 0
+
+	mux := http.NewServeMux()
+	mux.Handle("/test.Test/Echo", connect.NewUnaryHandler(
+		"/test.Test/Echo",
+		func(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[wrapperspb.StringValue], error) {
+			calls++
+
+			resp := connect.NewResponse(wrapperspb.String(uniuri.New()))
+			resp.Header().Set("X-Response", "bar")
+			resp.Trailer().Set("X-Trailer", "baz")
+
+			return resp, nil
+		},
+		connect.WithInterceptors(potencyconnect.NewInterceptor(p)),
+	))
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for _, opts := range [][]connect.ClientOption{{}, {connect.WithGRPCWeb()}} {
+		client := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](srv.Client(), srv.URL+"/test.Test/Echo", opts...)
+
+		key := fmt.Sprintf(`"%s"`, uniuri.New())
+
+		req := connect.NewRequest(wrapperspb.String("test1"))
+		req.Header().Set("Idempotency-Key", key)
+
+		resp1, err := client.CallUnary(context.Background(), req)
+		require.NoError(t, err)
+
+		req = connect.NewRequest(wrapperspb.String("test1"))
+		req.Header().Set("Idempotency-Key", key)
+
+		resp2, err := client.CallUnary(context.Background(), req)
+		require.NoError(t, err)
+		require.Equal(t, resp1.Msg.Value, resp2.Msg.Value)
+		require.Equal(t, "bar", resp2.Header().Get("X-Response"))
+		require.Equal(t, "baz", resp2.Trailer().Get("X-Trailer"))
+
+		req = connect.NewRequest(wrapperspb.String("test2"))
+		req.Header().Set("Idempotency-Key", key)
+
+		_, err = client.CallUnary(context.Background(), req)
+		require.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+	}
+
+	require.Equal(t, 2, calls)
+}
+
+func TestConnectPanic(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler())
+	interceptor := potencyconnect.NewInterceptor(p)
+
+	newRequest := func() connect.AnyRequest {
+		req := connect.NewRequest(wrapperspb.String("test1"))
+		req.Header().Set("Idempotency-Key", `"key"`)
+
+		return req
+	}
+
+	require.Panics(t, func() {
+		_, _ = interceptor.WrapUnary(func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+			panic("handler")
+		})(context.Background(), newRequest())
+	})
+
+	// The key isn't left reserved
+	_, err := interceptor.WrapUnary(func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		return connect.NewResponse(wrapperspb.String(uniuri.New())), nil
+	})(context.Background(), newRequest())
+	require.NoError(t, err)
+}
+
+func TestConnectIdentity(t *testing.T) {
+	t.Parallel()
+
+	principal := func(r *http.Request) string {
+		return r.Header.Get("Authorization")
+	}
+
+	for _, test := range []struct {
+		opts []potency.Option
+		code connect.Code
+	}{
+		// Authorization is an identity header by default
+		{nil, connect.CodeInvalidArgument},
+		{[]potency.Option{potency.WithPrincipal(principal), potency.WithReplayAuthorizer(potency.SamePrincipal(principal))}, connect.CodePermissionDenied},
+		// Each principal gets its own result
+		{[]potency.Option{potency.WithPrincipalScope(principal)}, 0},
+	} {
+		p := potency.NewPotency(http.NotFoundHandler(), test.opts...)
+		interceptor := potencyconnect.NewInterceptor(p)
+
+		calls := 0
+
+		unary := interceptor.WrapUnary(func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+			calls++
+			return connect.NewResponse(wrapperspb.String(uniuri.New())), nil
+		})
+
+		key := fmt.Sprintf(`"%s"`, uniuri.New())
+
+		call := func(auth string) (string, error) {
+			req := connect.NewRequest(wrapperspb.String("test1"))
+			req.Header().Set("Idempotency-Key", key)
+			req.Header().Set("Authorization", auth)
+
+			resp, err := unary(context.Background(), req)
+			if err != nil {
+				return "", err
+			}
+
+			// Replays are dynamic messages, so compare encodings
+			data, err := proto.Marshal(resp.Any().(proto.Message))
+			require.NoError(t, err)
+
+			return string(data), nil
+		}
+
+		val1, err := call("alice")
+		require.NoError(t, err)
+
+		val2, err := call("alice")
+		require.NoError(t, err)
+		require.Equal(t, val1, val2)
+
+		val3, err := call("mallory")
+
+		if test.code == 0 {
+			require.NoError(t, err)
+			require.NotEqual(t, val1, val3)
+			require.Equal(t, 2, calls)
+		} else {
+			require.Equal(t, test.code, connect.CodeOf(err))
+			require.Equal(t, 1, calls)
+		}
+	}
+}
+
+func TestConnectInvalidKey(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler(), potency.WithKeyPolicy(8, 0))
+	interceptor := potencyconnect.NewInterceptor(p)
+
+	unary := interceptor.WrapUnary(func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		return connect.NewResponse(wrapperspb.String(uniuri.New())), nil
+	})
+
+	for _, key := range []string{uniuri.New(), `"unterminated`, `"1"`} {
+		req := connect.NewRequest(wrapperspb.String("test1"))
+		req.Header().Set("Idempotency-Key", key)
+
+		_, err := unary(context.Background(), req)
+		require.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+		require.ErrorIs(t, err, potency.ErrInvalidKey)
+
+		ike := &potency.InvalidKeyError{}
+		require.ErrorAs(t, err, &ike)
+	}
+}
@@ -0,0 +1,41 @@
+package potencyecho
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gopatchy/potency"
+	"github.com/labstack/echo/v4"
+)
+
+// Middleware applies p's idempotency handling to echo routes. Errors
+// returned by the handler chain are rendered with c.Error inside the
+// idempotent execution so that the error response is saved and replayed.
+func Middleware(p *potency.Potency) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			orig := c.Response().Writer
+
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				c.SetRequest(r)
+				c.Response().Writer = w
+
+				defer func() {
+					c.Response().Writer = orig
+				}()
+
+				err := next(c)
+				if err != nil {
+					c.Error(err)
+				}
+
+				// Fingerprint the whole body even if the handler didn't read it
+				_, _ = io.Copy(io.Discard, r.Body)
+			})
+
+			p.Handler(h).ServeHTTP(orig, c.Request())
+
+			return nil
+		}
+	}
+}
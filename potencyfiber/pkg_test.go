@@ -0,0 +1,12 @@
+package potencyfiber_test
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	// fasthttp starts a never-ending date updater goroutine that sleeps in a loop
+	goleak.VerifyTestMain(m, goleak.IgnoreTopFunction("time.Sleep"))
+}
@@ -0,0 +1,101 @@
+package potencyfiber
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/gopatchy/potency"
+)
+
+// responseWriter writes into the fiber response. Headers accumulate in
+// header and are copied over when the status is written.
+type responseWriter struct {
+	c           *fiber.Ctx
+	header      http.Header
+	wroteHeader bool
+}
+
+// Middleware applies p's idempotency handling to the rest of the fiber
+// handler chain. Since fiber handlers don't use net/http, the response they
+// build is copied through the idempotency layer after c.Next returns;
+// errors are rendered with the app's ErrorHandler first so they are saved
+// and replayed.
+func Middleware(p *potency.Potency) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		r, err := adaptor.ConvertRequest(c, true)
+		if err != nil {
+			return err
+		}
+
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Feed the body through the fingerprint; fiber handlers read
+			// c.Body() directly.
+			_, _ = io.Copy(io.Discard, r.Body)
+
+			err := c.Next()
+			if err != nil {
+				err = c.App().ErrorHandler(c, err)
+				if err != nil {
+					_ = c.SendStatus(fiber.StatusInternalServerError)
+				}
+			}
+
+			resp := c.Response()
+
+			body := append([]byte(nil), resp.Body()...)
+			resp.ResetBody()
+
+			resp.Header.VisitAll(func(key, val []byte) {
+				w.Header().Add(string(key), string(val))
+			})
+
+			w.WriteHeader(resp.StatusCode())
+			_, _ = w.Write(body)
+		})
+
+		p.Handler(h).ServeHTTP(newResponseWriter(c), r)
+
+		return nil
+	}
+}
+
+func newResponseWriter(c *fiber.Ctx) *responseWriter {
+	return &responseWriter{
+		c:      c,
+		header: http.Header{},
+	}
+}
+
+func (rw *responseWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *responseWriter) Write(data []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	rw.c.Response().AppendBody(data)
+
+	return len(data), nil
+}
+
+func (rw *responseWriter) WriteHeader(statusCode int) {
+	if rw.wroteHeader {
+		return
+	}
+
+	rw.wroteHeader = true
+
+	for key, vals := range rw.header {
+		rw.c.Response().Header.Del(key)
+
+		for _, val := range vals {
+			rw.c.Response().Header.Add(key, val)
+		}
+	}
+
+	rw.c.Status(statusCode)
+}
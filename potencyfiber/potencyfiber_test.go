@@ -0,0 +1,81 @@
+package potencyfiber_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gopatchy/potency"
+	"github.com/gopatchy/potency/potencyfiber"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFiber(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler())
+
+	app := fiber.New()
+	app.Use(potencyfiber.Middleware(p))
+
+	calls := 0
+
+	app.Post("/", func(c *fiber.Ctx) error {
+		calls++
+
+		c.Set("X-Response", "bar")
+
+		return c.Status(http.StatusCreated).SendString(uniuri.New())
+	})
+
+	app.Post("/fail", func(c *fiber.Ctx) error {
+		calls++
+
+		return fiber.NewError(http.StatusTeapot, uniuri.New())
+	})
+
+	key := fmt.Sprintf(`"%s"`, uniuri.New())
+
+	status1, body1, header1 := serve(t, app, "/", key, "test1")
+	require.Equal(t, http.StatusCreated, status1)
+	require.Equal(t, "bar", header1.Get("X-Response"))
+
+	status2, body2, header2 := serve(t, app, "/", key, "test1")
+	require.Equal(t, http.StatusCreated, status2)
+	require.Equal(t, body1, body2)
+	require.Equal(t, "bar", header2.Get("X-Response"))
+	require.Equal(t, 1, calls)
+
+	status3, _, _ := serve(t, app, "/", key, "test2")
+	require.Equal(t, http.StatusBadRequest, status3)
+
+	key = fmt.Sprintf(`"%s"`, uniuri.New())
+
+	status1, body1, _ = serve(t, app, "/fail", key, "test1")
+	require.Equal(t, http.StatusTeapot, status1)
+
+	status2, body2, _ = serve(t, app, "/fail", key, "test1")
+	require.Equal(t, http.StatusTeapot, status2)
+	require.Equal(t, body1, body2)
+	require.Equal(t, 2, calls)
+}
+
+func serve(t *testing.T, app *fiber.App, path, key, body string) (int, string, http.Header) {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp.StatusCode, string(data), resp.Header
+}
@@ -0,0 +1,288 @@
+// Package potencyfile is a potency.Store that keeps one file per key in a
+// local directory, for single-instance deployments that need results to
+// survive restarts without running a database.
+//
+// Importing it registers the "file" scheme for potency.Config.Store, e.g.
+// "file:///var/lib/potency?maxAge=24h".
+package potencyfile
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gopatchy/potency"
+)
+
+const tempPrefix = ".tmp-"
+
+type Store struct {
+	dir    string
+	maxAge time.Duration
+}
+
+var ErrInvalidDSN = errors.New("invalid file store DSN")
+
+func init() {
+	potency.RegisterStore("file", Open)
+}
+
+// NewStore stores results in dir, creating it if needed. Compact deletes
+// results older than maxAge; zero keeps them until they are deleted.
+func NewStore(dir string, maxAge time.Duration) (*Store, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		dir:    dir,
+		maxAge: maxAge,
+	}, nil
+}
+
+// Open creates a Store from a "file:///path?maxAge=24h" DSN.
+func Open(dsn string) (potency.Store, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%s (%w)", err, ErrInvalidDSN)
+	}
+
+	if u.Path == "" {
+		return nil, fmt.Errorf("%s: missing path (%w)", dsn, ErrInvalidDSN)
+	}
+
+	maxAge := time.Duration(0)
+
+	if val := u.Query().Get("maxAge"); val != "" {
+		maxAge, err = time.ParseDuration(val)
+		if err != nil {
+			return nil, fmt.Errorf("maxAge: %s (%w)", err, ErrInvalidDSN)
+		}
+	}
+
+	return NewStore(u.Path, maxAge)
+}
+
+func (s *Store) Get(ctx context.Context, key string) (*potency.SavedResult, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return potency.Unmarshal(data)
+}
+
+// Put writes to a temporary file and renames it into place, so a crash never
+// leaves a partial result behind.
+func (s *Store) Put(ctx context.Context, sr *potency.SavedResult) error {
+	data, err := sr.Marshal()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, tempPrefix)
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(sr.Key))
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// DeleteWhere reads every result in the directory; it is meant for rare
+// administrative purges.
+func (s *Store) DeleteWhere(ctx context.Context, match func(*potency.SavedResult) bool) (int, error) {
+	deleted := 0
+
+	err := s.walk(ctx, func(path string, sr *potency.SavedResult) error {
+		if sr == nil || !match(sr) {
+			return nil
+		}
+
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		deleted++
+
+		return nil
+	})
+
+	return deleted, err
+}
+
+// Compact deletes results under prefix older than maxAge, and temporary
+// files left by interrupted writes. Unreadable files, whose namespace is
+// unknown, are only deleted with an empty prefix.
+func (s *Store) Compact(ctx context.Context, prefix string) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), tempPrefix) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < time.Minute {
+			// May still be in the middle of a Put
+			continue
+		}
+
+		os.Remove(filepath.Join(s.dir, entry.Name()))
+	}
+
+	return s.walk(ctx, func(path string, sr *potency.SavedResult) error {
+		switch {
+		case sr == nil && prefix != "":
+			return nil
+		case sr != nil && !strings.HasPrefix(sr.Key, prefix):
+			return nil
+		case sr != nil && (s.maxAge == 0 || time.Since(sr.Added) < s.maxAge):
+			return nil
+		}
+
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Size reads every result in the directory when prefix is set.
+func (s *Store) Size(ctx context.Context, prefix string) (int64, error) {
+	if prefix != "" {
+		return s.prefixSize(ctx, prefix)
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	size := int64(0)
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		size += info.Size()
+	}
+
+	return size, nil
+}
+
+func (s *Store) prefixSize(ctx context.Context, prefix string) (int64, error) {
+	size := int64(0)
+
+	err := s.walk(ctx, func(path string, sr *potency.SavedResult) error {
+		if sr == nil || !strings.HasPrefix(sr.Key, prefix) {
+			return nil
+		}
+
+		info, err := os.Stat(path)
+		if err == nil {
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	return size, err
+}
+
+// walk calls fn with each stored result, or a nil result for files that
+// can't be decoded.
+func (s *Store) walk(ctx context.Context, fn func(path string, sr *potency.SavedResult) error) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), tempPrefix) {
+			continue
+		}
+
+		err = ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(s.dir, entry.Name())
+
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		sr, err := potency.Unmarshal(data)
+		if err != nil {
+			sr = nil
+		}
+
+		err = fn(path, sr)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// path hashes the key, since keys are arbitrary client-supplied strings.
+func (s *Store) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
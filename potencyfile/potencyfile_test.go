@@ -0,0 +1,175 @@
+package potencyfile_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/gopatchy/potency/potencyfile"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	s, err := potencyfile.NewStore(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	sr, err := s.Get(ctx, "missing")
+	require.NoError(t, err)
+	require.Nil(t, sr)
+
+	key := uniuri.New()
+
+	err = s.Put(ctx, &potency.SavedResult{
+		Key:          key,
+		Method:       http.MethodPost,
+		URL:          "/orders",
+		StatusCode:   http.StatusCreated,
+		ResponseBody: []byte("ok"),
+		Added:        time.Now(),
+	})
+	require.NoError(t, err)
+
+	sr, err = s.Get(ctx, key)
+	require.NoError(t, err)
+	require.NotNil(t, sr)
+	require.Equal(t, key, sr.Key)
+	require.Equal(t, []byte("ok"), sr.ResponseBody)
+
+	size, err := s.Size(ctx, "")
+	require.NoError(t, err)
+	require.Positive(t, size)
+
+	require.NoError(t, s.Delete(ctx, key))
+	require.NoError(t, s.Delete(ctx, key))
+
+	sr, err = s.Get(ctx, key)
+	require.NoError(t, err)
+	require.Nil(t, sr)
+}
+
+func TestDeleteWhere(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	s, err := potencyfile.NewStore(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	for _, url := range []string{"/a", "/b", "/a"} {
+		require.NoError(t, s.Put(ctx, &potency.SavedResult{Key: uniuri.New(), URL: url, Added: time.Now()}))
+	}
+
+	n, err := s.DeleteWhere(ctx, func(sr *potency.SavedResult) bool { return sr.URL == "/a" })
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+}
+
+func TestCompact(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := potencyfile.NewStore(dir, time.Hour)
+	require.NoError(t, err)
+
+	oldKey := uniuri.New()
+	newKey := uniuri.New()
+
+	require.NoError(t, s.Put(ctx, &potency.SavedResult{Key: oldKey, Added: time.Now().Add(-2 * time.Hour)}))
+	require.NoError(t, s.Put(ctx, &potency.SavedResult{Key: newKey, Added: time.Now()}))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "garbage"), []byte("x"), 0o600))
+
+	require.NoError(t, s.Compact(ctx, ""))
+
+	sr, err := s.Get(ctx, oldKey)
+	require.NoError(t, err)
+	require.Nil(t, sr)
+
+	sr, err = s.Get(ctx, newKey)
+	require.NoError(t, err)
+	require.NotNil(t, sr)
+
+	_, err = os.Stat(filepath.Join(dir, "garbage"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	opts, err := potency.FromConfig(potency.Config{Store: "file://" + dir + "?maxAge=1h"})
+	require.NoError(t, err)
+
+	p := potency.NewPotency(http.NotFoundHandler(), opts...)
+
+	key := uniuri.New()
+
+	_, _, err = p.Do(context.Background(), key, func(ctx context.Context) (potency.Result, error) {
+		return potency.Result{Value: []byte("ok")}, nil
+	})
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	_, err = potencyfile.Open("file://")
+	require.ErrorIs(t, err, potencyfile.ErrInvalidDSN)
+}
+
+func TestCompactNamespace(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := potencyfile.NewStore(dir, time.Hour)
+	require.NoError(t, err)
+
+	billing := potency.NewPotency(http.NotFoundHandler(), potency.WithStore(s), potency.WithStoreNamespace("billing"))
+	shipping := potency.NewPotency(http.NotFoundHandler(), potency.WithStore(s), potency.WithStoreNamespace("shipping"))
+
+	key := uniuri.New()
+
+	for _, p := range []*potency.Potency{billing, shipping} {
+		res, err := p.Reserve(key)
+		require.NoError(t, err)
+		require.NoError(t, res.Complete(ctx, &potency.SavedResult{StatusCode: http.StatusOK}))
+	}
+
+	size, err := billing.StoreSize(ctx)
+	require.NoError(t, err)
+	require.Positive(t, size)
+
+	total, err := s.Size(ctx, "")
+	require.NoError(t, err)
+	require.Greater(t, total, size)
+
+	// Both results are expired, but billing only compacts its own
+	s2, err := potencyfile.NewStore(dir, time.Nanosecond)
+	require.NoError(t, err)
+
+	require.NoError(t, potency.NewPotency(http.NotFoundHandler(), potency.WithStore(s2), potency.WithStoreNamespace("billing")).Compact(ctx))
+
+	sr, err := s.Get(ctx, "billing:"+key)
+	require.NoError(t, err)
+	require.Nil(t, sr)
+
+	sr, err = s.Get(ctx, "shipping:"+key)
+	require.NoError(t, err)
+	require.NotNil(t, sr)
+
+	require.NoError(t, billing.Shutdown(ctx))
+	require.NoError(t, shipping.Shutdown(ctx))
+}
@@ -0,0 +1,64 @@
+package potencygin
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gopatchy/potency"
+)
+
+type responseWriter struct {
+	gin.ResponseWriter
+	w http.ResponseWriter
+}
+
+// Middleware applies p's idempotency handling to the rest of the gin handler
+// chain. Replays and idempotency errors abort the chain.
+func Middleware(p *potency.Potency) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orig := c.Writer
+		executed := false
+
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			executed = true
+
+			c.Request = r
+			c.Writer = &responseWriter{
+				ResponseWriter: orig,
+				w:              w,
+			}
+
+			defer func() {
+				c.Writer = orig
+			}()
+
+			c.Next()
+
+			// Fingerprint the whole body even if the handler didn't read it
+			_, _ = io.Copy(io.Discard, r.Body)
+		})
+
+		p.Handler(h).ServeHTTP(orig, c.Request)
+
+		if !executed {
+			c.Abort()
+		}
+	}
+}
+
+func (rw *responseWriter) Write(data []byte) (int, error) {
+	return rw.w.Write(data)
+}
+
+func (rw *responseWriter) WriteString(s string) (int, error) {
+	return rw.w.Write([]byte(s))
+}
+
+func (rw *responseWriter) WriteHeader(statusCode int) {
+	rw.w.WriteHeader(statusCode)
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.w
+}
@@ -0,0 +1,76 @@
+package potencygin_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/gopatchy/potency/potencygin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGin(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler())
+
+	gin.SetMode(gin.TestMode)
+
+	e := gin.New()
+	e.Use(potencygin.Middleware(p))
+
+	calls := 0
+
+	e.POST("/", func(c *gin.Context) {
+		calls++
+
+		c.Header("X-Response", "bar")
+		c.String(http.StatusCreated, uniuri.New())
+	})
+
+	e.POST("/fail", func(c *gin.Context) {
+		calls++
+
+		c.AbortWithStatusJSON(http.StatusTeapot, gin.H{"error": uniuri.New()})
+	})
+
+	key := fmt.Sprintf(`"%s"`, uniuri.New())
+
+	rec1 := serve(e, "/", key, "test1")
+	require.Equal(t, http.StatusCreated, rec1.Code)
+
+	rec2 := serve(e, "/", key, "test1")
+	require.Equal(t, http.StatusCreated, rec2.Code)
+	require.Equal(t, rec1.Body.String(), rec2.Body.String())
+	require.Equal(t, "bar", rec2.Header().Get("X-Response"))
+	require.Equal(t, 1, calls)
+
+	rec3 := serve(e, "/", key, "test2")
+	require.Equal(t, http.StatusBadRequest, rec3.Code)
+
+	key = fmt.Sprintf(`"%s"`, uniuri.New())
+
+	rec1 = serve(e, "/fail", key, "test1")
+	require.Equal(t, http.StatusTeapot, rec1.Code)
+
+	rec2 = serve(e, "/fail", key, "test1")
+	require.Equal(t, http.StatusTeapot, rec2.Code)
+	require.Equal(t, rec1.Body.String(), rec2.Body.String())
+	require.Equal(t, 2, calls)
+}
+
+func serve(h http.Handler, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
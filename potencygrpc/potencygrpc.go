@@ -0,0 +1,213 @@
+package potencygrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gopatchy/potency"
+	"github.com/gopatchy/potency/internal/protohash"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	MetadataKey = "idempotency-key"
+
+	method          = "GRPC"
+	messageTypeName = "Grpc-Message-Type"
+)
+
+var ErrNotProto = errors.New("message is not a protobuf message")
+
+// UnaryServerInterceptor applies p's idempotency handling to unary RPCs that
+// carry an idempotency-key metadata entry. Saved results live in p alongside
+// those of the HTTP middleware. Each RPC is presented to p's configuration as
+// a request with method GRPC, the full method name as its path, its
+// metadata as headers and the peer's address and TLS state, so the key
+// policy, WithPrincipalScope, WithReplayAuthorizer and identity headers
+// (e.g. authorization) apply as they do over HTTP.
+func UnaryServerInterceptor(p *potency.Potency) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		vals := md.Get(MetadataKey)
+		if len(vals) == 0 || vals[0] == "" {
+			return handler(ctx, req)
+		}
+
+		r := newRequest(ctx, md, info.FullMethod)
+
+		key, err := p.ScopeKey(r, vals[0])
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		reqMsg, ok := req.(proto.Message)
+		if !ok {
+			return nil, status.Error(codes.Internal, ErrNotProto.Error())
+		}
+
+		bodyHash, err := protohash.Fingerprint(reqMsg)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		saved, err := p.Lookup(ctx, key)
+		if err != nil {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+
+		if saved != nil {
+			return replay(p, r, saved, bodyHash)
+		}
+
+		res, err := p.Reserve(key)
+
+		savedErr := &potency.SavedError{}
+
+		switch {
+		case errors.As(err, &savedErr):
+			return replay(p, r, savedErr.Result, bodyHash)
+		case errors.Is(err, potency.ErrShuttingDown):
+			return nil, status.Error(codes.Unavailable, err.Error())
+		case err != nil:
+			return nil, status.Errorf(codes.Aborted, "%s: %s", key, err)
+		}
+
+		// Frees the key if the handler panics or the result can't be saved
+		defer res.Release()
+
+		resp, err := handler(res.Context(ctx), req)
+
+		sr, saveErr := newSavedResult(bodyHash, resp, err)
+		if saveErr != nil {
+			return resp, err
+		}
+
+		p.Identify(r, sr)
+
+		_ = res.Complete(ctx, sr)
+
+		return resp, err
+	}
+}
+
+// newRequest describes the RPC to p's configuration.
+func newRequest(ctx context.Context, md metadata.MD, fullMethod string) *http.Request {
+	r := &http.Request{
+		Method:     method,
+		URL:        &url.URL{Path: fullMethod},
+		RequestURI: fullMethod,
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+		Header:     http.Header{},
+	}
+
+	for key, vals := range md {
+		if !strings.HasPrefix(key, ":") {
+			r.Header[http.CanonicalHeaderKey(key)] = vals
+		}
+	}
+
+	if pr, ok := peer.FromContext(ctx); ok {
+		if pr.Addr != nil {
+			r.RemoteAddr = pr.Addr.String()
+		}
+
+		if info, ok := pr.AuthInfo.(credentials.TLSInfo); ok {
+			r.TLS = &info.State
+		}
+	}
+
+	return r.WithContext(ctx)
+}
+
+func newSavedResult(bodyHash []byte, resp any, handlerErr error) (*potency.SavedResult, error) {
+	sr := &potency.SavedResult{
+		BodyHash: bodyHash,
+	}
+
+	if handlerErr != nil {
+		st, _ := status.FromError(handlerErr)
+
+		data, err := proto.Marshal(st.Proto())
+		if err != nil {
+			return nil, err
+		}
+
+		sr.StatusCode = int(st.Code())
+		sr.ResponseBody = data
+
+		return sr, nil
+	}
+
+	respMsg, ok := resp.(proto.Message)
+	if !ok {
+		return nil, ErrNotProto
+	}
+
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(respMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	sr.StatusCode = int(codes.OK)
+	sr.ResponseHeader = map[string][]string{
+		messageTypeName: {string(respMsg.ProtoReflect().Descriptor().FullName())},
+	}
+	sr.ResponseBody = data
+
+	return sr, nil
+}
+
+func replay(p *potency.Potency, r *http.Request, saved *potency.SavedResult, bodyHash []byte) (any, error) {
+	err := p.CheckReplay(r, saved)
+
+	switch {
+	case errors.Is(err, potency.ErrMismatch):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	if !bytes.Equal(saved.BodyHash, bodyHash) {
+		return nil, status.Error(codes.InvalidArgument, potency.ErrBodyMismatch.Error())
+	}
+
+	if codes.Code(saved.StatusCode) != codes.OK {
+		st := &spb.Status{}
+
+		err := proto.Unmarshal(saved.ResponseBody, st)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		return nil, status.ErrorProto(st)
+	}
+
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(saved.ResponseHeader.Get(messageTypeName)))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := mt.New().Interface()
+
+	err = proto.Unmarshal(saved.ResponseBody, resp)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
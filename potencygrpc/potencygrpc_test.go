@@ -0,0 +1,173 @@
+package potencygrpc_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/gopatchy/potency/potencygrpc"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestUnary(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler())
+	interceptor := potencygrpc.UnaryServerInterceptor(p)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Test/Echo"}
+
+	calls := 0
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		calls++
+		return wrapperspb.String(uniuri.New()), nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(potencygrpc.MetadataKey, uniuri.New()))
+
+	resp1, err := interceptor(ctx, wrapperspb.String("test1"), info, handler)
+	require.NoError(t, err)
+
+	resp2, err := interceptor(ctx, wrapperspb.String("test1"), info, handler)
+	require.NoError(t, err)
+	require.Equal(t, resp1.(*wrapperspb.StringValue).Value, resp2.(*wrapperspb.StringValue).Value)
+	require.Equal(t, 1, calls)
+
+	_, err = interceptor(ctx, wrapperspb.String("test2"), info, handler)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = interceptor(ctx, wrapperspb.String("test1"), &grpc.UnaryServerInfo{FullMethod: "/test.Test/Other"}, handler)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = interceptor(context.Background(), wrapperspb.String("test1"), info, handler)
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+}
+
+func TestUnaryError(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler())
+	interceptor := potencygrpc.UnaryServerInterceptor(p)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Test/Echo"}
+
+	calls := 0
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		calls++
+		return nil, status.Error(codes.NotFound, "nope")
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(potencygrpc.MetadataKey, uniuri.New()))
+
+	_, err := interceptor(ctx, wrapperspb.String("test1"), info, handler)
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = interceptor(ctx, wrapperspb.String("test1"), info, handler)
+	require.Equal(t, codes.NotFound, status.Code(err))
+	require.Equal(t, "nope", status.Convert(err).Message())
+	require.Equal(t, 1, calls)
+}
+
+func TestUnaryPanic(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler())
+	interceptor := potencygrpc.UnaryServerInterceptor(p)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Test/Echo"}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(potencygrpc.MetadataKey, uniuri.New()))
+
+	require.Panics(t, func() {
+		_, _ = interceptor(ctx, wrapperspb.String("test1"), info, func(ctx context.Context, req any) (any, error) {
+			panic("handler")
+		})
+	})
+
+	// The key isn't left reserved
+	_, err := interceptor(ctx, wrapperspb.String("test1"), info, func(ctx context.Context, req any) (any, error) {
+		return wrapperspb.String(uniuri.New()), nil
+	})
+	require.NoError(t, err)
+}
+
+func TestUnaryIdentity(t *testing.T) {
+	t.Parallel()
+
+	principal := func(r *http.Request) string {
+		return r.Header.Get("Authorization")
+	}
+
+	for _, test := range []struct {
+		opts []potency.Option
+		code codes.Code
+	}{
+		// Authorization is an identity header by default
+		{nil, codes.InvalidArgument},
+		{[]potency.Option{potency.WithPrincipal(principal), potency.WithReplayAuthorizer(potency.SamePrincipal(principal))}, codes.PermissionDenied},
+		// Each principal gets its own result
+		{[]potency.Option{potency.WithPrincipalScope(principal)}, codes.OK},
+	} {
+		p := potency.NewPotency(http.NotFoundHandler(), test.opts...)
+		interceptor := potencygrpc.UnaryServerInterceptor(p)
+
+		info := &grpc.UnaryServerInfo{FullMethod: "/test.Test/Echo"}
+
+		calls := 0
+
+		handler := func(ctx context.Context, req any) (any, error) {
+			calls++
+			return wrapperspb.String(uniuri.New()), nil
+		}
+
+		key := uniuri.New()
+
+		call := func(auth string) (any, error) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(potencygrpc.MetadataKey, key, "authorization", auth))
+			return interceptor(ctx, wrapperspb.String("test1"), info, handler)
+		}
+
+		resp1, err := call("alice")
+		require.NoError(t, err)
+
+		resp2, err := call("alice")
+		require.NoError(t, err)
+		require.Equal(t, resp1.(*wrapperspb.StringValue).Value, resp2.(*wrapperspb.StringValue).Value)
+
+		resp3, err := call("mallory")
+		require.Equal(t, test.code, status.Code(err))
+
+		if test.code == codes.OK {
+			require.NotEqual(t, resp1.(*wrapperspb.StringValue).Value, resp3.(*wrapperspb.StringValue).Value)
+			require.Equal(t, 2, calls)
+		} else {
+			require.Equal(t, 1, calls)
+		}
+	}
+}
+
+func TestUnaryKeyPolicy(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler(), potency.WithKeyPolicy(8, 0))
+	interceptor := potencygrpc.UnaryServerInterceptor(p)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Test/Echo"}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(potencygrpc.MetadataKey, "1"))
+
+	_, err := interceptor(ctx, wrapperspb.String("test1"), info, func(ctx context.Context, req any) (any, error) {
+		return wrapperspb.String(uniuri.New()), nil
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,90 @@
+package potencyjwt
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gopatchy/potency"
+)
+
+type Option func(*config)
+
+type config struct {
+	claims        []string
+	keyfunc       jwt.Keyfunc
+	parserOptions []jwt.ParserOption
+}
+
+// WithClaims replaces the claims (default sub, then client_id) tried in
+// order for the principal.
+func WithClaims(claims ...string) Option {
+	return func(cfg *config) {
+		cfg.claims = claims
+	}
+}
+
+// WithKeyfunc verifies tokens with keyfunc before trusting their claims.
+// Without it, tokens are parsed unverified, which is only appropriate when an
+// earlier middleware has already authenticated the request.
+func WithKeyfunc(keyfunc jwt.Keyfunc, opts ...jwt.ParserOption) Option {
+	return func(cfg *config) {
+		cfg.keyfunc = keyfunc
+		cfg.parserOptions = opts
+	}
+}
+
+// Principal returns a potency.PrincipalFunc that extracts the principal from
+// an "Authorization: Bearer <JWT>" header, for use with
+// potency.WithPrincipalScope or potency.WithPrincipal. Requests without a
+// usable token have the empty principal.
+func Principal(opts ...Option) potency.PrincipalFunc {
+	cfg := &config{
+		claims: []string{"sub", "client_id"},
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(r *http.Request) string {
+		auth := r.Header.Get("Authorization")
+
+		if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+			return ""
+		}
+
+		claims, err := cfg.parse(strings.TrimSpace(auth[7:]))
+		if err != nil {
+			return ""
+		}
+
+		for _, name := range cfg.claims {
+			switch val := claims[name].(type) {
+			case string:
+				if val != "" {
+					return val
+				}
+
+			case float64:
+				return strconv.FormatFloat(val, 'f', -1, 64)
+			}
+		}
+
+		return ""
+	}
+}
+
+func (cfg *config) parse(token string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+
+	if cfg.keyfunc == nil {
+		_, _, err := jwt.NewParser().ParseUnverified(token, claims)
+		return claims, err
+	}
+
+	_, err := jwt.NewParser(cfg.parserOptions...).ParseWithClaims(token, claims, cfg.keyfunc)
+
+	return claims, err
+}
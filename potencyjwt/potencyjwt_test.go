@@ -0,0 +1,52 @@
+package potencyjwt_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gopatchy/potency/potencyjwt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrincipal(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("secret")
+
+	sign := func(claims jwt.MapClaims, key []byte) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+		require.NoError(t, err)
+
+		return token
+	}
+
+	req := func(auth string) *http.Request {
+		r, err := http.NewRequest(http.MethodPost, "/", nil)
+		require.NoError(t, err)
+
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+
+		return r
+	}
+
+	unverified := potencyjwt.Principal()
+
+	require.Equal(t, "alice", unverified(req("Bearer "+sign(jwt.MapClaims{"sub": "alice"}, key))))
+	require.Equal(t, "app1", unverified(req("bearer "+sign(jwt.MapClaims{"client_id": "app1"}, key))))
+	require.Equal(t, "alice", unverified(req("Bearer "+sign(jwt.MapClaims{"sub": "alice"}, []byte("other")))))
+	require.Empty(t, unverified(req("")))
+	require.Empty(t, unverified(req("Basic YWxpY2U6cHc=")))
+	require.Empty(t, unverified(req("Bearer garbage")))
+
+	verified := potencyjwt.Principal(
+		potencyjwt.WithKeyfunc(func(*jwt.Token) (any, error) { return key, nil }, jwt.WithValidMethods([]string{"HS256"})),
+		potencyjwt.WithClaims("client_id"),
+	)
+
+	require.Equal(t, "app1", verified(req("Bearer "+sign(jwt.MapClaims{"sub": "alice", "client_id": "app1"}, key))))
+	require.Empty(t, verified(req("Bearer "+sign(jwt.MapClaims{"client_id": "app1"}, []byte("other")))))
+	require.Empty(t, verified(req("Bearer "+sign(jwt.MapClaims{"sub": "alice"}, key))))
+}
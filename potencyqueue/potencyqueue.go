@@ -0,0 +1,27 @@
+package potencyqueue
+
+import (
+	"context"
+
+	"github.com/gopatchy/potency"
+)
+
+// Handler processes one message from an at-least-once delivery source such
+// as Kafka, SQS, or NATS.
+type Handler[M any] func(ctx context.Context, msg M) error
+
+// Dedup wraps handler so that each message ID is processed at most once
+// while its saved result lives in p. Duplicates return nil so they can be
+// acknowledged. Handler errors are returned and not saved, so a redelivery
+// is processed again. A duplicate that arrives while the original is still
+// being processed gets potency.ErrConflict (unless p's conflict policy
+// waits), which should be treated as a retryable failure.
+func Dedup[M any](p *potency.Potency, id func(M) string, handler Handler[M]) Handler[M] {
+	return func(ctx context.Context, msg M) error {
+		_, _, err := p.Do(ctx, id(msg), func(ctx context.Context) (potency.Result, error) {
+			return potency.Result{}, handler(ctx, msg)
+		})
+
+		return err
+	}
+}
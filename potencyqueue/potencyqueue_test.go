@@ -0,0 +1,51 @@
+package potencyqueue_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/gopatchy/potency/potencyqueue"
+	"github.com/stretchr/testify/require"
+)
+
+type message struct {
+	ID   string
+	Body string
+}
+
+func TestDedup(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler())
+
+	errFail := errors.New("fail")
+	processed := []string{}
+	fail := true
+
+	handler := potencyqueue.Dedup(p, func(msg *message) string { return msg.ID }, func(ctx context.Context, msg *message) error {
+		if fail {
+			fail = false
+			return errFail
+		}
+
+		processed = append(processed, msg.Body)
+
+		return nil
+	})
+
+	msg1 := &message{ID: uniuri.New(), Body: "one"}
+	msg2 := &message{ID: uniuri.New(), Body: "two"}
+
+	require.ErrorIs(t, handler(context.Background(), msg1), errFail)
+	require.NoError(t, handler(context.Background(), msg1))
+	require.NoError(t, handler(context.Background(), msg1))
+	require.NoError(t, handler(context.Background(), msg2))
+	require.NoError(t, handler(context.Background(), msg1))
+	require.NoError(t, handler(context.Background(), msg2))
+
+	require.Equal(t, []string{"one", "two"}, processed)
+}
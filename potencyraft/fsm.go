@@ -0,0 +1,127 @@
+package potencyraft
+
+import (
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gopatchy/potency"
+	"github.com/hashicorp/raft"
+)
+
+type op int
+
+const (
+	opGet op = iota + 1
+	opPut
+	opDelete
+	opExpire
+)
+
+type command struct {
+	Op     op     `cbor:"1,keyasint"`
+	Key    string `cbor:"2,keyasint,omitempty"`
+	Value  []byte `cbor:"3,keyasint,omitempty"`
+	Before int64  `cbor:"4,keyasint,omitempty"`
+}
+
+// FSM is the replicated state: marshaled results by key.
+type FSM struct {
+	mu      sync.RWMutex
+	results map[string][]byte
+}
+
+func NewFSM() *FSM {
+	return &FSM{
+		results: map[string][]byte{},
+	}
+}
+
+func (f *FSM) Apply(l *raft.Log) any {
+	cmd := &command{}
+
+	err := cbor.Unmarshal(l.Data, cmd)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch cmd.Op {
+	case opPut:
+		f.results[cmd.Key] = cmd.Value
+
+	case opDelete:
+		delete(f.results, cmd.Key)
+
+	case opExpire:
+		// The cutoff comes from the leader so every member removes the
+		// same entries. Key is the prefix of the keys to expire.
+		for key, data := range f.results {
+			if !strings.HasPrefix(key, cmd.Key) {
+				continue
+			}
+
+			sr, err := potency.Unmarshal(data)
+			if err != nil || sr.Added.UnixNano() < cmd.Before {
+				delete(f.results, key)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (f *FSM) Snapshot() (raft.FSMSnapshot, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	results := make(map[string][]byte, len(f.results))
+	for key, data := range f.results {
+		results[key] = data
+	}
+
+	return &snapshot{results: results}, nil
+}
+
+func (f *FSM) Restore(r io.ReadCloser) error {
+	defer r.Close()
+
+	results := map[string][]byte{}
+
+	err := cbor.NewDecoder(r).Decode(&results)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.results = results
+	f.mu.Unlock()
+
+	return nil
+}
+
+func (f *FSM) get(key string) []byte {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.results[key]
+}
+
+type snapshot struct {
+	results map[string][]byte
+}
+
+func (s *snapshot) Persist(sink raft.SnapshotSink) error {
+	err := cbor.NewEncoder(sink).Encode(s.results)
+	if err != nil {
+		_ = sink.Cancel()
+		return err
+	}
+
+	return sink.Close()
+}
+
+func (s *snapshot) Release() {}
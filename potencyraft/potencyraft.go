@@ -0,0 +1,253 @@
+// Package potencyraft is a potency.Store replicated with hashicorp/raft, so a
+// small cluster of instances shares idempotency state with strong
+// consistency and no external database.
+//
+// The caller runs raft (transport, log and snapshot stores, bootstrapping)
+// with the FSM from NewFSM, then wraps it with NewStore. Reads and writes go
+// through the leader; followers forward them when WithForwarding is set and
+// otherwise fail with ErrNotLeader.
+package potencyraft
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gopatchy/potency"
+	"github.com/hashicorp/raft"
+)
+
+type Option func(*Store)
+
+type Store struct {
+	raft *raft.Raft
+	fsm  *FSM
+
+	maxAge time.Duration
+
+	leaderURL func(raft.ServerAddress, raft.ServerID) string
+	client    *http.Client
+}
+
+var (
+	ErrNotLeader = errors.New("not the raft leader")
+	ErrForward   = errors.New("forward to raft leader failed")
+)
+
+const defaultTimeout = 5 * time.Second
+
+// NewStore serves potency.Store operations from r, whose FSM must be fsm.
+func NewStore(r *raft.Raft, fsm *FSM, opts ...Option) *Store {
+	s := &Store{
+		raft:   r,
+		fsm:    fsm,
+		client: http.DefaultClient,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// WithMaxAge makes Compact delete results older than maxAge before taking a
+// raft snapshot. By default results stay until deleted.
+func WithMaxAge(maxAge time.Duration) Option {
+	return func(s *Store) {
+		s.maxAge = maxAge
+	}
+}
+
+// WithForwarding sends operations on followers to the leader's Handler,
+// found at the URL that leaderURL returns for the leader's raft address and
+// ID.
+func WithForwarding(leaderURL func(raft.ServerAddress, raft.ServerID) string, client *http.Client) Option {
+	return func(s *Store) {
+		s.leaderURL = leaderURL
+
+		if client != nil {
+			s.client = client
+		}
+	}
+}
+
+func (s *Store) Get(ctx context.Context, key string) (*potency.SavedResult, error) {
+	data, err := s.do(ctx, &command{Op: opGet, Key: key})
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	return potency.Unmarshal(data)
+}
+
+func (s *Store) Put(ctx context.Context, sr *potency.SavedResult) error {
+	data, err := sr.Marshal()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.do(ctx, &command{Op: opPut, Key: sr.Key, Value: data})
+
+	return err
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	_, err := s.do(ctx, &command{Op: opDelete, Key: key})
+	return err
+}
+
+// Compact expires old results under prefix (see WithMaxAge) and takes a raft
+// snapshot so the log can be truncated. Only the leader expires results;
+// every member snapshots its own log.
+func (s *Store) Compact(ctx context.Context, prefix string) error {
+	if s.maxAge > 0 && s.raft.State() == raft.Leader {
+		before := time.Now().Add(-s.maxAge).UnixNano()
+
+		_, err := s.do(ctx, &command{Op: opExpire, Key: prefix, Before: before})
+		if err != nil {
+			return err
+		}
+	}
+
+	err := s.raft.Snapshot().Error()
+	if errors.Is(err, raft.ErrNothingNewToSnapshot) {
+		return nil
+	}
+
+	return err
+}
+
+// Handler serves operations forwarded by followers. Mount it where
+// WithForwarding's leaderURL points, on a listener only cluster members can
+// reach.
+func (s *Store) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		cmd := &command{}
+
+		err := cbor.NewDecoder(r.Body).Decode(cmd)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		data, err := s.local(r.Context(), cmd)
+
+		switch {
+		case errors.Is(err, ErrNotLeader):
+			http.Error(w, err.Error(), http.StatusMisdirectedRequest)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		case data == nil:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			_, _ = w.Write(data)
+		}
+	})
+}
+
+func (s *Store) do(ctx context.Context, cmd *command) ([]byte, error) {
+	data, err := s.local(ctx, cmd)
+	if !errors.Is(err, ErrNotLeader) || s.leaderURL == nil {
+		return data, err
+	}
+
+	return s.forward(ctx, cmd)
+}
+
+// local runs cmd on this member, which must be the leader.
+func (s *Store) local(ctx context.Context, cmd *command) ([]byte, error) {
+	if s.raft.State() != raft.Leader {
+		return nil, ErrNotLeader
+	}
+
+	if cmd.Op == opGet {
+		// Confirms no newer leader has accepted writes this FSM hasn't
+		// applied.
+		err := s.raft.VerifyLeader().Error()
+		if err != nil {
+			return nil, leaderErr(err)
+		}
+
+		return s.fsm.get(cmd.Key), nil
+	}
+
+	data, err := cbor.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.raft.Apply(data, timeout(ctx)).Error()
+	if err != nil {
+		return nil, leaderErr(err)
+	}
+
+	return nil, nil
+}
+
+func (s *Store) forward(ctx context.Context, cmd *command) ([]byte, error) {
+	addr, id := s.raft.LeaderWithID()
+	if addr == "" {
+		return nil, ErrNotLeader
+	}
+
+	body, err := cbor.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.leaderURL(addr, id), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s (%w)", err, ErrForward)
+	}
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s (%w)", err, ErrForward)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return data, nil
+	case http.StatusNoContent:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%s: %s (%w)", resp.Status, bytes.TrimSpace(data), ErrForward)
+	}
+}
+
+func leaderErr(err error) error {
+	if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) {
+		return fmt.Errorf("%s (%w)", err, ErrNotLeader)
+	}
+
+	return err
+}
+
+func timeout(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return defaultTimeout
+	}
+
+	return time.Until(deadline)
+}
@@ -0,0 +1,195 @@
+package potencyraft_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/gopatchy/potency/potencyraft"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+)
+
+type node struct {
+	raft      *raft.Raft
+	store     *potencyraft.Store
+	srv       *httptest.Server
+	transport *raft.InmemTransport
+}
+
+func newCluster(t *testing.T, n int, opts ...potencyraft.Option) []*node {
+	nodes := []*node{}
+	urls := map[raft.ServerAddress]string{}
+	servers := []raft.Server{}
+
+	leaderURL := func(addr raft.ServerAddress, id raft.ServerID) string {
+		return urls[addr]
+	}
+
+	for i := 0; i < n; i++ {
+		addr, transport := raft.NewInmemTransport("")
+
+		for _, other := range nodes {
+			transport.Connect(other.transport.LocalAddr(), other.transport)
+			other.transport.Connect(addr, transport)
+		}
+
+		cfg := raft.DefaultConfig()
+		cfg.LocalID = raft.ServerID(fmt.Sprintf("node%d", i))
+		cfg.HeartbeatTimeout = 50 * time.Millisecond
+		cfg.ElectionTimeout = 50 * time.Millisecond
+		cfg.LeaderLeaseTimeout = 50 * time.Millisecond
+		cfg.CommitTimeout = 5 * time.Millisecond
+		cfg.Logger = hclog.NewNullLogger()
+
+		fsm := potencyraft.NewFSM()
+
+		r, err := raft.NewRaft(cfg, fsm, raft.NewInmemStore(), raft.NewInmemStore(), raft.NewInmemSnapshotStore(), transport)
+		require.NoError(t, err)
+
+		store := potencyraft.NewStore(r, fsm, append(opts, potencyraft.WithForwarding(leaderURL, nil))...)
+		srv := httptest.NewServer(store.Handler())
+		urls[addr] = srv.URL
+
+		nodes = append(nodes, &node{
+			raft:      r,
+			store:     store,
+			srv:       srv,
+			transport: transport,
+		})
+
+		servers = append(servers, raft.Server{ID: cfg.LocalID, Address: addr})
+	}
+
+	require.NoError(t, nodes[0].raft.BootstrapCluster(raft.Configuration{Servers: servers}).Error())
+
+	require.Eventually(t, func() bool {
+		addr, _ := nodes[0].raft.LeaderWithID()
+		return addr != ""
+	}, 5*time.Second, 10*time.Millisecond)
+
+	t.Cleanup(func() {
+		for _, n := range nodes {
+			require.NoError(t, n.raft.Shutdown().Error())
+			n.srv.Close()
+			n.transport.Close()
+		}
+	})
+
+	return nodes
+}
+
+func TestReplicated(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	nodes := newCluster(t, 3)
+	key := uniuri.New()
+
+	for _, n := range nodes {
+		sr, err := n.store.Get(ctx, key)
+		require.NoError(t, err)
+		require.Nil(t, sr)
+	}
+
+	// Written through a follower or the leader, depending on the election
+	require.NoError(t, nodes[2].store.Put(ctx, &potency.SavedResult{
+		Key:          key,
+		StatusCode:   http.StatusCreated,
+		ResponseBody: []byte("ok"),
+		Added:        time.Now(),
+	}))
+
+	for _, n := range nodes {
+		sr, err := n.store.Get(ctx, key)
+		require.NoError(t, err)
+		require.NotNil(t, sr)
+		require.Equal(t, []byte("ok"), sr.ResponseBody)
+	}
+
+	require.NoError(t, nodes[1].store.Delete(ctx, key))
+
+	for _, n := range nodes {
+		sr, err := n.store.Get(ctx, key)
+		require.NoError(t, err)
+		require.Nil(t, sr)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	nodes := newCluster(t, 3)
+	key := uniuri.New()
+	calls := 0
+
+	fn := func(ctx context.Context) (potency.Result, error) {
+		calls++
+		return potency.Result{Value: []byte("done")}, nil
+	}
+
+	for _, n := range nodes {
+		p := potency.NewPotency(http.NotFoundHandler(), potency.WithStore(n.store))
+
+		res, _, err := p.Do(context.Background(), key, fn)
+		require.NoError(t, err)
+		require.Equal(t, []byte("done"), res.Value)
+	}
+
+	require.Equal(t, 1, calls)
+}
+
+func TestCompact(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	nodes := newCluster(t, 1, potencyraft.WithMaxAge(time.Hour))
+
+	oldKey := uniuri.New()
+	newKey := uniuri.New()
+
+	require.NoError(t, nodes[0].store.Put(ctx, &potency.SavedResult{Key: oldKey, Added: time.Now().Add(-2 * time.Hour)}))
+	require.NoError(t, nodes[0].store.Put(ctx, &potency.SavedResult{Key: newKey, Added: time.Now()}))
+
+	require.NoError(t, nodes[0].store.Compact(ctx, ""))
+
+	sr, err := nodes[0].store.Get(ctx, oldKey)
+	require.NoError(t, err)
+	require.Nil(t, sr)
+
+	sr, err = nodes[0].store.Get(ctx, newKey)
+	require.NoError(t, err)
+	require.NotNil(t, sr)
+}
+
+func TestCompactNamespace(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	nodes := newCluster(t, 1, potencyraft.WithMaxAge(time.Hour))
+
+	key := uniuri.New()
+	added := time.Now().Add(-2 * time.Hour)
+
+	require.NoError(t, nodes[0].store.Put(ctx, &potency.SavedResult{Key: "billing:" + key, Added: added}))
+	require.NoError(t, nodes[0].store.Put(ctx, &potency.SavedResult{Key: "shipping:" + key, Added: added}))
+
+	p := potency.NewPotency(http.NotFoundHandler(), potency.WithStore(nodes[0].store), potency.WithStoreNamespace("billing"))
+	require.NoError(t, p.Compact(ctx))
+
+	sr, err := nodes[0].store.Get(ctx, "billing:"+key)
+	require.NoError(t, err)
+	require.Nil(t, sr)
+
+	sr, err = nodes[0].store.Get(ctx, "shipping:"+key)
+	require.NoError(t, err)
+	require.NotNil(t, sr)
+
+	require.NoError(t, p.Shutdown(ctx))
+}
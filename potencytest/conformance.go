@@ -0,0 +1,303 @@
+package potencytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dchest/uniuri"
+)
+
+// ConformanceError lists the checks an endpoint failed in Conformance.
+type ConformanceError struct {
+	Failures []string
+}
+
+func (e *ConformanceError) Error() string {
+	return fmt.Sprintf("%d conformance checks failed:\n\t%s", len(e.Failures), strings.Join(e.Failures, "\n\t"))
+}
+
+type conformanceCheck struct {
+	name string
+	run  func(c *conformanceClient) error
+}
+
+var conformanceChecks = []conformanceCheck{
+	{"missing key", checkMissingKey},
+	{"invalid key", checkInvalidKey},
+	{"escaped key", checkEscapedKey},
+	{"replay", checkReplay},
+	{"reused key", checkReusedKey},
+	{"concurrent", checkConcurrent},
+}
+
+// Conformance checks the endpoint at url against the IETF Idempotency-Key
+// header draft, as implemented by potency.WithConformance. The endpoint
+// must accept POST requests with a JSON body and respond 2xx; executions
+// should differ in their body so replays can be told apart. It returns a
+// *ConformanceError listing every failed check, or nil.
+func Conformance(client *http.Client, url string) error {
+	c := &conformanceClient{
+		client: client,
+		url:    url,
+	}
+
+	failures := []string{}
+
+	for _, check := range conformanceChecks {
+		err := check.run(c)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", check.name, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return &ConformanceError{Failures: failures}
+	}
+
+	return nil
+}
+
+type conformanceClient struct {
+	client *http.Client
+	url    string
+}
+
+type conformanceResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func (c *conformanceClient) post(key, body string) (*conformanceResponse, error) {
+	req, err := http.NewRequest(http.MethodPost, c.url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conformanceResponse{
+		status: resp.StatusCode,
+		header: resp.Header,
+		body:   data,
+	}, nil
+}
+
+func newConformanceKey() string {
+	return `"` + uniuri.New() + `"`
+}
+
+// problem checks that resp is an application/problem+json document with
+// the given status.
+func (resp *conformanceResponse) problem(status int) error {
+	if resp.status != status {
+		return fmt.Errorf("status %d, want %d", resp.status, status)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.header.Get("Content-Type"))
+	if mediaType != "application/problem+json" {
+		return fmt.Errorf("Content-Type %q, want application/problem+json", resp.header.Get("Content-Type"))
+	}
+
+	doc := struct {
+		Type  *string `json:"type"`
+		Title *string `json:"title"`
+	}{}
+
+	err := json.Unmarshal(resp.body, &doc)
+	if err != nil {
+		return fmt.Errorf("problem document: %w", err)
+	}
+
+	if doc.Type == nil || doc.Title == nil {
+		return fmt.Errorf("problem document %s lacks type or title", resp.body)
+	}
+
+	return nil
+}
+
+func (resp *conformanceResponse) success() error {
+	if resp.status < 200 || resp.status > 299 {
+		return fmt.Errorf("status %d, want 2xx", resp.status)
+	}
+
+	return nil
+}
+
+func (resp *conformanceResponse) same(other *conformanceResponse) bool {
+	return resp.status == other.status && bytes.Equal(resp.body, other.body)
+}
+
+func checkMissingKey(c *conformanceClient) error {
+	resp, err := c.post("", `{}`)
+	if err != nil {
+		return err
+	}
+
+	return resp.problem(http.StatusBadRequest)
+}
+
+func checkInvalidKey(c *conformanceClient) error {
+	for _, key := range []string{uniuri.New(), `""`, `"a"b"`, `"\x"`} {
+		resp, err := c.post(key, `{}`)
+		if err != nil {
+			return err
+		}
+
+		err = resp.problem(http.StatusBadRequest)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+func checkEscapedKey(c *conformanceClient) error {
+	id := uniuri.New()
+
+	first, err := c.post(`"`+id+`\"\\"`, `{}`)
+	if err != nil {
+		return err
+	}
+
+	err = first.success()
+	if err != nil {
+		return err
+	}
+
+	// The same key as the first, written differently, is a different key
+	second, err := c.post(`"`+id+`"`, `{}`)
+	if err != nil {
+		return err
+	}
+
+	if second.same(first) {
+		return fmt.Errorf("escapes ignored")
+	}
+
+	return nil
+}
+
+func checkReplay(c *conformanceClient) error {
+	key := newConformanceKey()
+
+	first, err := c.post(key, `{"n":1}`)
+	if err != nil {
+		return err
+	}
+
+	err = first.success()
+	if err != nil {
+		return err
+	}
+
+	second, err := c.post(key, `{"n":1}`)
+	if err != nil {
+		return err
+	}
+
+	if !second.same(first) {
+		return fmt.Errorf("retry got %d %q, want %d %q", second.status, second.body, first.status, first.body)
+	}
+
+	return nil
+}
+
+func checkReusedKey(c *conformanceClient) error {
+	key := newConformanceKey()
+
+	first, err := c.post(key, `{"n":1}`)
+	if err != nil {
+		return err
+	}
+
+	err = first.success()
+	if err != nil {
+		return err
+	}
+
+	second, err := c.post(key, `{"n":2}`)
+	if err != nil {
+		return err
+	}
+
+	return second.problem(http.StatusUnprocessableEntity)
+}
+
+func checkConcurrent(c *conformanceClient) error {
+	const n = 10
+
+	key := newConformanceKey()
+	resps := make([]*conformanceResponse, n)
+	errs := make([]error, n)
+
+	start := make(chan struct{})
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			<-start
+			resps[i], errs[i] = c.post(key, `{"n":1}`)
+		}(i)
+	}
+
+	close(start)
+	wg.Wait()
+
+	var executed *conformanceResponse
+
+	for i, resp := range resps {
+		if errs[i] != nil {
+			return errs[i]
+		}
+
+		if resp.status == http.StatusConflict {
+			err := resp.problem(http.StatusConflict)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		err := resp.success()
+		if err != nil {
+			return err
+		}
+
+		if executed == nil {
+			executed = resp
+		} else if !resp.same(executed) {
+			return fmt.Errorf("duplicates executed: %q and %q", executed.body, resp.body)
+		}
+	}
+
+	return nil
+}
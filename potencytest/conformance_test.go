@@ -0,0 +1,55 @@
+package potencytest_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/gopatchy/potency/potencytest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(potency.NewPotency(handler(0), potency.WithConformance("")))
+	defer srv.Close()
+
+	require.NoError(t, potencytest.Conformance(srv.Client(), srv.URL))
+}
+
+func TestConformanceFailures(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(potency.NewPotency(handler(0)))
+	defer srv.Close()
+
+	err := potencytest.Conformance(srv.Client(), srv.URL)
+
+	ce := &potencytest.ConformanceError{}
+	require.ErrorAs(t, err, &ce)
+
+	// Keys are optional, errors aren't problems and mismatches are 400
+	require.Len(t, ce.Failures, 3)
+	require.Contains(t, ce.Failures[0], "missing key")
+}
+
+func TestConformanceBroken(t *testing.T) {
+	t.Parallel()
+
+	// Executes every time
+	srv := httptest.NewServer(potency.NewPotency(handler(0), potency.WithConformance(""), potency.WithKeyExtractor(func(r *http.Request) (string, error) {
+		if r.Header.Get("Idempotency-Key") == "" {
+			return "", nil
+		}
+
+		return uniuri.New(), nil
+	})))
+	defer srv.Close()
+
+	ce := &potencytest.ConformanceError{}
+	require.ErrorAs(t, potencytest.Conformance(srv.Client(), srv.URL), &ce)
+	require.NotEmpty(t, ce.Failures)
+}
@@ -0,0 +1,243 @@
+// Package potencytest provides utilities for testing handlers wrapped with
+// potency.
+package potencytest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gopatchy/potency"
+)
+
+// StormResult is the outcome of Storm.
+type StormResult struct {
+	// Executions is how many times the handler ran.
+	Executions int
+
+	// Outcomes counts the requests by how potency handled them.
+	Outcomes map[potency.Outcome]int
+
+	// Responses holds each request's response, in the order the requests
+	// were created.
+	Responses []*httptest.ResponseRecorder
+
+	// Executed is the index in Responses of the request whose execution
+	// was saved, or -1 if none was.
+	Executed int
+}
+
+type stormIndexKey struct{}
+
+// Storm sends n requests built by newRequest to a new Potency wrapping
+// handler, all released at once, and records what happened to each. The
+// requests should share an Idempotency-Key and be identical otherwise. opts
+// configure the Potency; policy handles requests that arrive while the key
+// is executing.
+func Storm(n int, policy potency.ConflictPolicy, handler http.Handler, newRequest func() *http.Request, opts ...potency.Option) *StormResult {
+	res := &StormResult{
+		Outcomes:  map[potency.Outcome]int{},
+		Responses: make([]*httptest.ResponseRecorder, n),
+		Executed:  -1,
+	}
+
+	var (
+		mu         sync.Mutex
+		executions int64
+	)
+
+	counting := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&executions, 1)
+
+		mu.Lock()
+		res.Executed, _ = r.Context().Value(stormIndexKey{}).(int)
+		mu.Unlock()
+
+		handler.ServeHTTP(w, r)
+	})
+
+	metrics := potency.MetricsFunc(func(labels potency.MetricLabels) {
+		mu.Lock()
+		res.Outcomes[labels.Outcome]++
+		mu.Unlock()
+	})
+
+	p := potency.NewPotency(counting, append(opts, potency.WithMetrics(metrics))...)
+	defer func() { _ = p.Shutdown(context.Background()) }()
+
+	p.SetConflictPolicy(policy)
+
+	reqs := make([]*http.Request, n)
+
+	for i := range reqs {
+		r := newRequest()
+		reqs[i] = r.WithContext(context.WithValue(r.Context(), stormIndexKey{}, i))
+		res.Responses[i] = httptest.NewRecorder()
+	}
+
+	start := make(chan struct{})
+	wg := sync.WaitGroup{}
+
+	for i := range reqs {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			<-start
+			p.ServeHTTP(res.Responses[i], reqs[i])
+		}(i)
+	}
+
+	close(start)
+	wg.Wait()
+
+	res.Executions = int(atomic.LoadInt64(&executions))
+
+	return res
+}
+
+// StormReserve runs n callers of the Lookup, Reserve, Complete sequence used
+// by integrations such as potencygrpc, all released at once against a new
+// Potency and sharing key, and records what happened to each. execute
+// produces the result to save; its StatusCode and ResponseBody become the
+// caller's response. opts configure the Potency.
+func StormReserve(n int, key string, execute func(context.Context) *potency.SavedResult, opts ...potency.Option) *StormResult {
+	res := &StormResult{
+		Outcomes:  map[potency.Outcome]int{},
+		Responses: make([]*httptest.ResponseRecorder, n),
+		Executed:  -1,
+	}
+
+	p := potency.NewPotency(http.NotFoundHandler(), opts...)
+	defer func() { _ = p.Shutdown(context.Background()) }()
+
+	var mu sync.Mutex
+
+	record := func(i int, outcome potency.Outcome, sr *potency.SavedResult) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		res.Outcomes[outcome]++
+
+		switch outcome {
+		case potency.OutcomeStored:
+			res.Executions++
+			res.Executed = i
+		case potency.OutcomeNotStored:
+			res.Executions++
+		}
+
+		if sr != nil {
+			res.Responses[i].WriteHeader(sr.StatusCode)
+			_, _ = res.Responses[i].Write(sr.ResponseBody)
+		}
+	}
+
+	for i := range res.Responses {
+		res.Responses[i] = httptest.NewRecorder()
+	}
+
+	start := make(chan struct{})
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			<-start
+
+			ctx := context.Background()
+
+			saved, err := p.Lookup(ctx, key)
+			if err != nil {
+				record(i, potency.OutcomeRejected, nil)
+				return
+			}
+
+			if saved != nil {
+				record(i, potency.OutcomeReplayed, saved)
+				return
+			}
+
+			rsv, err := p.Reserve(key)
+
+			savedErr := &potency.SavedError{}
+
+			switch {
+			case errors.As(err, &savedErr):
+				record(i, potency.OutcomeReplayed, savedErr.Result)
+				return
+			case errors.Is(err, potency.ErrConflict):
+				record(i, potency.OutcomeConflict, nil)
+				return
+			case err != nil:
+				record(i, potency.OutcomeRejected, nil)
+				return
+			}
+
+			defer rsv.Release()
+
+			sr := execute(rsv.Context(ctx))
+
+			if rsv.Complete(ctx, sr) != nil {
+				record(i, potency.OutcomeNotStored, sr)
+				return
+			}
+
+			record(i, potency.OutcomeStored, sr)
+		}(i)
+	}
+
+	close(start)
+	wg.Wait()
+
+	return res
+}
+
+// Check returns an error unless the handler ran exactly once and every
+// other request either replayed that response or was rejected as a
+// conflict.
+func (res *StormResult) Check() error {
+	if res.Executions != 1 {
+		return fmt.Errorf("handler executed %d times, want 1", res.Executions)
+	}
+
+	if res.Outcomes[potency.OutcomeStored] != 1 {
+		return fmt.Errorf("%d responses stored, want 1", res.Outcomes[potency.OutcomeStored])
+	}
+
+	total := 0
+	for _, count := range res.Outcomes {
+		total += count
+	}
+
+	replayed := res.Outcomes[potency.OutcomeReplayed]
+	conflicts := res.Outcomes[potency.OutcomeConflict]
+
+	if replayed+conflicts+1 != total || total != len(res.Responses) {
+		return fmt.Errorf("outcomes %v, want 1 stored and the rest replayed or conflict of %d", res.Outcomes, len(res.Responses))
+	}
+
+	want := res.Responses[res.Executed]
+	same := 0
+
+	for _, rec := range res.Responses {
+		if rec.Code == want.Code && bytes.Equal(rec.Body.Bytes(), want.Body.Bytes()) {
+			same++
+		}
+	}
+
+	if same != replayed+1 {
+		return fmt.Errorf("%d responses match the executed one, want %d", same, replayed+1)
+	}
+
+	return nil
+}
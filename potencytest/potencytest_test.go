@@ -0,0 +1,82 @@
+package potencytest_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/gopatchy/potency/potencytest"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(key string) func() *http.Request {
+	return func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"qty":1}`))
+		r.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+		return r
+	}
+}
+
+func handler(delay time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(uniuri.New()))
+	})
+}
+
+func TestStorm(t *testing.T) {
+	t.Parallel()
+
+	for i := 0; i < 50; i++ {
+		res := potencytest.Storm(20, potency.ConflictError, handler(0), newRequest(uniuri.New()))
+		require.NoError(t, res.Check())
+	}
+}
+
+func TestStormConflict(t *testing.T) {
+	t.Parallel()
+
+	res := potencytest.Storm(20, potency.ConflictError, handler(100*time.Millisecond), newRequest(uniuri.New()))
+	require.NoError(t, res.Check())
+	require.Positive(t, res.Outcomes[potency.OutcomeConflict])
+}
+
+func TestStormWait(t *testing.T) {
+	t.Parallel()
+
+	for i := 0; i < 20; i++ {
+		res := potencytest.Storm(20, potency.ConflictWait, handler(time.Millisecond), newRequest(uniuri.New()))
+		require.NoError(t, res.Check())
+		require.Equal(t, 19, res.Outcomes[potency.OutcomeReplayed])
+	}
+}
+
+func TestStormReserve(t *testing.T) {
+	t.Parallel()
+
+	execute := func(context.Context) *potency.SavedResult {
+		return &potency.SavedResult{
+			StatusCode:   http.StatusOK,
+			ResponseBody: []byte(uniuri.New()),
+		}
+	}
+
+	for i := 0; i < 50; i++ {
+		res := potencytest.StormReserve(20, uniuri.New(), execute)
+		require.NoError(t, res.Check())
+	}
+}
+
+func TestStormCheck(t *testing.T) {
+	t.Parallel()
+
+	res := &potencytest.StormResult{Executions: 2}
+	require.Error(t, res.Check())
+}
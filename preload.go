@@ -0,0 +1,67 @@
+package potency
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// Loader returns saved results to warm the cache with, e.g. from a system of
+// record or the snapshot written at a previous Shutdown.
+type Loader func(ctx context.Context) ([]*SavedResult, error)
+
+func (p *Potency) SetLoader(loader Loader) {
+	p.cacheMu.Lock()
+	defer p.cacheMu.Unlock()
+
+	p.loader = loader
+}
+
+// Warm calls the loader (if any) and preloads its results. Call it before
+// taking traffic.
+func (p *Potency) Warm(ctx context.Context) error {
+	p.cacheMu.RLock()
+	loader := p.loader
+	p.cacheMu.RUnlock()
+
+	if loader == nil {
+		return nil
+	}
+
+	entries, err := loader(ctx)
+	if err != nil {
+		return err
+	}
+
+	p.Preload(entries)
+
+	return nil
+}
+
+// Preload adds entries to the local cache without replicating them. Entries
+// that have already expired or whose key is already cached are skipped; a
+// zero Added time is treated as now. The cache keeps copies, so entries
+// aren't modified.
+func (p *Potency) Preload(entries []*SavedResult) {
+	sorted := make([]*SavedResult, len(entries))
+
+	now := time.Now()
+
+	for i, sr := range entries {
+		sorted[i] = sr.withKey(sr.Key)
+
+		if sorted[i].Added.IsZero() {
+			sorted[i].Added = now
+		}
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Added.Before(sorted[j].Added) })
+
+	for _, sr := range sorted {
+		if p.expired(sr) {
+			continue
+		}
+
+		p.insert(sr)
+	}
+}
@@ -0,0 +1,83 @@
+package potency_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarm(t *testing.T) {
+	t.Parallel()
+
+	ts1 := newTestServer(t)
+	defer ts1.shutdown(t)
+
+	snapshot := []*potency.SavedResult{}
+
+	ts1.pot.SetSnapshotter(func(ctx context.Context, results []*potency.SavedResult) error {
+		snapshot = results
+		return nil
+	})
+
+	key1 := uniuri.New()
+
+	resp, err := ts1.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	require.NoError(t, ts1.pot.Shutdown(context.Background()))
+
+	ts2 := newTestServer(t)
+	defer ts2.shutdown(t)
+
+	ts2.pot.SetLoader(func(ctx context.Context) ([]*potency.SavedResult, error) {
+		expired := &potency.SavedResult{
+			Key:   uniuri.New(),
+			Added: time.Now().Add(-24 * time.Hour),
+		}
+
+		return append(snapshot, expired), nil
+	})
+
+	require.NoError(t, ts2.pot.Warm(context.Background()))
+	require.Equal(t, 1, ts2.pot.NumCached())
+
+	resp, err = ts2.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, resp1, resp.String())
+}
+
+func TestPreload(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler())
+
+	key1 := uniuri.New()
+
+	entry := &potency.SavedResult{Key: key1, Method: http.MethodPost, StatusCode: http.StatusOK}
+
+	p.Preload([]*potency.SavedResult{entry})
+
+	sr := mustLookup(t, p, key1)
+	require.NotNil(t, sr)
+	require.False(t, sr.Added.IsZero())
+
+	// The caller's entry is left alone
+	require.True(t, entry.Added.IsZero())
+	require.NotSame(t, entry, sr)
+}
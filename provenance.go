@@ -0,0 +1,39 @@
+package potency
+
+import (
+	"net/http"
+)
+
+// Provenance selects request metadata recorded with each saved result, so
+// incident responders can see who created it. The principal (see
+// WithPrincipal) and request ID are always recorded.
+type Provenance int
+
+const (
+	// ProvenanceClientIP records the originating client IP, taken like
+	// ForwardedClientIP, in SavedResult.ClientIP.
+	ProvenanceClientIP Provenance = 1 << iota
+
+	// ProvenanceUserAgent records the User-Agent header in
+	// SavedResult.UserAgent.
+	ProvenanceUserAgent
+)
+
+// WithProvenance records the selected metadata with each saved result (e.g.
+// ProvenanceClientIP|ProvenanceUserAgent). It is stored and replicated with
+// the result and shown by Lookup and Export, but never replayed.
+func WithProvenance(fields Provenance) Option {
+	return func(cfg *config) {
+		cfg.provenance = fields
+	}
+}
+
+func (cfg *config) recordProvenance(r *http.Request, sr *SavedResult) {
+	if cfg.provenance&ProvenanceClientIP != 0 {
+		sr.ClientIP = clientIP(r)
+	}
+
+	if cfg.provenance&ProvenanceUserAgent != 0 {
+		sr.UserAgent = r.UserAgent()
+	}
+}
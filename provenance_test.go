@@ -0,0 +1,75 @@
+package potency_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvenance(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(uniuri.New()))
+	})
+
+	for _, test := range []struct {
+		fields    potency.Provenance
+		clientIP  string
+		userAgent string
+	}{
+		{0, "", ""},
+		{potency.ProvenanceClientIP, "192.0.2.7", ""},
+		{potency.ProvenanceClientIP | potency.ProvenanceUserAgent, "192.0.2.7", "test-agent/1.0"},
+	} {
+		p := potency.NewPotency(handler, potency.WithProvenance(test.fields))
+
+		key := uniuri.New()
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = "192.0.2.7:1234"
+		req.Header.Set("Idempotency-Key", `"`+key+`"`)
+		req.Header.Set("User-Agent", "test-agent/1.0")
+		p.ServeHTTP(httptest.NewRecorder(), req)
+
+		sr := mustLookup(t, p, key)
+		require.NotNil(t, sr)
+		require.Equal(t, test.clientIP, sr.ClientIP)
+		require.Equal(t, test.userAgent, sr.UserAgent)
+
+		// Survives the wire format and export
+		data, err := sr.Marshal()
+		require.NoError(t, err)
+
+		sr2, err := potency.Unmarshal(data)
+		require.NoError(t, err)
+		require.Equal(t, test.clientIP, sr2.ClientIP)
+		require.Equal(t, test.userAgent, sr2.UserAgent)
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, p.Export(buf))
+
+		p2 := potency.NewPotency(handler)
+		require.NoError(t, p2.Import(buf))
+
+		sr3, err := p2.Lookup(context.Background(), key)
+		require.NoError(t, err)
+		require.Equal(t, test.clientIP, sr3.ClientIP)
+		require.Equal(t, test.userAgent, sr3.UserAgent)
+
+		// Never replayed
+		req = httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		require.Equal(t, "true", rec.Header().Get(potency.ReplayedHeader))
+		require.NotContains(t, rec.Header(), "User-Agent")
+	}
+}
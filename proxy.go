@@ -0,0 +1,25 @@
+package potency
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+// NewReverseProxy returns a Potency that forwards requests to upstream, so it
+// can run as a sidecar in front of an application that knows nothing about
+// idempotency keys. Responses are streamed as the upstream flushes them. When
+// the upstream can't be reached the 502 is not stored, so a retry tries
+// again.
+func NewReverseProxy(upstream *url.URL, opts ...Option) *Potency {
+	proxy := httputil.NewSingleHostReverseProxy(upstream)
+	proxy.FlushInterval = -1
+	proxy.ErrorHandler = proxyError
+
+	return NewPotency(proxy, opts...)
+}
+
+func proxyError(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set(ControlHeader, "no-store")
+	w.WriteHeader(http.StatusBadGateway)
+}
@@ -0,0 +1,75 @@
+package potency_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/go-resty/resty/v2"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseProxy(t *testing.T) {
+	t.Parallel()
+
+	calls := int32(0)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(r.URL.Path + " " + string(rune('0'+n))))
+	}))
+	defer upstream.Close()
+
+	u, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+
+	p := potency.NewReverseProxy(u)
+
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	c := resty.New().SetBaseURL(srv.URL)
+	key := uniuri.New()
+
+	resp, err := c.R().
+		SetHeader("Idempotency-Key", `"`+key+`"`).
+		Post("/orders")
+	require.NoError(t, err)
+	require.Equal(t, "/orders 1", resp.String())
+
+	resp, err = c.R().
+		SetHeader("Idempotency-Key", `"`+key+`"`).
+		Post("/orders")
+	require.NoError(t, err)
+	require.Equal(t, "/orders 1", resp.String())
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+}
+
+func TestReverseProxyUnreachable(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	u, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+	upstream.Close()
+
+	p := potency.NewReverseProxy(u)
+
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	c := resty.New().SetBaseURL(srv.URL)
+	key := uniuri.New()
+
+	resp, err := c.R().
+		SetHeader("Idempotency-Key", `"`+key+`"`).
+		Post("/orders")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode())
+	require.Equal(t, 0, p.NumCached())
+}
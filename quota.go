@@ -0,0 +1,49 @@
+package potency
+
+import "errors"
+
+type QuotaPolicy int
+
+const (
+	// QuotaReject responds 429 to new keys from a principal at its quota.
+	QuotaReject QuotaPolicy = iota
+
+	// QuotaEvictOldest evicts the principal's oldest entry to make room.
+	QuotaEvictOldest
+)
+
+var ErrQuotaExceeded = errors.New("idempotency key quota exceeded")
+
+// WithPrincipalQuota caps the number of cached entries per principal (see
+// WithPrincipal), so one client generating unique keys can't crowd out
+// everyone else. Entries without a principal are not limited.
+func WithPrincipalQuota(n int, policy QuotaPolicy) Option {
+	return func(cfg *config) {
+		cfg.principalQuota = n
+		cfg.quotaPolicy = policy
+	}
+}
+
+func (p *Potency) overQuota(principal string) bool {
+	p.cacheMu.RLock()
+	defer p.cacheMu.RUnlock()
+
+	return principal != "" &&
+		p.cfg.principalQuota > 0 &&
+		p.cfg.quotaPolicy == QuotaReject &&
+		p.principalCount[principal] >= p.cfg.principalQuota
+}
+
+// enforceQuota evicts the oldest entries of sr's principal while it is over
+// quota. Requires cacheMu.
+func (p *Potency) enforceQuota(sr *SavedResult) {
+	if sr.Principal == "" || p.cfg.principalQuota <= 0 || p.cfg.quotaPolicy != QuotaEvictOldest {
+		return
+	}
+
+	for iter := p.cacheOldest; iter != nil && p.principalCount[sr.Principal] > p.cfg.principalQuota; iter = iter.newer {
+		if iter != sr && iter.Principal == sr.Principal && p.cache[iter.Key] == iter {
+			p.deleteLocked(iter, EvictCapacity)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package potency_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func userPrincipal(r *http.Request) string {
+	return r.Header.Get("X-User")
+}
+
+func (ts *testServer) postAs(t *testing.T, user, key string) *http.Response {
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key)).
+		SetHeader("X-User", user).
+		Post("")
+	require.NoError(t, err)
+
+	return resp.RawResponse
+}
+
+func TestPrincipalQuotaReject(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t,
+		potency.WithPrincipal(userPrincipal),
+		potency.WithPrincipalQuota(2, potency.QuotaReject),
+	)
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	require.Equal(t, http.StatusOK, ts.postAs(t, "alice", key1).StatusCode)
+	require.Equal(t, http.StatusOK, ts.postAs(t, "alice", uniuri.New()).StatusCode)
+	require.Equal(t, http.StatusTooManyRequests, ts.postAs(t, "alice", uniuri.New()).StatusCode)
+
+	// Replays and other principals are unaffected
+	require.Equal(t, http.StatusOK, ts.postAs(t, "alice", key1).StatusCode)
+	require.Equal(t, http.StatusOK, ts.postAs(t, "bob", uniuri.New()).StatusCode)
+
+	require.Equal(t, 3, ts.pot.NumCached())
+}
+
+func TestPrincipalQuotaEvict(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t,
+		potency.WithPrincipal(userPrincipal),
+		potency.WithPrincipalQuota(2, potency.QuotaEvictOldest),
+	)
+	defer ts.shutdown(t)
+
+	bobKey := uniuri.New()
+	require.Equal(t, http.StatusOK, ts.postAs(t, "bob", bobKey).StatusCode)
+
+	aliceKeys := []string{uniuri.New(), uniuri.New(), uniuri.New()}
+
+	for _, key := range aliceKeys {
+		require.Equal(t, http.StatusOK, ts.postAs(t, "alice", key).StatusCode)
+	}
+
+	require.Equal(t, 3, ts.pot.NumCached())
+	require.Nil(t, mustLookup(t, ts.pot, aliceKeys[0]))
+	require.NotNil(t, mustLookup(t, ts.pot, aliceKeys[1]))
+	require.NotNil(t, mustLookup(t, ts.pot, aliceKeys[2]))
+	require.NotNil(t, mustLookup(t, ts.pot, bobKey))
+	require.Equal(t, "bob", mustLookup(t, ts.pot, bobKey).Principal)
+}
@@ -0,0 +1,55 @@
+package potency_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRange(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Get("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+	require.Greater(t, len(resp1), 10)
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("Range", "bytes=2-5").
+		Get("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusPartialContent, resp.StatusCode())
+	require.Equal(t, resp1[2:6], resp.String())
+	require.Equal(t, fmt.Sprintf("bytes 2-5/%d", len(resp1)), resp.Header().Get("Content-Range"))
+	require.Equal(t, "true", resp.Header().Get(potency.ReplayedHeader))
+	require.Equal(t, "bar", resp.Header().Get("X-Response"))
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("Range", "bytes=10-").
+		Get("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusPartialContent, resp.StatusCode())
+	require.Equal(t, resp1[10:], resp.String())
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("Range", fmt.Sprintf("bytes=%d-", len(resp1)+10)).
+		Get("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusRequestedRangeNotSatisfiable, resp.StatusCode())
+}
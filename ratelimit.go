@@ -0,0 +1,92 @@
+package potency
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrRateLimited = errors.New("idempotency key creation rate limited")
+
+// limiter is a set of token buckets, one per scope. A nil scope means the
+// principal, resolved with the request's configuration.
+type limiter struct {
+	perSecond float64
+	burst     float64
+	scope     func(*http.Request) string
+
+	buckets map[string]*bucket
+	mu      sync.Mutex
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Buckets are swept for idle (full) entries once there are this many.
+const limiterSweepSize = 10000
+
+// WithExecutionRateLimit limits how fast each scope may create new keys
+// (replays are not limited), defending against floods of unique keys. scope
+// defaults to the principal (see WithPrincipal, including per method);
+// requests without one share a bucket. Limited requests get 429 with Retry-After.
+func WithExecutionRateLimit(perSecond float64, burst int, scope func(*http.Request) string) Option {
+	return func(cfg *config) {
+		cfg.limiter = &limiter{
+			perSecond: perSecond,
+			burst:     float64(burst),
+			scope:     scope,
+			buckets:   map[string]*bucket{},
+		}
+	}
+}
+
+// allow takes a token for r's scope, with cfg the configuration r is served
+// under. If none is available, it returns how long until one will be.
+func (l *limiter) allow(r *http.Request, cfg *config) (bool, time.Duration) {
+	scope := cfg.principalOf
+	if l.scope != nil {
+		scope = l.scope
+	}
+
+	key := scope(r)
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.buckets) >= limiterSweepSize {
+		l.sweep(now)
+	}
+
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{
+			tokens: l.burst,
+			last:   now,
+		}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.perSecond)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.perSecond * float64(time.Second))
+	}
+
+	b.tokens--
+
+	return true, 0
+}
+
+func (l *limiter) sweep(now time.Time) {
+	for scope, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.perSecond >= l.burst {
+			delete(l.buckets, scope)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package potency_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutionRateLimit(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t,
+		potency.WithPrincipal(userPrincipal),
+		potency.WithExecutionRateLimit(10, 2, nil),
+	)
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	require.Equal(t, http.StatusOK, ts.postAs(t, "alice", key1).StatusCode)
+	require.Equal(t, http.StatusOK, ts.postAs(t, "alice", uniuri.New()).StatusCode)
+
+	resp := ts.postAs(t, "alice", uniuri.New())
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.Equal(t, "1", resp.Header.Get("Retry-After"))
+
+	// Replays and other scopes are not limited
+	require.Equal(t, http.StatusOK, ts.postAs(t, "alice", key1).StatusCode)
+	require.Equal(t, http.StatusOK, ts.postAs(t, "bob", uniuri.New()).StatusCode)
+
+	time.Sleep(150 * time.Millisecond)
+
+	require.Equal(t, http.StatusOK, ts.postAs(t, "alice", uniuri.New()).StatusCode)
+}
+
+func TestExecutionRateLimitMethodPrincipal(t *testing.T) {
+	t.Parallel()
+
+	// The principal is resolved per request, so per-method and later
+	// options apply to the default scope.
+	ts := newTestServer(t,
+		potency.WithExecutionRateLimit(10, 1, nil),
+		potency.WithMethodOptions(http.MethodPost, potency.WithPrincipal(userPrincipal)),
+	)
+	defer ts.shutdown(t)
+
+	require.Equal(t, http.StatusOK, ts.postAs(t, "alice", uniuri.New()).StatusCode)
+	require.Equal(t, http.StatusTooManyRequests, ts.postAs(t, "alice", uniuri.New()).StatusCode)
+	require.Equal(t, http.StatusOK, ts.postAs(t, "bob", uniuri.New()).StatusCode)
+}
@@ -0,0 +1,45 @@
+package potency
+
+import (
+	"net/http"
+)
+
+// WithReceipts saves successful responses with a Location header and a body
+// over threshold bytes as receipts: a 303 See Other to the Location, without
+// the body. Retries are redirected to the resource instead of receiving a
+// cached copy of it. Handlers can also ask for a receipt for any successful
+// response with a Location by setting "Idempotency-Control: receipt".
+// Zero disables the size threshold.
+func WithReceipts(threshold int64) Option {
+	return func(cfg *config) {
+		cfg.receiptThreshold = threshold
+	}
+}
+
+// WithStatusOnly saves only the status and headers of responses, so retries
+// are deduplicated without keeping a copy of the body, e.g. for DELETE.
+// Replays have an empty body and no trailers.
+func WithStatusOnly() Option {
+	return func(cfg *config) {
+		cfg.statusOnly = true
+	}
+}
+
+// receipt returns the Location to save instead of the response, or "".
+func (cfg *config) receipt(status int, header http.Header, size int) string {
+	loc := header.Get("Location")
+
+	if loc == "" || status < 200 || status >= 300 {
+		return ""
+	}
+
+	if hasDirective(header, ControlHeader, "receipt") {
+		return loc
+	}
+
+	if cfg.receiptThreshold > 0 && int64(size) > cfg.receiptThreshold {
+		return loc
+	}
+
+	return ""
+}
@@ -0,0 +1,61 @@
+package potency_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceipts(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+
+	p := potency.NewPotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		w.Header().Set("Location", "/orders/123")
+
+		if r.URL.Path == "/small" {
+			w.Header().Set(potency.ControlHeader, "receipt")
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+	}), potency.WithReceipts(50))
+
+	for _, path := range []string{"/large", "/small"} {
+		key := uniuri.New()
+		post := func() *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, path, nil)
+			req.Header.Set("Idempotency-Key", fmt.Sprintf(`"%s"`, key))
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, req)
+
+			return rec
+		}
+
+		rec := post()
+		require.Equal(t, http.StatusCreated, rec.Code)
+		require.Equal(t, 100, rec.Body.Len())
+
+		sr := mustLookup(t, p, key)
+		require.NotNil(t, sr)
+		require.Equal(t, http.StatusSeeOther, sr.StatusCode)
+		require.Empty(t, sr.ResponseBody)
+		require.Equal(t, http.Header{"Location": {"/orders/123"}}, sr.ResponseHeader)
+
+		rec = post()
+		require.Equal(t, http.StatusSeeOther, rec.Code)
+		require.Equal(t, "/orders/123", rec.Header().Get("Location"))
+		require.Equal(t, "0", rec.Header().Get("Content-Length"))
+	}
+
+	require.Equal(t, 2, calls)
+}
@@ -0,0 +1,165 @@
+package potency
+
+import (
+	"container/list"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var ErrTooManyReplays = errors.New("idempotency key replayed too many times")
+
+type EvictionPolicy int
+
+const (
+	// EvictionFIFO evicts the oldest entries first.
+	EvictionFIFO EvictionPolicy = iota
+
+	// EvictionLRU evicts the entries replayed least recently (or, if never
+	// replayed, added least recently) first.
+	EvictionLRU
+)
+
+// WithMaxReplays refuses to replay a result more than n times on this
+// instance, responding 429 with ErrTooManyReplays instead, e.g. to stop a
+// client stuck in a retry loop. Zero (the default) is unlimited.
+func WithMaxReplays(n int64) Option {
+	return func(cfg *config) {
+		cfg.maxReplays = n
+	}
+}
+
+// WithEvictionPolicy sets which entries go first, within each retention
+// class, when the cache is over its byte budget (see WithMaxBytes). The
+// default is EvictionFIFO.
+func WithEvictionPolicy(policy EvictionPolicy) Option {
+	return func(cfg *config) {
+		cfg.evictionPolicy = policy
+	}
+}
+
+// entryStats counts replays of a cached result. Its fields are accessed
+// atomically.
+type entryStats struct {
+	replays      int64
+	lastReplayed int64
+}
+
+// Replays returns how many times the result was replayed by this instance.
+// Replays aren't counted by the store or replicas.
+func (sr *SavedResult) Replays() int64 {
+	if sr.stats == nil {
+		return 0
+	}
+
+	return atomic.LoadInt64(&sr.stats.replays)
+}
+
+// LastReplayed returns when the result was last replayed by this instance,
+// or the zero time.
+func (sr *SavedResult) LastReplayed() time.Time {
+	if sr.stats == nil {
+		return time.Time{}
+	}
+
+	nanos := atomic.LoadInt64(&sr.stats.lastReplayed)
+	if nanos == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanos)
+}
+
+// countReplay records a replay of sr, unless it has already been replayed
+// max times (if max > 0). Results that aren't cached aren't counted.
+func (sr *SavedResult) countReplay(max int64) bool {
+	if sr.stats == nil {
+		return true
+	}
+
+	for {
+		n := atomic.LoadInt64(&sr.stats.replays)
+
+		if max > 0 && n >= max {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt64(&sr.stats.replays, n, n+1) {
+			atomic.StoreInt64(&sr.stats.lastReplayed, time.Now().UnixNano())
+			return true
+		}
+	}
+}
+
+// countReplay counts a replay of sr (see SavedResult.countReplay) and marks
+// it most recently used.
+func (p *Potency) countReplay(sr *SavedResult, max int64) bool {
+	if !sr.countReplay(max) {
+		return false
+	}
+
+	p.lruMu.Lock()
+	defer p.lruMu.Unlock()
+
+	// sr may be a copy of an entry that has since been evicted, whose
+	// element is no longer in the list; MoveToBack ignores it then.
+	if sr.lruElem != nil {
+		p.lru[sr.retention].MoveToBack(sr.lruElem)
+	}
+
+	return true
+}
+
+// lruAdd appends sr, newly cached, to the LRU order of its retention class.
+// Requires cacheMu.
+func (p *Potency) lruAdd(sr *SavedResult) {
+	p.lruMu.Lock()
+	defer p.lruMu.Unlock()
+
+	l := p.lru[sr.retention]
+	if l == nil {
+		l = list.New()
+		p.lru[sr.retention] = l
+	}
+
+	sr.lruElem = l.PushBack(sr)
+}
+
+// lruRemove drops sr, leaving the cache, from the LRU order. Requires
+// cacheMu.
+func (p *Potency) lruRemove(sr *SavedResult) {
+	p.lruMu.Lock()
+	defer p.lruMu.Unlock()
+
+	if sr.lruElem != nil {
+		p.lru[sr.retention].Remove(sr.lruElem)
+		sr.lruElem = nil
+	}
+}
+
+// leastRecentlyUsed returns the least recently used cached entry with the
+// given retention, or nil. Requires cacheMu.
+func (p *Potency) leastRecentlyUsed(retention Retention) *SavedResult {
+	p.lruMu.Lock()
+	defer p.lruMu.Unlock()
+
+	l := p.lru[retention]
+	if l == nil || l.Len() == 0 {
+		return nil
+	}
+
+	return l.Front().Value.(*SavedResult)
+}
+
+// evictLeastRecentlyUsed evicts entries with the given retention, least
+// recently used first, while over the byte budget. Requires cacheMu.
+func (p *Potency) evictLeastRecentlyUsed(retention Retention) {
+	for p.sizeBytes > p.cfg.maxBytes {
+		victim := p.leastRecentlyUsed(retention)
+		if victim == nil {
+			return
+		}
+
+		p.deleteLocked(victim, EvictCapacity)
+	}
+}
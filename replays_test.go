@@ -0,0 +1,101 @@
+package potency_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplays(t *testing.T) {
+	t.Parallel()
+
+	tm := &testMetrics{counts: map[potency.MetricLabels]int{}}
+
+	ts := newTestServer(t, potency.WithMaxReplays(2), potency.WithMetrics(tm))
+	defer ts.shutdown(t)
+
+	key := uniuri.New()
+
+	post := func() int {
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", `"`+key+`"`).
+			Post("/")
+		require.NoError(t, err)
+
+		return resp.StatusCode()
+	}
+
+	require.Equal(t, http.StatusOK, post())
+
+	sr := mustLookup(t, ts.pot, key)
+	require.Zero(t, sr.Replays())
+	require.True(t, sr.LastReplayed().IsZero())
+
+	before := time.Now()
+
+	require.Equal(t, http.StatusOK, post())
+	require.Equal(t, http.StatusOK, post())
+	require.Equal(t, http.StatusTooManyRequests, post())
+
+	require.EqualValues(t, 2, sr.Replays())
+	require.False(t, sr.LastReplayed().Before(before))
+
+	require.Equal(t, 2, tm.get(potency.MetricLabels{Method: http.MethodPost, Outcome: potency.OutcomeReplayed}))
+	require.Equal(t, 1, tm.get(potency.MetricLabels{Method: http.MethodPost, Outcome: potency.OutcomeReplayLimited}))
+
+	_, _, err := ts.pot.Do(context.Background(), key, func(context.Context) (potency.Result, error) {
+		return potency.Result{}, nil
+	})
+	require.Error(t, err)
+}
+
+func TestEvictionLRU(t *testing.T) {
+	t.Parallel()
+
+	for _, policy := range []potency.EvictionPolicy{potency.EvictionFIFO, potency.EvictionLRU} {
+		ts := newTestServer(t, potency.WithEvictionPolicy(policy))
+
+		post := func(key string) {
+			resp, err := ts.r().
+				SetHeader("Idempotency-Key", `"`+key+`"`).
+				Post("/")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode())
+		}
+
+		keys := []string{uniuri.New(), uniuri.New(), uniuri.New(), uniuri.New()}
+
+		post(keys[0])
+		ts.pot.Reconfigure(potency.WithMaxBytes(ts.pot.SizeBytes()*3 + ts.pot.SizeBytes()/2))
+
+		post(keys[1])
+		post(keys[2])
+
+		// Replayed, so most recently used
+		post(keys[0])
+
+		post(keys[3])
+		require.Equal(t, 3, ts.pot.NumCached())
+
+		sr, err := ts.pot.Lookup(context.Background(), keys[0])
+		require.NoError(t, err)
+
+		sr1, err := ts.pot.Lookup(context.Background(), keys[1])
+		require.NoError(t, err)
+
+		if policy == potency.EvictionLRU {
+			require.NotNil(t, sr)
+			require.Nil(t, sr1)
+		} else {
+			require.Nil(t, sr)
+			require.NotNil(t, sr1)
+		}
+
+		ts.shutdown(t)
+	}
+}
@@ -0,0 +1,128 @@
+package potency
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Replicator broadcasts opaque messages between Potency instances, e.g. over
+// Redis pub/sub or NATS. Publish must deliver to all subscribed peers; the
+// publishing instance may receive its own messages and ignores them.
+type Replicator interface {
+	Publish(data []byte) error
+	Subscribe(handler func(data []byte)) error
+}
+
+type replicationOp int
+
+const (
+	replicationStore replicationOp = iota + 1
+	replicationInvalidate
+)
+
+const replicationVersion1 byte = 1
+
+type replicationMessage struct {
+	Op     replicationOp `cbor:"1,keyasint"`
+	Origin string        `cbor:"2,keyasint"`
+	Key    string        `cbor:"3,keyasint"`
+	Result []byte        `cbor:"4,keyasint,omitempty"`
+}
+
+func (p *Potency) SetReplicator(replicator Replicator) error {
+	p.cacheMu.Lock()
+	p.replicator = replicator
+	p.cacheMu.Unlock()
+
+	return replicator.Subscribe(p.receive)
+}
+
+// publish announces a local change to replicas and subscribers.
+func (p *Potency) publish(op replicationOp, key string, sr *SavedResult) {
+	switch op {
+	case replicationStore:
+		p.emit(Event{Op: EventStore, Key: key, Result: sr})
+	case replicationInvalidate:
+		p.emit(Event{Op: EventInvalidate, Key: key})
+	}
+
+	p.cacheMu.RLock()
+	replicator := p.replicator
+	serializer := p.cfg.serializer
+	p.cacheMu.RUnlock()
+
+	if replicator == nil {
+		return
+	}
+
+	msg := &replicationMessage{
+		Op:     op,
+		Origin: p.instanceID,
+		Key:    key,
+	}
+
+	if sr != nil {
+		data, err := serializer.Marshal(sr)
+		if err != nil {
+			return
+		}
+
+		msg.Result = data
+	}
+
+	data, err := cbor.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	_ = replicator.Publish(append([]byte{replicationVersion1}, data...))
+}
+
+func (p *Potency) receive(data []byte) {
+	msg, err := unmarshalReplicationMessage(data)
+	if err != nil || msg.Origin == p.instanceID {
+		return
+	}
+
+	switch msg.Op {
+	case replicationStore:
+		sr, err := p.config().serializer.Unmarshal(msg.Result)
+		if err != nil {
+			return
+		}
+
+		p.insert(sr)
+
+	case replicationInvalidate:
+		p.retire(msg.Key)
+	}
+}
+
+func unmarshalReplicationMessage(data []byte) (*replicationMessage, error) {
+	if len(data) < 1 {
+		return nil, fmt.Errorf("empty replication message (%w)", ErrWireFormat)
+	}
+
+	if data[0] != replicationVersion1 {
+		return nil, fmt.Errorf("replication message version %d (%w)", data[0], ErrUnsupportedVersion)
+	}
+
+	msg := &replicationMessage{}
+
+	err := cbor.Unmarshal(data[1:], msg)
+	if err != nil {
+		return nil, fmt.Errorf("%s (%w)", err, ErrWireFormat)
+	}
+
+	return msg, nil
+}
+
+func newInstanceID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,85 @@
+package potency_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicate(t *testing.T) {
+	t.Parallel()
+
+	ts1 := newTestServer(t)
+	defer ts1.shutdown(t)
+
+	ts2 := newTestServer(t)
+	defer ts2.shutdown(t)
+
+	bus := &testBus{}
+
+	require.NoError(t, ts1.pot.SetReplicator(bus))
+	require.NoError(t, ts2.pot.SetReplicator(bus))
+
+	key1 := uniuri.New()
+
+	resp, err := ts1.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	require.Equal(t, 1, ts2.pot.NumCached())
+
+	resp, err = ts2.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, resp1, resp.String())
+
+	resp, err = ts2.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test2").
+		Post("")
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+
+	require.NoError(t, ts2.pot.Invalidate(context.Background(), key1))
+
+	require.Equal(t, 0, ts1.pot.NumCached())
+	require.Equal(t, 0, ts2.pot.NumCached())
+}
+
+type testBus struct {
+	handlers []func([]byte)
+	mu       sync.Mutex
+}
+
+func (tb *testBus) Publish(data []byte) error {
+	tb.mu.Lock()
+	handlers := tb.handlers
+	tb.mu.Unlock()
+
+	for _, h := range handlers {
+		h(data)
+	}
+
+	return nil
+}
+
+func (tb *testBus) Subscribe(handler func([]byte)) error {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.handlers = append(tb.handlers, handler)
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package potency
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RequestIDExtractor returns the ID (request ID, trace ID) to record with a
+// saved result, or "" for none.
+type RequestIDExtractor func(*http.Request) string
+
+// WithRequestIDExtractor replaces how request IDs are found. By default
+// X-Request-Id is used, falling back to the trace ID from a W3C traceparent
+// header.
+func WithRequestIDExtractor(extractor RequestIDExtractor) Option {
+	return func(cfg *config) {
+		cfg.requestIDExtractor = extractor
+	}
+}
+
+func (cfg *config) requestID(r *http.Request) string {
+	if cfg.requestIDExtractor == nil {
+		return ""
+	}
+
+	return cfg.requestIDExtractor(r)
+}
+
+func defaultRequestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-Id"); id != "" {
+		return id
+	}
+
+	// traceparent: version-traceid-parentid-flags
+	parts := strings.Split(r.Header.Get("traceparent"), "-")
+	if len(parts) == 4 && len(parts[1]) == 32 {
+		return parts[1]
+	}
+
+	return ""
+}
@@ -0,0 +1,71 @@
+package potency_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestID(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("X-Request-Id", "req-1").
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Empty(t, resp.Header().Get(potency.OriginalRequestIDHeader))
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("X-Request-Id", "req-2").
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, "req-1", resp.Header().Get(potency.OriginalRequestIDHeader))
+	require.Equal(t, "req-1", mustLookup(t, ts.pot, key1).RequestID)
+
+	key2 := uniuri.New()
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key2)).
+		SetHeader("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01").
+		SetBody("test2").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", mustLookup(t, ts.pot, key2).RequestID)
+}
+
+func TestRequestIDExtractor(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithRequestIDExtractor(func(r *http.Request) string {
+		return r.Header.Get("X-Correlation-Id")
+	}))
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("X-Request-Id", "req-1").
+		SetHeader("X-Correlation-Id", "corr-1").
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, "corr-1", mustLookup(t, ts.pot, key1).RequestID)
+}
@@ -0,0 +1,122 @@
+package potency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrAlreadySaved means another execution saved a result under the key; see
+// SavedError.
+var ErrAlreadySaved = errors.New("result already saved")
+
+// Reservation is exclusive ownership of a key while its operation executes,
+// for callers outside the HTTP middleware (e.g. potencygrpc). Exactly one of
+// Complete or Release must be called.
+type Reservation struct {
+	p    *Potency
+	key  string
+	exec *execution
+	once sync.Once
+}
+
+// Lookup returns the saved result for key from the local cache, the owning
+// peer or the store, or nil if there is none.
+func (p *Potency) Lookup(ctx context.Context, key string) (*SavedResult, error) {
+	sr, err := p.lookup(ctx, key, p.config())
+	if sr == nil {
+		return nil, err
+	}
+
+	unpacked, err := p.unpack(sr)
+	if err != nil {
+		// Reported as a miss, so the caller executes afresh
+		p.dropCorrupt(sr)
+		return nil, nil
+	}
+
+	return unpacked, nil
+}
+
+// Reserve claims key for execution. It returns ErrConflict if the key is
+// already executing, ErrShuttingDown after Shutdown, and a *SavedError
+// carrying the result if one was saved under key since the caller's Lookup.
+func (p *Potency) Reserve(key string) (*Reservation, error) {
+	for {
+		exec, raced, err := p.lockMissing(key, execSummary{}, p.config().lease)
+		if err != nil {
+			return nil, err
+		}
+
+		if !raced {
+			return &Reservation{
+				p:    p,
+				key:  key,
+				exec: exec,
+			}, nil
+		}
+
+		sr := p.read(key)
+		if sr == nil {
+			sr = p.readPending(key)
+		}
+
+		// Otherwise it was evicted again before we could read it
+		if sr == nil {
+			continue
+		}
+
+		unpacked, err := p.unpack(sr)
+		if err != nil {
+			p.dropCorrupt(sr)
+			continue
+		}
+
+		return nil, &SavedError{Result: unpacked}
+	}
+}
+
+// Token returns the reservation's fencing token.
+func (res *Reservation) Token() uint64 {
+	return res.exec.token
+}
+
+// Context returns ctx carrying the reservation's fencing token and lease
+// deadline (see LeaseDeadline), for the code that performs the reserved
+// operation. Unlike the middleware, it does not cancel ctx when the lease
+// ends.
+func (res *Reservation) Context(ctx context.Context) context.Context {
+	return withLeaseDeadline(withFencingToken(ctx, res.exec.token), res.exec.deadline)
+}
+
+// Complete saves sr under the reserved key and releases the reservation. It
+// returns ErrLeaseLost without saving if the reservation was taken away
+// (see WithWatchdog); any other error means the result is cached locally but
+// was not written to the store.
+func (res *Reservation) Complete(ctx context.Context, sr *SavedResult) error {
+	err := error(nil)
+
+	res.once.Do(func() {
+		if !res.exec.owned() {
+			err = fmt.Errorf("%s (%w)", res.key, ErrLeaseLost)
+			res.p.unlockKey(res.key, res.exec)
+
+			return
+		}
+
+		sr.Key = res.key
+		err = res.p.write(ctx, sr, res.p.config())
+		res.p.unlockKey(res.key, res.exec)
+	})
+
+	return err
+}
+
+// Release gives up the reservation without saving a result. It does nothing
+// after Complete, so it can be deferred.
+func (res *Reservation) Release() {
+	res.once.Do(func() {
+		res.p.unlockKey(res.key, res.exec)
+	})
+}
@@ -0,0 +1,67 @@
+package potency_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReserve(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler())
+
+	key1 := uniuri.New()
+
+	require.Nil(t, mustLookup(t, p, key1))
+
+	res, err := p.Reserve(key1)
+	require.NoError(t, err)
+
+	_, err = p.Reserve(key1)
+	require.ErrorIs(t, err, potency.ErrConflict)
+
+	err = res.Complete(context.Background(), &potency.SavedResult{
+		StatusCode:   http.StatusOK,
+		ResponseBody: []byte("done"),
+	})
+	require.NoError(t, err)
+
+	sr := mustLookup(t, p, key1)
+	require.NotNil(t, sr)
+	require.Equal(t, key1, sr.Key)
+	require.Equal(t, []byte("done"), sr.ResponseBody)
+
+	// As if the caller's Lookup missed before the result was saved
+	_, err = p.Reserve(key1)
+	require.ErrorIs(t, err, potency.ErrAlreadySaved)
+
+	savedErr := &potency.SavedError{}
+	require.ErrorAs(t, err, &savedErr)
+	require.Equal(t, []byte("done"), savedErr.Result.ResponseBody)
+
+	key2 := uniuri.New()
+
+	res, err = p.Reserve(key2)
+	require.NoError(t, err)
+
+	res.Release()
+	res.Release()
+
+	require.Nil(t, mustLookup(t, p, key2))
+
+	res, err = p.Reserve(key2)
+	require.NoError(t, err)
+	res.Release()
+}
+
+func mustLookup(t *testing.T, p *potency.Potency, key string) *potency.SavedResult {
+	sr, err := p.Lookup(context.Background(), key)
+	require.NoError(t, err)
+
+	return sr
+}
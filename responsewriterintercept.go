@@ -3,20 +3,61 @@ package potency
 import (
 	"bytes"
 	"net/http"
+	"strings"
+	"sync"
 )
 
 type responseWriterIntercept struct {
-	dest       http.ResponseWriter
-	buf        bytes.Buffer
-	statusCode int
+	dest        http.ResponseWriter
+	buf         bytes.Buffer
+	statusCode  int
+	wroteHeader bool
+
+	// header is the response header as of WriteHeader; later changes never
+	// reach the client, so they aren't cached either.
+	header http.Header
+
+	isStreaming func(http.Header) bool
+	streaming   bool
+
+	onCommit func()
+}
+
+// Buffers that grew beyond this are dropped rather than pooled, so one huge
+// response doesn't pin memory indefinitely.
+const maxPooledBufferSize = 64 * 1024
+
+var responseWriterInterceptPool = sync.Pool{
+	New: func() any { return &responseWriterIntercept{} },
 }
 
 func newResponseWriterIntercept(dest http.ResponseWriter) *responseWriterIntercept {
-	return &responseWriterIntercept{
-		dest:       dest,
-		buf:        bytes.Buffer{},
-		statusCode: http.StatusOK,
+	rwi := responseWriterInterceptPool.Get().(*responseWriterIntercept)
+
+	rwi.dest = dest
+	rwi.statusCode = http.StatusOK
+
+	return rwi
+}
+
+// release returns rwi to the pool. The buffer is reset in place, keeping
+// its storage for the next response.
+func (rwi *responseWriterIntercept) release() {
+	if rwi.buf.Cap() > maxPooledBufferSize {
+		rwi.buf = bytes.Buffer{}
+	} else {
+		rwi.buf.Reset()
 	}
+
+	rwi.dest = nil
+	rwi.statusCode = 0
+	rwi.wroteHeader = false
+	rwi.header = nil
+	rwi.isStreaming = nil
+	rwi.streaming = false
+	rwi.onCommit = nil
+
+	responseWriterInterceptPool.Put(rwi)
 }
 
 func (rwi *responseWriterIntercept) Header() http.Header {
@@ -24,11 +65,107 @@ func (rwi *responseWriterIntercept) Header() http.Header {
 }
 
 func (rwi *responseWriterIntercept) Write(data []byte) (int, error) {
-	rwi.buf.Write(data)
+	if !rwi.wroteHeader {
+		rwi.commit()
+	}
+
+	if !rwi.streaming {
+		rwi.buf.Write(data)
+	}
+
 	return rwi.dest.Write(data)
 }
 
 func (rwi *responseWriterIntercept) WriteHeader(statusCode int) {
-	rwi.statusCode = statusCode
+	// Informational responses (e.g. 103 Early Hints) go straight through;
+	// only the final status is cached.
+	if statusCode >= 100 && statusCode <= 199 && statusCode != http.StatusSwitchingProtocols {
+		rwi.dest.WriteHeader(statusCode)
+		return
+	}
+
+	if !rwi.wroteHeader {
+		rwi.statusCode = statusCode
+		rwi.commit()
+	}
+
 	rwi.dest.WriteHeader(statusCode)
 }
+
+func (rwi *responseWriterIntercept) Flush() {
+	if !rwi.wroteHeader {
+		rwi.commit()
+	}
+
+	if flusher, ok := rwi.dest.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Push passes HTTP/2 server pushes through to the underlying writer. Pushed
+// responses aren't cached, so replays don't repeat them.
+func (rwi *responseWriterIntercept) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := rwi.dest.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+
+	return http.ErrNotSupported
+}
+
+func (rwi *responseWriterIntercept) Unwrap() http.ResponseWriter {
+	return rwi.dest
+}
+
+func (rwi *responseWriterIntercept) commit() {
+	rwi.wroteHeader = true
+	rwi.header = rwi.Header().Clone()
+
+	if rwi.isStreaming != nil && rwi.isStreaming(rwi.Header()) {
+		rwi.streaming = true
+		rwi.buf.Reset()
+
+		return
+	}
+
+	if rwi.onCommit != nil {
+		rwi.onCommit()
+	}
+}
+
+// split separates the handler's response headers, as sent, from its
+// trailers, which are either declared in the Trailer header or set with
+// http.TrailerPrefix after the body.
+func (rwi *responseWriterIntercept) split() (http.Header, http.Header) {
+	header := http.Header{}
+	trailer := http.Header{}
+
+	sent := rwi.header
+	if sent == nil {
+		sent = rwi.Header()
+	}
+
+	declared := map[string]bool{}
+
+	for _, vals := range sent.Values("Trailer") {
+		for _, name := range strings.Split(vals, ",") {
+			declared[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+		}
+	}
+
+	for key, vals := range sent {
+		if key != "Trailer" && !declared[key] && !strings.HasPrefix(key, http.TrailerPrefix) {
+			header[key] = append([]string(nil), vals...)
+		}
+	}
+
+	for key, vals := range rwi.Header() {
+		switch {
+		case strings.HasPrefix(key, http.TrailerPrefix):
+			trailer[http.CanonicalHeaderKey(strings.TrimPrefix(key, http.TrailerPrefix))] = append([]string(nil), vals...)
+		case declared[key]:
+			trailer[key] = append([]string(nil), vals...)
+		}
+	}
+
+	return header, trailer
+}
@@ -0,0 +1,225 @@
+package potency_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+type headerOnWriteHeader struct {
+	http.ResponseWriter
+}
+
+func (w headerOnWriteHeader) WriteHeader(statusCode int) {
+	w.Header().Set("X-Inner", "1")
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func TestHeaderSnapshot(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+
+		// Too late to reach the client
+		w.Header().Set("X-Late", "1")
+
+		_, _ = w.Write([]byte(uniuri.New()))
+	})
+
+	// Middleware between potency and the handler that adds a header as the
+	// status is written
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(headerOnWriteHeader{w}, r)
+	})
+
+	p := potency.NewPotency(inner)
+
+	// Middleware outside potency that changes headers after the fact
+	outer := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.ServeHTTP(w, r)
+		w.Header().Set("X-Outer", "1")
+	})
+
+	srv := httptest.NewServer(outer)
+	defer srv.Close()
+
+	key := uniuri.New()
+
+	post := func() *http.Response {
+		req, err := http.NewRequest(http.MethodPost, srv.URL, nil)
+		require.NoError(t, err)
+
+		req.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+		resp, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		return resp
+	}
+
+	for _, resp := range []*http.Response{post(), post()} {
+		require.Equal(t, "1", resp.Header.Get("X-Inner"))
+		require.Empty(t, resp.Header.Get("X-Late"))
+		require.Empty(t, resp.Header.Get("X-Outer"))
+	}
+
+	require.Equal(t, "true", post().Header.Get(potency.ReplayedHeader))
+}
+
+func TestEffectiveHeaders(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/suppressed":
+			w.Header()["Content-Type"] = nil
+
+		case "/cookies":
+			w.Header().Add("Set-Cookie", "a=1")
+			w.Header().Add("Set-Cookie", "b=2")
+		}
+
+		_, _ = w.Write([]byte("<html><body>" + uniuri.New() + "</body></html>"))
+	})
+
+	p := potency.NewPotency(handler)
+
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	post := func(path, key string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+path, nil)
+		require.NoError(t, err)
+
+		req.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+		resp, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+
+		return resp
+	}
+
+	for _, tc := range []struct {
+		path        string
+		contentType []string
+		cookies     []string
+	}{
+		{"/", []string{"text/html; charset=utf-8"}, nil},
+		{"/suppressed", nil, nil},
+		{"/cookies", []string{"text/html; charset=utf-8"}, []string{"a=1", "b=2"}},
+	} {
+		key := uniuri.New()
+
+		for i := 0; i < 2; i++ {
+			resp := post(tc.path, key)
+			require.Equal(t, tc.contentType, resp.Header.Values("Content-Type"), tc.path)
+			require.Equal(t, tc.cookies, resp.Header.Values("Set-Cookie"), tc.path)
+		}
+
+		sr, err := p.Lookup(context.Background(), key)
+		require.NoError(t, err)
+		require.Equal(t, tc.contentType, sr.ResponseHeader.Values("Content-Type"), tc.path)
+	}
+}
+
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (w *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	w.pushed = append(w.pushed, target)
+	return nil
+}
+
+func TestPush(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pusher, ok := w.(http.Pusher)
+		require.True(t, ok)
+
+		err := pusher.Push("/style.css", nil)
+		if r.URL.Path == "/unsupported" {
+			require.ErrorIs(t, err, http.ErrNotSupported)
+		} else {
+			require.NoError(t, err)
+		}
+
+		_, _ = w.Write([]byte(uniuri.New()))
+	})
+
+	p := potency.NewPotency(handler)
+
+	key := uniuri.New()
+
+	send := func(w http.ResponseWriter, path string) {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+		p.ServeHTTP(w, req)
+	}
+
+	w1 := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	send(w1, "/")
+	require.Equal(t, []string{"/style.css"}, w1.pushed)
+
+	// Replays don't push
+	w2 := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	send(w2, "/")
+	require.Equal(t, w1.Body.String(), w2.Body.String())
+	require.Empty(t, w2.pushed)
+
+	key = uniuri.New()
+	send(httptest.NewRecorder(), "/unsupported")
+}
+
+func TestInterceptReuse(t *testing.T) {
+	t.Parallel()
+
+	// Alternate responses above and below the pooled buffer limit, so
+	// buffers are both reused and dropped
+	sizes := []int{10, 100 * 1024, 1, 32 * 1024, 0, 200 * 1024, 5}
+
+	p := potency.NewPotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("X-Body")))
+	}))
+
+	bodies := map[string]string{}
+
+	post := func(key string) string {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Idempotency-Key", `"`+key+`"`)
+		req.Header.Set("X-Body", bodies[key])
+
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		return rec.Body.String()
+	}
+
+	for i := 0; i < 3; i++ {
+		for _, size := range sizes {
+			key := uniuri.New()
+			bodies[key] = uniuri.NewLen(size)
+
+			require.Equal(t, bodies[key], post(key))
+		}
+	}
+
+	for key, body := range bodies {
+		require.Equal(t, body, post(key))
+	}
+
+	require.NoError(t, p.Shutdown(context.Background()))
+}
@@ -0,0 +1,42 @@
+package potency
+
+import "strings"
+
+// Retention ranks entries for eviction when the cache is over its byte
+// budget (see WithMaxBytes): low-retention entries go first, oldest first,
+// then normal, then high. Expiry is unaffected.
+type Retention int
+
+const (
+	RetentionNormal Retention = iota
+	RetentionLow
+	RetentionHigh
+)
+
+// evictionOrder lists retention classes from first to last evicted.
+var evictionOrder = []Retention{RetentionLow, RetentionNormal, RetentionHigh}
+
+// RetentionFunc classifies a result as it is cached.
+type RetentionFunc func(*SavedResult) Retention
+
+// WithRetention replaces the default classification, which reads a
+// "retention=low" or "retention=high" directive from the ControlHeader of
+// the response, e.g. to keep payment results longest.
+func WithRetention(classify RetentionFunc) Option {
+	return func(cfg *config) {
+		cfg.retention = classify
+	}
+}
+
+func controlRetention(sr *SavedResult) Retention {
+	val, _ := directiveValue(sr.ResponseHeader, ControlHeader, "retention")
+
+	switch strings.ToLower(val) {
+	case "low":
+		return RetentionLow
+	case "high":
+		return RetentionHigh
+	default:
+		return RetentionNormal
+	}
+}
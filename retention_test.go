@@ -0,0 +1,75 @@
+package potency_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetention(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithMaxBytes(1000))
+	defer ts.shutdown(t)
+
+	entry := func(retention string) *potency.SavedResult {
+		header := http.Header{}
+		if retention != "" {
+			header.Set(potency.ControlHeader, "retention="+retention)
+		}
+
+		return &potency.SavedResult{
+			Key:            uniuri.New(),
+			StatusCode:     http.StatusOK,
+			ResponseHeader: header,
+		}
+	}
+
+	high := entry("high")
+	low := entry("low")
+	normal1 := entry("")
+	normal2 := entry("")
+	normal3 := entry("")
+
+	ts.pot.Preload([]*potency.SavedResult{high, low, normal1})
+	require.Equal(t, 3, ts.pot.NumCached())
+
+	ts.pot.Preload([]*potency.SavedResult{normal2})
+	require.Nil(t, mustLookup(t, ts.pot, low.Key))
+	require.NotNil(t, mustLookup(t, ts.pot, high.Key))
+	require.NotNil(t, mustLookup(t, ts.pot, normal1.Key))
+
+	ts.pot.Preload([]*potency.SavedResult{normal3})
+	require.NotNil(t, mustLookup(t, ts.pot, high.Key))
+	require.Nil(t, mustLookup(t, ts.pot, normal1.Key))
+	require.NotNil(t, mustLookup(t, ts.pot, normal3.Key))
+}
+
+func TestRetentionFunc(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t,
+		potency.WithMaxBytes(1000),
+		potency.WithRetention(func(sr *potency.SavedResult) potency.Retention {
+			if strings.HasPrefix(sr.URL, "/payments") {
+				return potency.RetentionHigh
+			}
+
+			return potency.RetentionNormal
+		}),
+	)
+	defer ts.shutdown(t)
+
+	payment := &potency.SavedResult{Key: uniuri.New(), URL: "/payments/1"}
+	ts.pot.Preload([]*potency.SavedResult{payment})
+
+	for i := 0; i < 5; i++ {
+		ts.pot.Preload([]*potency.SavedResult{{Key: uniuri.New(), URL: "/search"}})
+	}
+
+	require.NotNil(t, mustLookup(t, ts.pot, payment.Key))
+}
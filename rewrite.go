@@ -0,0 +1,42 @@
+package potency
+
+import (
+	"net/http"
+	"net/textproto"
+)
+
+// HeaderRewriter returns the value to replay for a saved response header
+// (e.g. Location), given the retrying request. Returning "" removes the
+// header.
+type HeaderRewriter func(r *http.Request, saved *SavedResult, value string) string
+
+// WithReplayHeaderRewriter rewrites header on replay, e.g. to strip
+// per-request tokens from the Location of a cached redirect. It is only
+// called when the saved response has the header.
+func WithReplayHeaderRewriter(header string, rewriter HeaderRewriter) Option {
+	return func(cfg *config) {
+		rewriters := map[string]HeaderRewriter{}
+
+		for k, v := range cfg.headerRewriters {
+			rewriters[k] = v
+		}
+
+		rewriters[textproto.CanonicalMIMEHeaderKey(header)] = rewriter
+		cfg.headerRewriters = rewriters
+	}
+}
+
+func (cfg *config) rewriteHeaders(header http.Header, r *http.Request, saved *SavedResult) {
+	for name, rewriter := range cfg.headerRewriters {
+		val := header.Get(name)
+		if val == "" {
+			continue
+		}
+
+		if val = rewriter(r, saved, val); val == "" {
+			header.Del(name)
+		} else {
+			header.Set(name, val)
+		}
+	}
+}
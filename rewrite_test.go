@@ -0,0 +1,93 @@
+package potency_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirect(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/orders":
+				w.Header().Set("Location", "https://example.com/orders/"+uniuri.New()+"?token="+uniuri.New())
+				w.Header().Set("Content-Location", "/orders/latest")
+				w.WriteHeader(http.StatusSeeOther)
+
+			case "/moved":
+				http.Redirect(w, r, "/new", http.StatusPermanentRedirect)
+			}
+		}),
+		potency.WithReplayHeaderRewriter("location", func(r *http.Request, saved *potency.SavedResult, value string) string {
+			u, err := url.Parse(value)
+			if err != nil {
+				return ""
+			}
+
+			u.RawQuery = ""
+
+			return u.String()
+		}),
+	)
+
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	defer client.CloseIdleConnections()
+
+	do := func(path, key string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+path, nil)
+		require.NoError(t, err)
+
+		req.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return resp, string(body)
+	}
+
+	key1 := uniuri.New()
+
+	resp, _ := do("/orders", key1)
+	require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+
+	location1, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	require.NotEmpty(t, location1.RawQuery)
+
+	resp, _ = do("/orders", key1)
+	require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	require.Equal(t, "true", resp.Header.Get(potency.ReplayedHeader))
+	require.Equal(t, "https://example.com"+location1.Path, resp.Header.Get("Location"))
+	require.Equal(t, "/orders/latest", resp.Header.Get("Content-Location"))
+
+	// Relative redirects without a query replay unchanged
+	key2 := uniuri.New()
+
+	resp, body1 := do("/moved", key2)
+	require.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+
+	resp, body := do("/moved", key2)
+	require.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+	require.Equal(t, "true", resp.Header.Get(potency.ReplayedHeader))
+	require.Equal(t, "/new", resp.Header.Get("Location"))
+	require.Equal(t, body1, body)
+}
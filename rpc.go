@@ -0,0 +1,66 @@
+package potency
+
+import "net/http"
+
+// The methods below let integrations outside the HTTP middleware (e.g.
+// potencygrpc and potencyconnect) apply the same checks to RPCs, described
+// as HTTP requests: the RPC's method name as the URL path and its metadata
+// as headers.
+
+// Key returns r's idempotency key as the middleware would: parsed by the
+// KeyExtractor (see WithKeyExtractor), checked against the key policy (see
+// WithKeyPolicy) and scoped by principal (see WithPrincipalScope). It
+// returns "" if r carries no key, and an *InvalidKeyError for a malformed or
+// weak one.
+func (p *Potency) Key(r *http.Request) (string, error) {
+	cfg := p.config().forMethod(r.Method)
+
+	key, err := cfg.keyExtractor(r)
+	if err != nil || key == "" {
+		return "", err
+	}
+
+	return cfg.prepareKey(r, key)
+}
+
+// ScopeKey checks key, which the caller took from r itself, against the key
+// policy and scopes it by principal, as Key does.
+func (p *Potency) ScopeKey(r *http.Request, key string) (string, error) {
+	cfg := p.config().forMethod(r.Method)
+
+	return cfg.prepareKey(r, key)
+}
+
+// Identify records r's method, URL, identity headers (see
+// WithIdentityHeaders) and principal in sr, as the middleware saves them, for
+// CheckReplay.
+func (p *Potency) Identify(r *http.Request, sr *SavedResult) {
+	cfg := p.config().forMethod(r.Method)
+
+	cfg.identify(r, sr)
+}
+
+// CheckReplay returns an error if r may not be served saved, as the
+// middleware decides before a replay: the replay authorizer (see
+// WithReplayAuthorizer) must allow it, and r's method, URL and identity
+// headers must match those recorded by Identify. Bodies aren't compared.
+// Mismatches wrap ErrMismatch.
+func (p *Potency) CheckReplay(r *http.Request, saved *SavedResult) error {
+	cfg := p.config().forMethod(r.Method)
+
+	err := cfg.authorizeReplay(r, saved)
+	if err != nil {
+		return err
+	}
+
+	return cfg.checkIdentity(r, saved)
+}
+
+func (cfg *config) prepareKey(r *http.Request, key string) (string, error) {
+	err := cfg.checkKeyPolicy(key)
+	if err != nil {
+		return "", err
+	}
+
+	return cfg.scopedKey(r, key), nil
+}
@@ -0,0 +1,50 @@
+package potency
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// ClientCertPrincipal identifies the caller by the verified mTLS client
+// certificate: its SPIFFE ID (a spiffe:// URI SAN) if present, otherwise its
+// subject DN. Use it with WithPrincipalScope. Requests without a client
+// certificate have the empty principal.
+func ClientCertPrincipal(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+
+	cert := r.TLS.PeerCertificates[0]
+
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri.String()
+		}
+	}
+
+	return cert.Subject.String()
+}
+
+// WithPrincipalScope scopes idempotency keys by the principal (e.g. the
+// token's sub claim or an API key ID), so callers can't see each other's
+// results, and drops Authorization from the identity headers so retries with
+// a refreshed token still match. It also sets the principal used in audit
+// events.
+func WithPrincipalScope(principal PrincipalFunc) Option {
+	return func(cfg *config) {
+		cfg.principal = principal
+		cfg.scopeByPrincipal = true
+	}
+}
+
+// scopedKey returns the key under which r's result is stored.
+func (cfg *config) scopedKey(r *http.Request, key string) string {
+	if !cfg.scopeByPrincipal {
+		return key
+	}
+
+	principal := cfg.principalOf(r)
+
+	// Length prefix so principals containing the separator can't collide
+	return strconv.Itoa(len(principal)) + ":" + principal + ":" + key
+}
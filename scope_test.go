@@ -0,0 +1,85 @@
+package potency_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrincipalScope(t *testing.T) {
+	t.Parallel()
+
+	// Tokens look like "Bearer <principal>.<nonce>"
+	ts := newTestServer(t, potency.WithPrincipalScope(func(r *http.Request) string {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		return strings.Split(token, ".")[0]
+	}))
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("Authorization", "Bearer alice.1").
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	// Rotated token for the same principal replays
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("Authorization", "Bearer alice.2").
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, "true", resp.Header().Get(potency.ReplayedHeader))
+	require.Equal(t, resp1, resp.String())
+
+	// Another principal reusing the key gets its own execution
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetHeader("Authorization", "Bearer bob.1").
+		SetBody("test2").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Empty(t, resp.Header().Get(potency.ReplayedHeader))
+	require.NotEqual(t, resp1, resp.String())
+
+	require.Equal(t, 2, ts.pot.NumCached())
+}
+
+func TestClientCertPrincipal(t *testing.T) {
+	t.Parallel()
+
+	r, err := http.NewRequest(http.MethodPost, "/", nil)
+	require.NoError(t, err)
+
+	require.Empty(t, potency.ClientCertPrincipal(r))
+
+	cert := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "client1", Organization: []string{"Acme"}},
+	}
+
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	require.Equal(t, "CN=client1,O=Acme", potency.ClientCertPrincipal(r))
+
+	cert.URIs = []*url.URL{
+		{Scheme: "https", Host: "example.com"},
+		{Scheme: "spiffe", Host: "example.org", Path: "/ns/prod/sa/billing"},
+	}
+	require.Equal(t, "spiffe://example.org/ns/prod/sa/billing", potency.ClientCertPrincipal(r))
+}
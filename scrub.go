@@ -0,0 +1,57 @@
+package potency
+
+import (
+	"net/http"
+)
+
+// WithScrubbedHeaders replaces the response headers (default Set-Cookie and
+// WWW-Authenticate) that are kept out of everything that leaves the process:
+// the store, replication, PeerHandler, Export, the snapshotter and the
+// Subscribe feed. A compromised store or peer link then doesn't leak session
+// cookies. Replays from the local cache still include them; replays of
+// results loaded from the store, a replica or a peer don't. Trailers of the
+// same names are scrubbed too.
+func WithScrubbedHeaders(names ...string) Option {
+	return func(cfg *config) {
+		cfg.scrubbedHeaders = names
+	}
+}
+
+// scrub returns sr without the scrubbed headers, for leaving the process.
+// sr itself is unchanged, and may be cached: only its exported fields are
+// read.
+func (cfg *config) scrub(sr *SavedResult) *SavedResult {
+	if !hasAny(sr.ResponseHeader, cfg.scrubbedHeaders) && !hasAny(sr.ResponseTrailer, cfg.scrubbedHeaders) {
+		return sr
+	}
+
+	scrubbed := sr.withKey(sr.Key)
+	scrubbed.ResponseHeader = without(sr.ResponseHeader, cfg.scrubbedHeaders)
+	scrubbed.ResponseTrailer = without(sr.ResponseTrailer, cfg.scrubbedHeaders)
+
+	return scrubbed
+}
+
+func hasAny(header http.Header, names []string) bool {
+	for _, name := range names {
+		if _, found := header[http.CanonicalHeaderKey(name)]; found {
+			return true
+		}
+	}
+
+	return false
+}
+
+func without(header http.Header, names []string) http.Header {
+	if header == nil {
+		return nil
+	}
+
+	header = header.Clone()
+
+	for _, name := range names {
+		header.Del(name)
+	}
+
+	return header
+}
@@ -0,0 +1,124 @@
+package potency_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrubbedHeaders(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: uniuri.New()})
+		w.Header().Set("X-Kept", "1")
+		_, _ = w.Write([]byte(uniuri.New()))
+	})
+
+	for _, test := range []struct {
+		opts   []potency.Option
+		stored bool
+	}{
+		{nil, false},
+		{[]potency.Option{potency.WithScrubbedHeaders()}, true},
+	} {
+		store := newTestStore()
+		p := potency.NewPotency(handler, append(test.opts, potency.WithStore(store))...)
+
+		key := uniuri.New()
+
+		send := func(p *potency.Potency) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, req)
+
+			return rec
+		}
+
+		rec1 := send(p)
+		cookie := rec1.Header().Get("Set-Cookie")
+		require.NotEmpty(t, cookie)
+
+		// The local cache keeps the cookie
+		rec2 := send(p)
+		require.Equal(t, cookie, rec2.Header().Get("Set-Cookie"))
+
+		stored, err := store.Get(context.Background(), key)
+		require.NoError(t, err)
+		require.Equal(t, "1", stored.ResponseHeader.Get("X-Kept"))
+
+		// Another instance replays from the store
+		rec3 := send(potency.NewPotency(handler, potency.WithStore(store)))
+		require.Equal(t, rec1.Body.String(), rec3.Body.String())
+
+		if test.stored {
+			require.Equal(t, cookie, stored.ResponseHeader.Get("Set-Cookie"))
+			require.Equal(t, cookie, rec3.Header().Get("Set-Cookie"))
+		} else {
+			require.Empty(t, stored.ResponseHeader.Values("Set-Cookie"))
+			require.Empty(t, rec3.Header().Values("Set-Cookie"))
+		}
+	}
+}
+
+func TestScrubbedHeadersLeaveProcess(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: uniuri.New()})
+		w.Header().Set("X-Kept", "1")
+		_, _ = w.Write([]byte(uniuri.New()))
+	})
+
+	p := potency.NewPotency(handler)
+
+	key := uniuri.New()
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	require.NotEmpty(t, rec.Header().Get("Set-Cookie"))
+
+	// Peers
+	req = httptest.NewRequest(http.MethodGet, potency.PeerPath+key, nil)
+	req.Header.Set(potency.PeerSecretHeader, testPeerSecret)
+
+	rec = httptest.NewRecorder()
+	p.PeerHandler(testPeerSecret).ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	fetched, err := potency.Unmarshal(rec.Body.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, "1", fetched.ResponseHeader.Get("X-Kept"))
+	require.Empty(t, fetched.ResponseHeader.Values("Set-Cookie"))
+
+	// Export
+	buf := &bytes.Buffer{}
+	require.NoError(t, p.Export(buf))
+	require.Contains(t, buf.String(), "X-Kept")
+	require.NotContains(t, buf.String(), "session=")
+
+	// Subscribe
+	events, cancel := p.Subscribe(10)
+	defer cancel()
+
+	p.SetLifetime(time.Nanosecond)
+
+	ev := <-events
+	require.Equal(t, potency.EventEvict, ev.Op)
+	require.Equal(t, "1", ev.Result.ResponseHeader.Get("X-Kept"))
+	require.Empty(t, ev.Result.ResponseHeader.Values("Set-Cookie"))
+
+	require.NoError(t, p.Shutdown(context.Background()))
+}
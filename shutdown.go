@@ -0,0 +1,86 @@
+package potency
+
+import (
+	"context"
+)
+
+// SetSnapshotter registers a function called by Shutdown with the final
+// cache contents, e.g. to persist them for the next process.
+func (p *Potency) SetSnapshotter(snapshotter func(context.Context, []*SavedResult) error) {
+	p.cacheMu.Lock()
+	defer p.cacheMu.Unlock()
+
+	p.snapshotter = snapshotter
+}
+
+// Shutdown stops new idempotent executions (they receive 503), waits for
+// in-progress executions to finish and be stored, saves results queued by
+// WithAsyncWrites, stops background work and change feeds, then calls the
+// snapshotter if one is set. Replays of cached results continue to be served.
+func (p *Potency) Shutdown(ctx context.Context) error {
+	p.inProgressMu.Lock()
+	p.shuttingDown = true
+	p.inProgressMu.Unlock()
+
+	for {
+		waits := p.inProgressWaits()
+		if len(waits) == 0 {
+			break
+		}
+
+		for _, wait := range waits {
+			select {
+			case <-wait:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	p.stopOnce.Do(func() { close(p.stop) })
+	p.background.Wait()
+	p.closeSubscribers()
+
+	p.cacheMu.RLock()
+	snapshotter := p.snapshotter
+	p.cacheMu.RUnlock()
+
+	if snapshotter == nil {
+		return nil
+	}
+
+	return snapshotter(ctx, p.snapshot())
+}
+
+func (p *Potency) inProgressWaits() []<-chan struct{} {
+	p.inProgressMu.Lock()
+	defer p.inProgressMu.Unlock()
+
+	waits := []<-chan struct{}{}
+
+	for _, exec := range p.inProgress {
+		waits = append(waits, exec.done)
+	}
+
+	return waits
+}
+
+func (p *Potency) snapshot() []*SavedResult {
+	p.cacheMu.RLock()
+	defer p.cacheMu.RUnlock()
+
+	ret := []*SavedResult{}
+
+	for iter := p.cacheOldest; iter != nil; iter = iter.newer {
+		if p.cache[iter.Key] != iter {
+			continue
+		}
+
+		sr, err := p.unpackLocked(iter)
+		if err == nil {
+			ret = append(ret, p.cfg.scrub(sr))
+		}
+	}
+
+	return ret
+}
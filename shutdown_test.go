@@ -0,0 +1,65 @@
+package potency_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdown(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	snapshot := []*potency.SavedResult{}
+
+	ts.pot.SetSnapshotter(func(ctx context.Context, results []*potency.SavedResult) error {
+		snapshot = results
+		return nil
+	})
+
+	key1 := uniuri.New()
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+			Post("slow")
+		require.NoError(t, err)
+		require.False(t, resp.IsError())
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	err := ts.pot.Shutdown(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, snapshot, 1)
+	require.Equal(t, key1, snapshot[0].Key)
+
+	wg.Wait()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Post("slow")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).
+		Post("slow")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+}
@@ -0,0 +1,86 @@
+package potency
+
+import "net/http"
+
+// entryOverhead approximates the fixed cost of a SavedResult and its index
+// entries beyond the variable-length fields counted by sizeOf.
+const entryOverhead = 256
+
+// WithMaxBytes evicts the oldest entries (see WithEvictionPolicy) while the
+// approximate size of the cache (see SizeBytes) exceeds n.
+func WithMaxBytes(n int64) Option {
+	return func(cfg *config) {
+		cfg.maxBytes = n
+	}
+}
+
+// SizeBytes returns the approximate memory used by cached entries: keys,
+// request identity, headers, bodies and trailers.
+func (p *Potency) SizeBytes() int64 {
+	p.cacheMu.RLock()
+	defer p.cacheMu.RUnlock()
+
+	return p.sizeBytes
+}
+
+func sizeOf(sr *SavedResult) int64 {
+	return int64(entryOverhead +
+		len(sr.Key) +
+		len(sr.Method) +
+		len(sr.URL) +
+		headerSize(sr.RequestHeader) +
+		len(sr.BodyHash) +
+		len(sr.RequestDigest) +
+		headerSize(sr.ResponseHeader) +
+		len(sr.ResponseBody) +
+		len(sr.packed) +
+		headerSize(sr.ResponseTrailer) +
+		len(sr.Principal) +
+		len(sr.RequestID) +
+		len(sr.ClientIP) +
+		len(sr.UserAgent))
+}
+
+func headerSize(h http.Header) int {
+	size := 0
+
+	for name, vals := range h {
+		size += len(name)
+
+		for _, val := range vals {
+			size += len(val)
+		}
+	}
+
+	return size
+}
+
+// enforceMaxBytes evicts while over the byte budget, by retention class and
+// then from the oldest end. Requires cacheMu.
+func (p *Potency) enforceMaxBytes() {
+	if p.cfg.maxBytes <= 0 {
+		return
+	}
+
+	for _, retention := range evictionOrder {
+		if p.cfg.evictionPolicy == EvictionLRU {
+			p.evictLeastRecentlyUsed(retention)
+			continue
+		}
+
+		for iter := p.cacheOldest; iter != nil && p.sizeBytes > p.cfg.maxBytes; iter = iter.newer {
+			if iter.retention == retention && p.cache[iter.Key] == iter {
+				p.deleteLocked(iter, EvictCapacity)
+			}
+		}
+	}
+
+	// Entries evicted from the middle stay linked until they reach the front.
+	for p.cacheOldest != nil && p.cache[p.cacheOldest.Key] != p.cacheOldest {
+		p.cacheOldest = p.cacheOldest.newer
+	}
+
+	if p.cacheOldest == nil {
+		p.cacheNewest = nil
+	}
+}
@@ -0,0 +1,62 @@
+package potency_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizeBytes(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	require.Equal(t, int64(0), ts.pot.SizeBytes())
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	size1 := ts.pot.SizeBytes()
+	require.Greater(t, size1, int64(len(resp.Body())))
+
+	require.NoError(t, ts.pot.Invalidate(context.Background(), key1))
+	require.Equal(t, int64(0), ts.pot.SizeBytes())
+}
+
+func TestMaxBytes(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithMaxBytes(1500))
+	defer ts.shutdown(t)
+
+	keys := []string{}
+
+	for i := 0; i < 10; i++ {
+		key := uniuri.New()
+		keys = append(keys, key)
+
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key)).
+			Post("")
+		require.NoError(t, err)
+		require.False(t, resp.IsError())
+
+		require.LessOrEqual(t, ts.pot.SizeBytes(), int64(1500))
+	}
+
+	require.Less(t, ts.pot.NumCached(), 10)
+	require.Greater(t, ts.pot.NumCached(), 0)
+	require.Nil(t, mustLookup(t, ts.pot, keys[0]))
+	require.NotNil(t, mustLookup(t, ts.pot, keys[9]))
+}
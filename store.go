@@ -0,0 +1,157 @@
+package potency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Store persists saved results outside the process (e.g. Redis or SQL) so
+// they survive restarts and are shared between instances. The in-memory cache
+// is consulted first; the store is read on a miss and written on every save.
+// Get returns nil, nil for a missing key.
+//
+// A Put that fails after an HTTP handler has run leaves the result in the
+// local cache only.
+type Store interface {
+	Get(ctx context.Context, key string) (*SavedResult, error)
+	Put(ctx context.Context, sr *SavedResult) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Purger is implemented by stores that can delete by predicate, for
+// InvalidateWhere. DeleteWhere returns how many entries it deleted.
+type Purger interface {
+	DeleteWhere(ctx context.Context, match func(*SavedResult) bool) (int, error)
+}
+
+var ErrStore = errors.New("store operation failed")
+
+func WithStore(store Store) Option {
+	return func(cfg *config) {
+		cfg.store = store
+	}
+}
+
+// WithFailOpen passes requests straight to the handler, without idempotency
+// handling, when the store or owning peer can't be read. By default such
+// requests get 503 so that a store outage can't cause duplicate execution.
+func WithFailOpen(enabled bool) Option {
+	return func(cfg *config) {
+		cfg.failOpen = enabled
+	}
+}
+
+// WithReadTimeout bounds each store Get and peer fetch (default 1s).
+func WithReadTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.readTimeout = d
+	}
+}
+
+// WithWriteTimeout bounds each store Put and Delete (default 5s).
+func WithWriteTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.writeTimeout = d
+	}
+}
+
+// lookup finds key in the local cache, then the async write queue, then the
+// owning peer, then the store. Remote results are cached locally.
+func (p *Potency) lookup(ctx context.Context, key string, cfg config) (*SavedResult, error) {
+	if sr := p.read(key); sr != nil {
+		return sr, nil
+	}
+
+	if sr := p.readPending(key); sr != nil {
+		return sr, nil
+	}
+
+	ctx, cancel := withTimeout(ctx, cfg.readTimeout)
+	defer cancel()
+
+	sr, peerErr := p.fetchFromPeer(ctx, key)
+	if sr != nil {
+		return sr, nil
+	}
+
+	// The owning peer may hold a result the store doesn't have yet (e.g.
+	// WithAsyncWrites), so a miss only counts if the peer answered
+	if cfg.store == nil {
+		return nil, peerErr
+	}
+
+	sr, err := cfg.store.Get(ctx, cfg.storeKey(key))
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %s (%w)", key, err, ErrStore)
+	}
+
+	if sr == nil || sr.Key != cfg.storeKey(key) {
+		return nil, peerErr
+	}
+
+	sr = cfg.fromStore(sr)
+
+	if p.expired(sr) {
+		p.expiredInStore(sr)
+		return nil, peerErr
+	}
+
+	p.insert(sr)
+
+	return sr, nil
+}
+
+func (p *Potency) storePut(ctx context.Context, sr *SavedResult, cfg config) error {
+	if cfg.store == nil {
+		return nil
+	}
+
+	ctx, cancel := withTimeout(ctx, cfg.writeTimeout)
+	defer cancel()
+
+	err := cfg.store.Put(ctx, cfg.toStore(sr))
+	if err != nil {
+		return fmt.Errorf("put %s: %s (%w)", sr.Key, err, ErrStore)
+	}
+
+	return nil
+}
+
+func (p *Potency) storeDelete(ctx context.Context, key string, cfg config) error {
+	if cfg.store == nil {
+		return nil
+	}
+
+	ctx, cancel := withTimeout(ctx, cfg.writeTimeout)
+	defer cancel()
+
+	err := cfg.store.Delete(ctx, cfg.storeKey(key))
+	if err != nil {
+		return fmt.Errorf("delete %s: %s (%w)", key, err, ErrStore)
+	}
+
+	return nil
+}
+
+func (p *Potency) expired(sr *SavedResult) bool {
+	p.cacheMu.RLock()
+	defer p.cacheMu.RUnlock()
+
+	return p.expiredLocked(sr)
+}
+
+// expiredLocked reports whether sr is past its lifetime or error lifetime.
+// Requires cacheMu.
+func (p *Potency) expiredLocked(sr *SavedResult) bool {
+	return time.Now().After(p.expiresAt(sr)) || p.errorExpired(sr)
+}
+
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, d)
+}
@@ -0,0 +1,191 @@
+package potency_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+type testStore struct {
+	entries map[string][]byte
+	block   bool
+	mu      sync.Mutex
+}
+
+func newTestStore() *testStore {
+	return &testStore{
+		entries: map[string][]byte{},
+	}
+}
+
+func (ts *testStore) Get(ctx context.Context, key string) (*potency.SavedResult, error) {
+	ts.mu.Lock()
+	data := ts.entries[key]
+	block := ts.block
+	ts.mu.Unlock()
+
+	if block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	if data == nil {
+		return nil, nil
+	}
+
+	return potency.Unmarshal(data)
+}
+
+func (ts *testStore) Put(ctx context.Context, sr *potency.SavedResult) error {
+	data, err := sr.Marshal()
+	if err != nil {
+		return err
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.entries[sr.Key] = data
+
+	return nil
+}
+
+func (ts *testStore) Delete(ctx context.Context, key string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	delete(ts.entries, key)
+
+	return nil
+}
+
+func (ts *testStore) len() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return len(ts.entries)
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	store := newTestStore()
+
+	ts1 := newTestServer(t, potency.WithStore(store))
+	defer ts1.shutdown(t)
+
+	ts2 := newTestServer(t, potency.WithStore(store))
+	defer ts2.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts1.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, 1, store.len())
+
+	resp1 := resp.String()
+
+	resp, err = ts2.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, resp1, resp.String())
+	require.Equal(t, 1, ts2.pot.NumCached())
+
+	require.NoError(t, ts2.pot.Invalidate(context.Background(), key1))
+	require.Equal(t, 0, store.len())
+}
+
+func TestStoreReadTimeout(t *testing.T) {
+	t.Parallel()
+
+	store := newTestStore()
+	store.block = true
+
+	ts := newTestServer(t, potency.WithStore(store), potency.WithReadTimeout(50*time.Millisecond))
+	defer ts.shutdown(t)
+
+	start := time.Now()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+	require.Contains(t, resp.String(), potency.ErrStore.Error())
+	require.Less(t, time.Since(start), 1*time.Second)
+
+	_, _, err = ts.pot.Do(context.Background(), uniuri.New(), func(context.Context) (potency.Result, error) {
+		return potency.Result{}, nil
+	})
+	require.ErrorIs(t, err, potency.ErrStore)
+}
+
+type purgingStore struct {
+	*testStore
+}
+
+func (ps purgingStore) DeleteWhere(ctx context.Context, match func(*potency.SavedResult) bool) (int, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	n := 0
+
+	for key, data := range ps.entries {
+		sr, err := potency.Unmarshal(data)
+		if err != nil {
+			return n, err
+		}
+
+		if match(sr) {
+			delete(ps.entries, key)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func TestStorePurger(t *testing.T) {
+	t.Parallel()
+
+	store := purgingStore{newTestStore()}
+
+	// Only in the store, not in the local cache
+	require.NoError(t, store.Put(context.Background(), &potency.SavedResult{
+		Key: uniuri.New(),
+		URL: "/orders/1",
+	}))
+
+	ts := newTestServer(t, potency.WithStore(store))
+	defer ts.shutdown(t)
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).
+		Post("orders/2")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, 2, store.len())
+
+	n, err := ts.pot.InvalidateWhere(context.Background(), func(sr *potency.SavedResult) bool {
+		return strings.HasPrefix(sr.URL, "/orders/")
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, 0, store.len())
+}
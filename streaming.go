@@ -0,0 +1,64 @@
+package potency
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// StreamingDetector reports whether an exchange is a stream that must not be
+// buffered or cached. It is called before the handler runs with a nil
+// responseHeader, and again when the handler commits its response headers.
+type StreamingDetector func(r *http.Request, responseHeader http.Header) bool
+
+// WithStreamingContentTypes replaces the media types (default
+// text/event-stream) that bypass caching when requested via Accept or sent
+// as the response Content-Type.
+func WithStreamingContentTypes(types ...string) Option {
+	return func(cfg *config) {
+		cfg.streamingContentTypes = types
+	}
+}
+
+func WithStreamingDetector(detector StreamingDetector) Option {
+	return func(cfg *config) {
+		cfg.streamingDetectors = append(cfg.streamingDetectors, detector)
+	}
+}
+
+func (cfg *config) isStreaming(r *http.Request, responseHeader http.Header) bool {
+	if responseHeader == nil {
+		for _, accept := range r.Header.Values("Accept") {
+			for _, typ := range strings.Split(accept, ",") {
+				if cfg.isStreamingContentType(typ) {
+					return true
+				}
+			}
+		}
+	} else if cfg.isStreamingContentType(responseHeader.Get("Content-Type")) {
+		return true
+	}
+
+	for _, detector := range cfg.streamingDetectors {
+		if detector(r, responseHeader) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cfg *config) isStreamingContentType(val string) bool {
+	mediaType, _, err := mime.ParseMediaType(val)
+	if err != nil {
+		return false
+	}
+
+	for _, typ := range cfg.streamingContentTypes {
+		if strings.EqualFold(mediaType, typ) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,70 @@
+package potency_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamingResponse(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	key1 := uniuri.New()
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Get("events")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp1 := resp.String()
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, key1)).
+		Get("events")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.NotEqual(t, resp1, resp.String())
+
+	require.Equal(t, 0, ts.pot.NumCached())
+}
+
+func TestStreamingAccept(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.shutdown(t)
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).
+		SetHeader("Accept", "text/html, text/event-stream;q=0.9").
+		Get("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	require.Equal(t, 0, ts.pot.NumCached())
+}
+
+func TestStreamingDetector(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithStreamingDetector(func(r *http.Request, responseHeader http.Header) bool {
+		return responseHeader != nil && responseHeader.Get("X-Response") == "bar"
+	}))
+	defer ts.shutdown(t)
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).
+		Get("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	require.Equal(t, 0, ts.pot.NumCached())
+}
@@ -0,0 +1,95 @@
+package potency
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+var ErrMalformedResponse = errors.New("malformed response")
+
+// MalformedResponseError describes why WithStrictResponses refused to save a
+// response. It unwraps to ErrMalformedResponse.
+type MalformedResponseError struct {
+	Key        string
+	StatusCode int
+	Reason     string
+}
+
+func (e *MalformedResponseError) Error() string {
+	return fmt.Sprintf("%s: status %d: %s (%s)", e.Key, e.StatusCode, e.Reason, e.Unwrap())
+}
+
+func (e *MalformedResponseError) Unwrap() error {
+	return ErrMalformedResponse
+}
+
+// WithStrictResponses checks each response before saving it and refuses to
+// save one that would replay inconsistently: a non-final status, a body
+// with a status that forbids one (1xx, 204, 304), a Content-Length that
+// disagrees with the body, or a redirect, 401 or 405 missing its required
+// header. The response still reaches the client; onMalformed (if not nil)
+// receives a *MalformedResponseError so handler developers can fix the
+// handler, and retries execute again.
+func WithStrictResponses(onMalformed func(*http.Request, error)) Option {
+	return func(cfg *config) {
+		cfg.strictResponses = true
+		cfg.onMalformed = onMalformed
+	}
+}
+
+// checkResponse returns why a response is malformed, or "".
+func checkResponse(method string, status int, header http.Header, body []byte) string {
+	if status < 200 || status > 599 {
+		return "not a final status"
+	}
+
+	if !bodyAllowedForStatus(status) && len(body) > 0 {
+		return fmt.Sprintf("%d byte body not allowed", len(body))
+	}
+
+	if cl := header.Get("Content-Length"); cl != "" && method != http.MethodHead && header.Get("Transfer-Encoding") == "" {
+		if n, err := strconv.Atoi(cl); err != nil || n != len(body) {
+			return fmt.Sprintf("Content-Length %q but %d byte body", cl, len(body))
+		}
+	}
+
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		if header.Get("Location") == "" {
+			return "redirect without Location"
+		}
+
+	case http.StatusUnauthorized:
+		if header.Get("WWW-Authenticate") == "" {
+			return "missing WWW-Authenticate"
+		}
+
+	case http.StatusMethodNotAllowed:
+		if _, found := header["Allow"]; !found {
+			return "missing Allow"
+		}
+	}
+
+	return ""
+}
+
+// malformed reports whether strict mode refuses to save the response, and
+// tells the handler developer why.
+func (cfg *config) malformed(r *http.Request, key string, status int, header http.Header, body []byte) bool {
+	if !cfg.strictResponses {
+		return false
+	}
+
+	reason := checkResponse(r.Method, status, header, body)
+	if reason == "" {
+		return false
+	}
+
+	if cfg.onMalformed != nil {
+		cfg.onMalformed(r, &MalformedResponseError{Key: key, StatusCode: status, Reason: reason})
+	}
+
+	return true
+}
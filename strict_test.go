@@ -0,0 +1,86 @@
+package potency_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrictResponses(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nocontent":
+			w.WriteHeader(http.StatusNoContent)
+			_, _ = w.Write([]byte("oops"))
+
+		case "/length":
+			w.Header().Set("Content-Length", "100")
+			_, _ = w.Write([]byte("short"))
+
+		case "/redirect":
+			w.WriteHeader(http.StatusFound)
+
+		case "/unauthorized":
+			w.WriteHeader(http.StatusUnauthorized)
+
+		case "/method":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+		case "/created":
+			w.Header().Set("Location", "/orders/1")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(uniuri.New()))
+
+		default:
+			_, _ = w.Write([]byte(uniuri.New()))
+		}
+	})
+
+	var malformed []error
+
+	p := potency.NewPotency(handler, potency.WithStrictResponses(func(r *http.Request, err error) {
+		malformed = append(malformed, err)
+	}))
+
+	send := func(path string) string {
+		key := uniuri.New()
+
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Idempotency-Key", `"`+key+`"`)
+		p.ServeHTTP(httptest.NewRecorder(), req)
+
+		return key
+	}
+
+	for _, path := range []string{"/nocontent", "/length", "/redirect", "/unauthorized", "/method"} {
+		malformed = nil
+
+		key := send(path)
+		require.Nil(t, mustLookup(t, p, key), path)
+		require.Len(t, malformed, 1, path)
+		require.ErrorIs(t, malformed[0], potency.ErrMalformedResponse)
+
+		mre := &potency.MalformedResponseError{}
+		require.ErrorAs(t, malformed[0], &mre)
+		require.Equal(t, key, mre.Key)
+		require.NotEmpty(t, mre.Reason)
+	}
+
+	malformed = nil
+
+	for _, path := range []string{"/", "/created"} {
+		require.NotNil(t, mustLookup(t, p, send(path)), path)
+	}
+
+	require.Empty(t, malformed)
+
+	// Without strict mode, the same response is saved
+	p = potency.NewPotency(handler)
+	require.NotNil(t, mustLookup(t, p, send("/redirect")))
+}
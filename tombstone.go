@@ -0,0 +1,187 @@
+package potency
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gopatchy/jsrest"
+)
+
+var ErrKeyRetired = errors.New("idempotency key recently expired or invalidated")
+
+// ExpiredReuse describes a request whose key matched a result that had
+// already expired.
+type ExpiredReuse struct {
+	Key     string
+	Added   time.Time
+	Expired time.Time
+}
+
+// tombstone remembers a key whose result left the cache.
+type tombstone struct {
+	key    string
+	added  time.Time
+	at     time.Time
+	reason EvictReason
+}
+
+// WithExpiredReuse remembers keys for window after their results expire,
+// and calls onReuse when a request arrives for one of them, e.g. to log it
+// or increment a metric. Such requests still execute as new, but frequent
+// reports mean clients retry beyond the lifetime and it should be raised.
+// onReuse is called with a nil request from Do. Expiry is noticed lazily
+// (see WithOnEvict), so keys are remembered from when it is noticed until
+// window after the result expired.
+func WithExpiredReuse(window time.Duration, onReuse func(*http.Request, ExpiredReuse)) Option {
+	return func(cfg *config) {
+		cfg.tombstoneWindow = window
+		cfg.onExpiredReuse = onReuse
+	}
+}
+
+// WithTombstones refuses requests with status (0 for 410 Gone; 409 is also
+// common) for lifetime after their key's result expired or was
+// invalidated with Invalidate or InvalidateWhere, instead of executing
+// them again. A client retrying just too late, or racing an operator who
+// invalidated a result, gets an error rather than a second execution. Do
+// returns ErrKeyRetired. Tombstones are kept in memory on each instance and
+// replica; with a shared store, an instance that never cached the result
+// only notices its expiry if it is read from the store.
+func WithTombstones(lifetime time.Duration, status int) Option {
+	return func(cfg *config) {
+		cfg.tombstoneLifetime = lifetime
+
+		if status != 0 {
+			cfg.tombstoneStatus = status
+		}
+	}
+}
+
+func (cfg *config) tombstoneKeep() time.Duration {
+	if cfg.tombstoneLifetime > cfg.tombstoneWindow {
+		return cfg.tombstoneLifetime
+	}
+
+	return cfg.tombstoneWindow
+}
+
+// bury records a tombstone for key, whose result (added at added) expired
+// or was invalidated at at. Requires cacheMu.
+func (p *Potency) bury(key string, added, at time.Time, reason EvictReason) {
+	if p.cfg.tombstoneKeep() <= 0 || (reason == EvictManual && p.cfg.tombstoneLifetime <= 0) {
+		return
+	}
+
+	// Error results expire early (see WithErrorLifetime)
+	if now := time.Now(); at.After(now) {
+		at = now
+	}
+
+	ts := &tombstone{
+		key:    key,
+		added:  added,
+		at:     at,
+		reason: reason,
+	}
+
+	p.tombstones[key] = ts
+	p.tombstoneQueue = append(p.tombstoneQueue, ts)
+
+	p.pruneTombstones()
+}
+
+// pruneTombstones drops old tombstones from the front of the queue.
+// Requires cacheMu.
+func (p *Potency) pruneTombstones() {
+	cutoff := time.Now().Add(-p.cfg.tombstoneKeep())
+
+	for len(p.tombstoneQueue) > 0 && p.tombstoneQueue[0].at.Before(cutoff) {
+		ts := p.tombstoneQueue[0]
+
+		if p.tombstones[ts.key] == ts {
+			delete(p.tombstones, ts.key)
+		}
+
+		p.tombstoneQueue[0] = nil
+		p.tombstoneQueue = p.tombstoneQueue[1:]
+	}
+}
+
+// retire removes key like remove and leaves a tombstone for it.
+func (p *Potency) retire(key string) {
+	if p.async != nil {
+		p.async.forget(key)
+	}
+
+	p.cacheMu.Lock()
+	defer p.unlockAndNotify()
+
+	added := time.Time{}
+
+	if sr := p.cache[key]; sr != nil {
+		p.deleteLocked(sr, EvictManual)
+		added = sr.Added
+	}
+
+	p.bury(key, added, time.Now(), EvictManual)
+}
+
+// checkTombstone is called on a miss for key. It refuses the request if key
+// has a tombstone younger than the tombstone lifetime, and otherwise
+// reports reuse of an expired key once.
+func (p *Potency) checkTombstone(r *http.Request, key string, cfg config) error {
+	if cfg.tombstoneKeep() <= 0 {
+		return nil
+	}
+
+	p.cacheMu.Lock()
+
+	ts := p.tombstones[key]
+	age := time.Duration(0)
+
+	if ts != nil {
+		age = time.Since(ts.at)
+
+		if age >= cfg.tombstoneLifetime {
+			delete(p.tombstones, key)
+		}
+	}
+
+	p.cacheMu.Unlock()
+
+	switch {
+	case ts == nil:
+		return nil
+
+	case age < cfg.tombstoneLifetime:
+		err := fmt.Errorf("%s: retired %s ago (%w)", key, age.Round(time.Millisecond), ErrKeyRetired)
+
+		if r == nil {
+			return err
+		}
+
+		return jsrest.SilentJoin(err, jsrest.NewHTTPError(cfg.tombstoneStatus))
+
+	case ts.reason == EvictExpired && age <= cfg.tombstoneWindow && cfg.onExpiredReuse != nil:
+		cfg.onExpiredReuse(r, ExpiredReuse{
+			Key:     key,
+			Added:   ts.added,
+			Expired: ts.at,
+		})
+	}
+
+	return nil
+}
+
+// expiredInStore records a tombstone for sr, which was read from the store
+// after it expired.
+func (p *Potency) expiredInStore(sr *SavedResult) {
+	p.cacheMu.Lock()
+	defer p.cacheMu.Unlock()
+
+	if p.cache[sr.Key] == nil {
+		p.bury(sr.Key, sr.Added, p.expiresAt(sr), EvictExpired)
+	}
+}
@@ -0,0 +1,142 @@
+package potency_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/go-resty/resty/v2"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiredReuse(t *testing.T) {
+	t.Parallel()
+
+	mu := sync.Mutex{}
+	reused := []potency.ExpiredReuse{}
+
+	ts := newTestServer(t,
+		potency.WithLifetime(50*time.Millisecond),
+		potency.WithExpiredReuse(time.Hour, func(r *http.Request, reuse potency.ExpiredReuse) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			reused = append(reused, reuse)
+		}),
+	)
+	defer ts.shutdown(t)
+
+	post := func(key string) string {
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", `"`+key+`"`).
+			Post("/")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode())
+
+		return resp.String()
+	}
+
+	key1 := uniuri.New()
+	key2 := uniuri.New()
+
+	body1 := post(key1)
+	post(key2)
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Noticed on read
+	require.NotEqual(t, body1, post(key1))
+
+	// Swept by the write above, then reused
+	post(key2)
+
+	// New keys and the re-executed key aren't reported
+	post(uniuri.New())
+	post(key1)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Len(t, reused, 2)
+	require.Equal(t, key1, reused[0].Key)
+	require.Equal(t, key2, reused[1].Key)
+	require.True(t, reused[0].Expired.After(reused[0].Added))
+}
+
+func TestTombstones(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t,
+		potency.WithLifetime(50*time.Millisecond),
+		potency.WithTombstones(time.Hour, http.StatusConflict),
+	)
+	defer ts.shutdown(t)
+
+	post := func(key string) *resty.Response {
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", `"`+key+`"`).
+			Post("/")
+		require.NoError(t, err)
+
+		return resp
+	}
+
+	expired := uniuri.New()
+	require.Equal(t, http.StatusOK, post(expired).StatusCode())
+
+	invalidated := uniuri.New()
+	require.Equal(t, http.StatusOK, post(invalidated).StatusCode())
+	require.NoError(t, ts.pot.Invalidate(context.Background(), invalidated))
+
+	resp := post(invalidated)
+	require.Equal(t, http.StatusConflict, resp.StatusCode())
+	require.Contains(t, resp.String(), potency.ErrKeyRetired.Error())
+
+	time.Sleep(100 * time.Millisecond)
+
+	require.Equal(t, http.StatusConflict, post(expired).StatusCode())
+	require.Equal(t, http.StatusConflict, post(expired).StatusCode())
+
+	// Invalidating a key never seen retires it too
+	unseen := uniuri.New()
+	require.NoError(t, ts.pot.Invalidate(context.Background(), unseen))
+	require.Equal(t, http.StatusConflict, post(unseen).StatusCode())
+
+	require.Equal(t, http.StatusOK, post(uniuri.New()).StatusCode())
+
+	_, _, err := ts.pot.Do(context.Background(), expired, func(context.Context) (potency.Result, error) {
+		return potency.Result{}, nil
+	})
+	require.ErrorIs(t, err, potency.ErrKeyRetired)
+}
+
+func TestTombstoneLifetime(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithTombstones(50*time.Millisecond, 0))
+	defer ts.shutdown(t)
+
+	key := uniuri.New()
+
+	post := func() int {
+		resp, err := ts.r().
+			SetHeader("Idempotency-Key", `"`+key+`"`).
+			Post("/")
+		require.NoError(t, err)
+
+		return resp.StatusCode()
+	}
+
+	require.Equal(t, http.StatusOK, post())
+	require.NoError(t, ts.pot.Invalidate(context.Background(), key))
+	require.Equal(t, http.StatusGone, post())
+
+	time.Sleep(100 * time.Millisecond)
+
+	require.Equal(t, http.StatusOK, post())
+	require.Equal(t, http.StatusOK, post())
+}
@@ -0,0 +1,58 @@
+package potency
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gopatchy/jsrest"
+)
+
+// Translator returns the message for an error response in the language the
+// request asks for (e.g. from Accept-Language), or "" to keep the default
+// English message. code is from ErrorCode.
+type Translator func(r *http.Request, code string, err error) string
+
+// WithTranslator localizes the messages of error responses written by the
+// middleware. Custom ErrorWriters receive an error whose Error() is the
+// translation and which still unwraps to the original.
+func WithTranslator(translator Translator) Option {
+	return func(cfg *config) {
+		cfg.translator = translator
+	}
+}
+
+type translatedError struct {
+	msg string
+	err error
+}
+
+func (e *translatedError) Error() string {
+	return e.msg
+}
+
+func (e *translatedError) Unwrap() error {
+	return e.err
+}
+
+// translate returns err with a localized message, or err unchanged.
+func (cfg *config) translate(r *http.Request, err error) error {
+	if cfg.translator == nil {
+		return err
+	}
+
+	msg := cfg.translator(r, ErrorCode(err), err)
+	if msg == "" {
+		return err
+	}
+
+	return &translatedError{msg: msg, err: err}
+}
+
+// writeTranslated writes the jsrest error shape with only the translated
+// message, since the rest of the chain is in English.
+func writeTranslated(w http.ResponseWriter, status int, te *translatedError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(&jsrest.JSONError{Messages: []string{te.msg}})
+}
@@ -0,0 +1,76 @@
+package potency_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func german(r *http.Request, code string, err error) string {
+	if !strings.HasPrefix(r.Header.Get("Accept-Language"), "de") {
+		return ""
+	}
+
+	switch code {
+	case "invalid_key":
+		return "Ungültiger Idempotency-Key"
+	default:
+		return ""
+	}
+}
+
+func TestTranslator(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, potency.WithTranslator(german))
+	defer ts.shutdown(t)
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", "unquoted").
+		SetHeader("Accept-Language", "de-DE").
+		Post("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode())
+
+	body := struct {
+		Messages []string `json:"messages"`
+	}{}
+	require.NoError(t, json.Unmarshal(resp.Body(), &body))
+	require.Equal(t, []string{"Ungültiger Idempotency-Key"}, body.Messages)
+
+	resp, err = ts.r().
+		SetHeader("Idempotency-Key", "unquoted").
+		SetHeader("Accept-Language", "en").
+		Post("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode())
+	require.Contains(t, resp.String(), potency.ErrInvalidKey.Error())
+}
+
+func TestTranslatorErrorWriter(t *testing.T) {
+	t.Parallel()
+
+	writer := potency.JSONErrorWriter(func(status int, code, message string) any {
+		return map[string]any{"error": map[string]any{"code": code, "message": message}}
+	})
+
+	ts := newTestServer(t, potency.WithTranslator(german), potency.WithErrorWriter(writer))
+	defer ts.shutdown(t)
+
+	resp, err := ts.r().
+		SetHeader("Idempotency-Key", uniuri.New()).
+		SetHeader("Accept-Language", "de").
+		Post("")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode())
+
+	env := &errorEnvelope{}
+	require.NoError(t, json.Unmarshal(resp.Body(), env))
+	require.Equal(t, "invalid_key", env.Error.Code)
+	require.Equal(t, "Ungültiger Idempotency-Key", env.Error.Message)
+}
@@ -0,0 +1,36 @@
+package potency
+
+import "net/http"
+
+// URLNormalizer returns the URL identity of a request, which must match on
+// replay. Unlike a RouteLabeler, it must keep whatever distinguishes one
+// resource from another (IDs, query parameters).
+type URLNormalizer func(*http.Request) string
+
+// WithURLNormalizer replaces the URL identity (default r.URL.String()), e.g.
+// with OriginalURL when the middleware may be mounted under different path
+// prefixes.
+func WithURLNormalizer(normalizer URLNormalizer) Option {
+	return func(cfg *config) {
+		cfg.urlNormalizer = normalizer
+	}
+}
+
+// OriginalURL identifies requests by the request target as the client sent
+// it, which http.StripPrefix and similar routers leave untouched. It falls
+// back to r.URL for requests constructed without one.
+func OriginalURL(r *http.Request) string {
+	if r.RequestURI != "" {
+		return r.RequestURI
+	}
+
+	return r.URL.String()
+}
+
+func (cfg *config) requestURL(r *http.Request) string {
+	if cfg.urlNormalizer != nil {
+		return cfg.urlNormalizer(r)
+	}
+
+	return r.URL.String()
+}
@@ -0,0 +1,69 @@
+package potency_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOriginalURL(t *testing.T) {
+	t.Parallel()
+
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(uniuri.New()))
+	})
+
+	for _, normalize := range []bool{false, true} {
+		opts := []potency.Option{}
+		if normalize {
+			opts = append(opts, potency.WithURLNormalizer(potency.OriginalURL))
+		}
+
+		p := potency.NewPotency(inner, opts...)
+
+		// The same service, with the middleware mounted outside and inside
+		// the prefix stripping.
+		outside := httptest.NewServer(p.Handler(http.StripPrefix("/v1", inner)))
+		inside := httptest.NewServer(http.StripPrefix("/v1", p.Handler(inner)))
+
+		key := uniuri.New()
+
+		post := func(srv *httptest.Server) (int, string) {
+			req, err := http.NewRequest(http.MethodPost, srv.URL+"/v1/orders?x=1", nil)
+			require.NoError(t, err)
+
+			req.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+			resp, err := srv.Client().Do(req)
+			require.NoError(t, err)
+
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			return resp.StatusCode, string(body)
+		}
+
+		status, body1 := post(outside)
+		require.Equal(t, http.StatusOK, status)
+
+		status, body2 := post(inside)
+
+		if normalize {
+			require.Equal(t, http.StatusOK, status)
+			require.Equal(t, body1, body2)
+		} else {
+			require.Equal(t, http.StatusBadRequest, status)
+			require.Contains(t, body2, potency.ErrURLMismatch.Error())
+		}
+
+		outside.Close()
+		inside.Close()
+	}
+}
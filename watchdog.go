@@ -0,0 +1,89 @@
+package potency
+
+import (
+	"time"
+)
+
+// minWatchdogInterval bounds how often the watchdog checks.
+const minWatchdogInterval = time.Millisecond
+
+type StuckPolicy int
+
+const (
+	// StuckReport only reports executions older than the threshold.
+	StuckReport StuckPolicy = iota
+
+	// StuckRelease also releases their keys, so retries execute again. The
+	// stuck execution's result is discarded if it ever finishes.
+	StuckRelease
+)
+
+// WithWatchdog checks executing keys every threshold/2 (at most once a
+// millisecond) and calls onStuck (if not nil) once for each that has run
+// longer than threshold, e.g. to log it or increment a metric. With StuckRelease, one hung handler can't block
+// retries for its key forever; pick a threshold well above the slowest
+// legitimate request, since a released key may execute twice. Only
+// effective in NewPotency.
+func WithWatchdog(threshold time.Duration, policy StuckPolicy, onStuck func(Execution)) Option {
+	return func(cfg *config) {
+		cfg.watchdogThreshold = threshold
+		cfg.stuckPolicy = policy
+		cfg.onStuck = onStuck
+	}
+}
+
+func (p *Potency) watchdogLoop(threshold time.Duration) {
+	defer p.background.Done()
+
+	// NewTicker panics on a zero interval, and a tiny one would spin
+	interval := threshold / 2
+	if interval < minWatchdogInterval {
+		interval = minWatchdogInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.checkStuck(threshold)
+
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *Potency) checkStuck(threshold time.Duration) {
+	cfg := p.config()
+	cutoff := time.Now().Add(-threshold)
+
+	stuck := []Execution{}
+
+	p.inProgressMu.Lock()
+
+	for key, exec := range p.inProgress {
+		if exec.flagged || exec.started.After(cutoff) {
+			continue
+		}
+
+		exec.flagged = true
+		stuck = append(stuck, exec.describe(key))
+
+		if cfg.stuckPolicy == StuckRelease {
+			delete(p.inProgress, key)
+			exec.lose()
+		}
+	}
+
+	p.inProgressMu.Unlock()
+
+	if cfg.onStuck == nil {
+		return
+	}
+
+	for _, ex := range stuck {
+		cfg.onStuck(ex)
+	}
+}
@@ -0,0 +1,139 @@
+package potency_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchdogReport(t *testing.T) {
+	t.Parallel()
+
+	stuck := make(chan potency.Execution, 10)
+
+	p := potency.NewPotency(http.NotFoundHandler(), potency.WithWatchdog(50*time.Millisecond, potency.StuckReport, func(ex potency.Execution) {
+		stuck <- ex
+	}))
+	defer func() { require.NoError(t, p.Shutdown(context.Background())) }()
+
+	key := uniuri.New()
+
+	res, err := p.Reserve(key)
+	require.NoError(t, err)
+
+	ex := <-stuck
+	require.Equal(t, key, ex.Key)
+
+	// Reported once, and still reserved
+	time.Sleep(150 * time.Millisecond)
+	require.Empty(t, stuck)
+
+	_, err = p.Reserve(key)
+	require.ErrorIs(t, err, potency.ErrConflict)
+
+	require.NoError(t, res.Complete(context.Background(), &potency.SavedResult{StatusCode: http.StatusOK}))
+	require.NotNil(t, mustLookup(t, p, key))
+}
+
+func TestWatchdogRelease(t *testing.T) {
+	t.Parallel()
+
+	stuck := make(chan potency.Execution, 10)
+	release := make(chan struct{})
+	calls := make(chan string, 10)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := uniuri.New()
+		calls <- body
+
+		if r.URL.Path == "/hang" {
+			<-release
+		}
+
+		_, _ = w.Write([]byte(body))
+	})
+
+	p := potency.NewPotency(handler, potency.WithWatchdog(50*time.Millisecond, potency.StuckRelease, func(ex potency.Execution) {
+		stuck <- ex
+	}))
+	defer func() { require.NoError(t, p.Shutdown(context.Background())) }()
+
+	key := uniuri.New()
+
+	send := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Idempotency-Key", `"`+key+`"`)
+
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	hung := make(chan *httptest.ResponseRecorder)
+
+	go func() {
+		hung <- send("/hang")
+	}()
+
+	<-calls
+
+	ex := <-stuck
+	require.Equal(t, key, ex.Key)
+	require.Equal(t, "/hang", ex.Path)
+	require.Empty(t, p.InProgress())
+
+	// The retry executes again, and its result wins
+	rec := send("/hang2")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, <-calls, rec.Body.String())
+
+	close(release)
+	<-hung
+
+	saved := mustLookup(t, p, key)
+	require.NotNil(t, saved)
+	require.Equal(t, rec.Body.String(), string(saved.ResponseBody))
+}
+
+func TestWatchdogReservation(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler(), potency.WithWatchdog(20*time.Millisecond, potency.StuckRelease, nil))
+	defer func() { require.NoError(t, p.Shutdown(context.Background())) }()
+
+	key := uniuri.New()
+
+	res, err := p.Reserve(key)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return len(p.InProgress()) == 0 }, time.Second, 5*time.Millisecond)
+
+	err = res.Complete(context.Background(), &potency.SavedResult{StatusCode: http.StatusOK})
+	require.ErrorIs(t, err, potency.ErrLeaseLost)
+	require.Nil(t, mustLookup(t, p, key))
+
+	_, _, err = p.Do(context.Background(), uniuri.New(), func(ctx context.Context) (potency.Result, error) {
+		time.Sleep(100 * time.Millisecond)
+		return potency.Result{Value: []byte("late")}, nil
+	})
+	require.ErrorIs(t, err, potency.ErrLeaseLost)
+}
+
+func TestWatchdogTinyThreshold(t *testing.T) {
+	t.Parallel()
+
+	p := potency.NewPotency(http.NotFoundHandler(), potency.WithWatchdog(time.Nanosecond, potency.StuckRelease, nil))
+	defer func() { require.NoError(t, p.Shutdown(context.Background())) }()
+
+	_, err := p.Reserve(uniuri.New())
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return len(p.InProgress()) == 0 }, time.Second, 5*time.Millisecond)
+}
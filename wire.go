@@ -0,0 +1,288 @@
+package potency
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Wire format: a single version byte followed by a CBOR map with integer
+// keys. New fields get new integer keys; incompatible changes bump the
+// version and add a migration in Unmarshal.
+//
+// Version 2 encodes headers as HeaderFields instead of maps. Version 1 is
+// still read.
+const (
+	wireVersion1 byte = 1
+	wireVersion2 byte = 2
+)
+
+var (
+	ErrWireFormat         = errors.New("invalid wire format")
+	ErrUnsupportedVersion = fmt.Errorf("unsupported wire version: %w", ErrWireFormat)
+)
+
+type wireV1 struct {
+	Key string `cbor:"1,keyasint"`
+
+	Method        string              `cbor:"2,keyasint"`
+	URL           string              `cbor:"3,keyasint"`
+	RequestHeader map[string][]string `cbor:"4,keyasint"`
+	BodyHash      []byte              `cbor:"5,keyasint"`
+
+	StatusCode     int                 `cbor:"6,keyasint"`
+	ResponseHeader map[string][]string `cbor:"7,keyasint"`
+	ResponseBody   []byte              `cbor:"8,keyasint"`
+
+	Added int64 `cbor:"9,keyasint"`
+
+	ResponseTrailer map[string][]string `cbor:"10,keyasint,omitempty"`
+
+	RequestID string `cbor:"11,keyasint,omitempty"`
+	Principal string `cbor:"12,keyasint,omitempty"`
+}
+
+type wireV2 struct {
+	Key string `cbor:"1,keyasint"`
+
+	Method        string        `cbor:"2,keyasint"`
+	URL           string        `cbor:"3,keyasint"`
+	RequestHeader []HeaderField `cbor:"4,keyasint"`
+	BodyHash      []byte        `cbor:"5,keyasint"`
+
+	StatusCode     int           `cbor:"6,keyasint"`
+	ResponseHeader []HeaderField `cbor:"7,keyasint"`
+	ResponseBody   []byte        `cbor:"8,keyasint"`
+
+	Added int64 `cbor:"9,keyasint"`
+
+	ResponseTrailer []HeaderField `cbor:"10,keyasint,omitempty"`
+
+	RequestID string `cbor:"11,keyasint,omitempty"`
+	Principal string `cbor:"12,keyasint,omitempty"`
+
+	RequestDigest []byte `cbor:"13,keyasint,omitempty"`
+
+	ClientIP  string `cbor:"14,keyasint,omitempty"`
+	UserAgent string `cbor:"15,keyasint,omitempty"`
+}
+
+// HeaderField is one header name with all of its values, in order. A nil
+// Values (as opposed to an empty one) records a header set to nil to suppress
+// a default such as Date.
+type HeaderField struct {
+	_      struct{} `cbor:",toarray"`
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// EncodeHeader converts h to its canonical encoding: names canonicalized and
+// sorted, each with its values in their original order. Names that only
+// differ in case are merged.
+func EncodeHeader(h http.Header) []HeaderField {
+	if h == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	byName := map[string]int{}
+	fields := make([]HeaderField, 0, len(h))
+
+	for _, raw := range names {
+		name := http.CanonicalHeaderKey(raw)
+		values := h[raw]
+
+		if i, found := byName[name]; found {
+			fields[i].Values = append(fields[i].Values, values...)
+			continue
+		}
+
+		byName[name] = len(fields)
+		fields = append(fields, HeaderField{Name: name, Values: values})
+	}
+
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+
+	return fields
+}
+
+// DecodeHeader converts fields from EncodeHeader back to an http.Header.
+func DecodeHeader(fields []HeaderField) http.Header {
+	if fields == nil {
+		return nil
+	}
+
+	h := make(http.Header, len(fields))
+
+	for _, field := range fields {
+		name := http.CanonicalHeaderKey(field.Name)
+
+		if field.Values == nil {
+			if _, found := h[name]; !found {
+				h[name] = nil
+			}
+
+			continue
+		}
+
+		h[name] = append(h[name], field.Values...)
+	}
+
+	return h
+}
+
+func (sr *SavedResult) Marshal() ([]byte, error) {
+	w := &wireV2{
+		Key: sr.Key,
+
+		Method:        sr.Method,
+		URL:           sr.URL,
+		RequestHeader: EncodeHeader(sr.RequestHeader),
+		BodyHash:      sr.BodyHash,
+
+		StatusCode:     sr.StatusCode,
+		ResponseHeader: EncodeHeader(sr.ResponseHeader),
+		ResponseBody:   sr.ResponseBody,
+
+		Added: sr.Added.UnixNano(),
+
+		ResponseTrailer: EncodeHeader(sr.ResponseTrailer),
+
+		RequestID: sr.RequestID,
+		Principal: sr.Principal,
+
+		RequestDigest: sr.RequestDigest,
+
+		ClientIP:  sr.ClientIP,
+		UserAgent: sr.UserAgent,
+	}
+
+	enc, err := cbor.CoreDetEncOptions().EncMode()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := enc.Marshal(w)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{wireVersion2}, data...), nil
+}
+
+func Unmarshal(data []byte) (*SavedResult, error) {
+	if len(data) < 1 {
+		return nil, fmt.Errorf("empty input (%w)", ErrWireFormat)
+	}
+
+	switch data[0] {
+	case wireVersion1:
+		return unmarshalV1(data[1:])
+
+	case wireVersion2:
+		return unmarshalV2(data[1:])
+
+	default:
+		return nil, fmt.Errorf("%d (%w)", data[0], ErrUnsupportedVersion)
+	}
+}
+
+func unmarshalV1(data []byte) (*SavedResult, error) {
+	w := &wireV1{}
+
+	err := cbor.Unmarshal(data, w)
+	if err != nil {
+		return nil, fmt.Errorf("%s (%w)", err, ErrWireFormat)
+	}
+
+	return &SavedResult{
+		Key: w.Key,
+
+		Method:        w.Method,
+		URL:           w.URL,
+		RequestHeader: http.Header(w.RequestHeader),
+		BodyHash:      w.BodyHash,
+
+		StatusCode:     w.StatusCode,
+		ResponseHeader: http.Header(w.ResponseHeader),
+		ResponseBody:   w.ResponseBody,
+
+		Added: time.Unix(0, w.Added),
+
+		ResponseTrailer: http.Header(w.ResponseTrailer),
+
+		RequestID: w.RequestID,
+		Principal: w.Principal,
+	}, nil
+}
+
+func unmarshalV2(data []byte) (*SavedResult, error) {
+	w := &wireV2{}
+
+	err := cbor.Unmarshal(data, w)
+	if err != nil {
+		return nil, fmt.Errorf("%s (%w)", err, ErrWireFormat)
+	}
+
+	return &SavedResult{
+		Key: w.Key,
+
+		Method:        w.Method,
+		URL:           w.URL,
+		RequestHeader: DecodeHeader(w.RequestHeader),
+		BodyHash:      w.BodyHash,
+
+		StatusCode:     w.StatusCode,
+		ResponseHeader: DecodeHeader(w.ResponseHeader),
+		ResponseBody:   w.ResponseBody,
+
+		Added: time.Unix(0, w.Added),
+
+		ResponseTrailer: DecodeHeader(w.ResponseTrailer),
+
+		RequestID: w.RequestID,
+		Principal: w.Principal,
+
+		RequestDigest: w.RequestDigest,
+
+		ClientIP:  w.ClientIP,
+		UserAgent: w.UserAgent,
+	}, nil
+}
+
+// Serializer converts saved results to and from bytes for peers and
+// replicas. All instances must use the same one.
+type Serializer interface {
+	Marshal(*SavedResult) ([]byte, error)
+	Unmarshal([]byte) (*SavedResult, error)
+}
+
+// WireSerializer is the default Serializer, using SavedResult.Marshal and
+// Unmarshal.
+type WireSerializer struct{}
+
+func (WireSerializer) Marshal(sr *SavedResult) ([]byte, error) {
+	return sr.Marshal()
+}
+
+func (WireSerializer) Unmarshal(data []byte) (*SavedResult, error) {
+	return Unmarshal(data)
+}
+
+// WithSerializer replaces the format of results sent to peers (PeerHandler)
+// and replicas. Use HTTPPool.SetSerializer to read them with the same one.
+func WithSerializer(serializer Serializer) Option {
+	return func(cfg *config) {
+		cfg.serializer = serializer
+	}
+}
@@ -0,0 +1,158 @@
+package potency_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gopatchy/potency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshal(t *testing.T) {
+	t.Parallel()
+
+	sr := &potency.SavedResult{
+		Key: "abc",
+
+		Method:        http.MethodPost,
+		URL:           "/foo?bar=1",
+		RequestHeader: http.Header{"Accept": {"application/json"}},
+		BodyHash:      []byte{1, 2, 3},
+
+		StatusCode:     http.StatusCreated,
+		ResponseHeader: http.Header{"X-Response": {"a", "b"}},
+		ResponseBody:   []byte("hello"),
+
+		Added: time.Unix(1700000000, 1234),
+
+		RequestID: "req-1",
+		Principal: "alice",
+
+		RequestDigest: []byte{4, 5, 6},
+	}
+
+	data, err := sr.Marshal()
+	require.NoError(t, err)
+	require.Equal(t, byte(2), data[0])
+
+	sr2, err := potency.Unmarshal(data)
+	require.NoError(t, err)
+	require.Equal(t, sr.Key, sr2.Key)
+	require.Equal(t, sr.Method, sr2.Method)
+	require.Equal(t, sr.URL, sr2.URL)
+	require.Equal(t, sr.RequestHeader, sr2.RequestHeader)
+	require.Equal(t, sr.BodyHash, sr2.BodyHash)
+	require.Equal(t, sr.StatusCode, sr2.StatusCode)
+	require.Equal(t, sr.ResponseHeader, sr2.ResponseHeader)
+	require.Equal(t, sr.ResponseBody, sr2.ResponseBody)
+	require.True(t, sr.Added.Equal(sr2.Added))
+	require.Equal(t, sr.RequestID, sr2.RequestID)
+	require.Equal(t, sr.Principal, sr2.Principal)
+	require.Equal(t, sr.RequestDigest, sr2.RequestDigest)
+
+	_, err = potency.Unmarshal(append([]byte{99}, data[1:]...))
+	require.ErrorIs(t, err, potency.ErrUnsupportedVersion)
+
+	_, err = potency.Unmarshal(nil)
+	require.ErrorIs(t, err, potency.ErrWireFormat)
+
+	_, err = potency.Unmarshal([]byte{1, 0xff})
+	require.ErrorIs(t, err, potency.ErrWireFormat)
+}
+
+func TestHeaderEncoding(t *testing.T) {
+	t.Parallel()
+
+	h := http.Header{
+		"X-Multi": {"b", "a", "c"},
+		"x-lower": {"1"},
+		"X-Lower": {"2"},
+		"Date":    nil,
+		"X-Empty": {},
+	}
+
+	fields := potency.EncodeHeader(h)
+	require.Equal(t, []potency.HeaderField{
+		{Name: "Date", Values: nil},
+		{Name: "X-Empty", Values: []string{}},
+		{Name: "X-Lower", Values: []string{"2", "1"}},
+		{Name: "X-Multi", Values: []string{"b", "a", "c"}},
+	}, fields)
+
+	sr := &potency.SavedResult{
+		Key:            "abc",
+		ResponseHeader: h,
+	}
+
+	data, err := sr.Marshal()
+	require.NoError(t, err)
+
+	sr2, err := potency.Unmarshal(data)
+	require.NoError(t, err)
+	require.Equal(t, potency.DecodeHeader(fields), sr2.ResponseHeader)
+	require.Equal(t, []string{"b", "a", "c"}, sr2.ResponseHeader.Values("X-Multi"))
+	require.Contains(t, sr2.ResponseHeader, "Date")
+	require.Nil(t, sr2.ResponseHeader["Date"])
+	require.Nil(t, sr2.RequestHeader)
+}
+
+func TestUnmarshalV1(t *testing.T) {
+	t.Parallel()
+
+	data, err := cbor.Marshal(map[int]any{
+		1: "abc",
+		6: http.StatusOK,
+		7: map[string][]string{"X-Response": {"a", "b"}},
+		9: int64(1700000000000000000),
+	})
+	require.NoError(t, err)
+
+	sr, err := potency.Unmarshal(append([]byte{1}, data...))
+	require.NoError(t, err)
+	require.Equal(t, "abc", sr.Key)
+	require.Equal(t, http.Header{"X-Response": {"a", "b"}}, sr.ResponseHeader)
+}
+
+type prefixSerializer struct{}
+
+func (prefixSerializer) Marshal(sr *potency.SavedResult) ([]byte, error) {
+	data, err := sr.Marshal()
+	return append([]byte("custom:"), data...), err
+}
+
+func (prefixSerializer) Unmarshal(data []byte) (*potency.SavedResult, error) {
+	if !bytes.HasPrefix(data, []byte("custom:")) {
+		return nil, potency.ErrWireFormat
+	}
+
+	return potency.Unmarshal(data[len("custom:"):])
+}
+
+func TestSerializer(t *testing.T) {
+	t.Parallel()
+
+	ts1 := newTestServer(t, potency.WithSerializer(prefixSerializer{}))
+	defer ts1.shutdown(t)
+
+	ts2 := newTestServer(t, potency.WithSerializer(prefixSerializer{}))
+	defer ts2.shutdown(t)
+
+	bus := &testBus{}
+
+	require.NoError(t, ts1.pot.SetReplicator(bus))
+	require.NoError(t, ts2.pot.SetReplicator(bus))
+
+	resp, err := ts1.r().
+		SetHeader("Idempotency-Key", fmt.Sprintf(`"%s"`, uniuri.New())).
+		SetBody("test1").
+		Post("")
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	require.Equal(t, 1, ts2.pot.NumCached())
+}